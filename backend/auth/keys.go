@@ -0,0 +1,217 @@
+// Package auth signs and verifies the JWTs issued by the API.
+//
+// Tokens are signed with RS256 or EdDSA keys loaded from JWT_KEYS_DIR, or with
+// HS256 and SECRET when no key directory is configured. Every token carries
+// the ID of its key in the kid header, so a key can be rotated while tokens
+// signed by the previous one are still accepted.
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// DefaultSecret is the HS256 secret used when neither JWT_KEYS_DIR nor SECRET
+// is set. It is public, so it is only allowed in development.
+const DefaultSecret = "secret-key"
+
+const hmacKeyID = "hs256"
+
+// minRSABits is the smallest RSA key accepted for RS256.
+const minRSABits = 2048
+
+var ErrDefaultSecret = errors.New("refusing to sign tokens with the default secret: set JWT_KEYS_DIR or SECRET, or run with -dev")
+
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	// signKey is nil for keys that only verify tokens signed before a
+	// rotation.
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds the key that signs new tokens and every key whose tokens are
+// still accepted.
+type KeySet struct {
+	signing    *key
+	keys       map[string]*key
+	algorithms []string
+}
+
+// LoadKeySetFromEnv loads the keys from JWT_KEYS_DIR, signing with the key
+// named by JWT_SIGNING_KEY. Without JWT_KEYS_DIR it signs with HS256 and
+// SECRET, and returns ErrDefaultSecret if SECRET is unset or the default,
+// unless allowDefaultSecret is set.
+func LoadKeySetFromEnv(allowDefaultSecret bool) (*KeySet, error) {
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		return LoadKeySet(dir, os.Getenv("JWT_SIGNING_KEY"))
+	}
+	secret := os.Getenv("SECRET")
+	if secret == "" || secret == DefaultSecret {
+		if !allowDefaultSecret {
+			return nil, ErrDefaultSecret
+		}
+		secret = DefaultSecret
+	}
+	return NewHMACKeySet(secret), nil
+}
+
+// NewHMACKeySet signs and verifies tokens with HS256 and the secret.
+func NewHMACKeySet(secret string) *KeySet {
+	k := &key{id: hmacKeyID, method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}
+	return newKeySet(k, []*key{k})
+}
+
+// LoadKeySet loads the PEM encoded keys in dir. The ID of a key is its file
+// name without the extension: <kid>.pem holds a private key, which can sign,
+// and <kid>.pub.pem a public key, which only verifies tokens of a retired key.
+// RSA keys sign with RS256 and Ed25519 keys with EdDSA.
+//
+// signingKID selects the private key that signs new tokens. It may be empty if
+// there is only one private key.
+func LoadKeySet(dir string, signingKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var keys []*key
+	seen := make(map[string]bool)
+	var private []string
+	for _, path := range paths {
+		k, err := loadKey(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load %s", path)
+		}
+		if seen[k.id] {
+			return nil, fmt.Errorf("duplicate key ID %q in %s", k.id, dir)
+		}
+		seen[k.id] = true
+		if k.signKey != nil {
+			private = append(private, k.id)
+		}
+		keys = append(keys, k)
+	}
+
+	if signingKID == "" {
+		if len(private) != 1 {
+			return nil, fmt.Errorf("%s has %d private keys: set JWT_SIGNING_KEY to the ID of the one that signs", dir, len(private))
+		}
+		signingKID = private[0]
+	}
+	for _, k := range keys {
+		if k.id == signingKID {
+			if k.signKey == nil {
+				return nil, fmt.Errorf("signing key %q has no private key", signingKID)
+			}
+			return newKeySet(k, keys), nil
+		}
+	}
+	return nil, fmt.Errorf("signing key %q not found in %s", signingKID, dir)
+}
+
+func newKeySet(signing *key, keys []*key) *KeySet {
+	ks := &KeySet{signing: signing, keys: make(map[string]*key, len(keys))}
+	algs := make(map[string]bool)
+	for _, k := range keys {
+		ks.keys[k.id] = k
+		if alg := k.method.Alg(); !algs[alg] {
+			algs[alg] = true
+			ks.algorithms = append(ks.algorithms, alg)
+		}
+	}
+	return ks
+}
+
+func loadKey(path string) (*key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), ".pem")
+	public := strings.HasSuffix(name, ".pub")
+	k := &key{id: strings.TrimSuffix(name, ".pub")}
+
+	var parsed interface{}
+	switch {
+	case public && block.Type == "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case public && block.Type == "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case !public && block.Type == "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case !public && block.Type == "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch pk := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.signKey, k.verifyKey = jwt.SigningMethodRS256, pk, &pk.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.verifyKey = jwt.SigningMethodRS256, pk
+	case ed25519.PrivateKey:
+		k.method, k.signKey, k.verifyKey = jwt.SigningMethodEdDSA, pk, pk.Public()
+	case ed25519.PublicKey:
+		k.method, k.verifyKey = jwt.SigningMethodEdDSA, pk
+	default:
+		return nil, fmt.Errorf("unsupported key type %T: use RSA or Ed25519", parsed)
+	}
+	if pub, ok := k.verifyKey.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key of %d bits is too short, at least %d are required", pub.N.BitLen(), minRSABits)
+	}
+	return k, nil
+}
+
+// SigningKeyID is the kid of the tokens signed now.
+func (ks *KeySet) SigningKeyID() string {
+	return ks.signing.id
+}
+
+// Sign returns the token of the claims, signed with the signing key.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Parse verifies the token with the key named by its kid header and decodes
+// its claims into claims.
+func (ks *KeySet) Parse(token string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(token, claims, ks.keyfunc, jwt.WithValidMethods(ks.algorithms))
+}
+
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	// A token must not pick another algorithm for the key, e.g. HS256 with
+	// the public RSA key as the secret.
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+	}
+	return k.verifyKey, nil
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) {
+	t.Helper()
+	b := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeEd25519Key(t *testing.T, dir string, kid string) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid+".pem", "PRIVATE KEY", der)
+	return priv
+}
+
+func writeRSAKey(t *testing.T, dir string, kid string, bits int) *rsa.PrivateKey {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid+".pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv))
+	return priv
+}
+
+func newClaims() *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	for _, alg := range []string{"RS256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			dir := t.TempDir()
+			if alg == "RS256" {
+				writeRSAKey(t, dir, "k1", 2048)
+			} else {
+				writeEd25519Key(t, dir, "k1")
+			}
+			ks, err := LoadKeySet(dir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signed, err := ks.Sign(newClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ks.Parse(signed, new(jwt.RegisteredClaims))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Header["kid"] != "k1" || token.Method.Alg() != alg {
+				t.Errorf("header = %v", token.Header)
+			}
+
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "k1" || jwks.Keys[0].Algorithm != alg {
+				t.Errorf("JWKS = %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeEd25519Key(t, dir, "2026-01")
+	old, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := old.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate: a new key signs, and the old one still verifies.
+	writeRSAKey(t, dir, "2026-02", 2048)
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Error("LoadKeySet with two private keys and no signing key succeeded")
+	}
+	ks, err := LoadKeySet(dir, "2026-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := ks.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := ks.Parse(token, new(jwt.RegisteredClaims)); err != nil {
+			t.Errorf("Parse after rotation: %v", err)
+		}
+	}
+	if got := ks.JWKS(); len(got.Keys) != 2 || got.Keys[0].KeyType != "OKP" || got.Keys[1].KeyType != "RSA" {
+		t.Errorf("JWKS = %+v", got)
+	}
+
+	// Retire the old key: only its public key is kept.
+	if err := os.Remove(filepath.Join(dir, "2026-01.pem")); err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(oldKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "2026-01.pub.pem", "PUBLIC KEY", der)
+	if _, err := LoadKeySet(dir, "2026-01"); err == nil {
+		t.Error("LoadKeySet signing with a public key succeeded")
+	}
+	ks, err = LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(oldToken, new(jwt.RegisteredClaims)); err != nil {
+		t.Errorf("Parse with the retired public key: %v", err)
+	}
+
+	// Once removed, the old tokens are refused.
+	if err := os.Remove(filepath.Join(dir, "2026-01.pub.pem")); err != nil {
+		t.Fatal(err)
+	}
+	ks, err = LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(oldToken, new(jwt.RegisteredClaims)); err == nil {
+		t.Error("Parse with a removed key succeeded")
+	}
+}
+
+func TestParseRefusesForgedTokens(t *testing.T) {
+	dir := t.TempDir()
+	priv := writeRSAKey(t, dir, "k1", 2048)
+	ks, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 with the public key as the secret.
+	pub := x509.MarshalPKCS1PublicKey(&priv.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims())
+	forged.Header["kid"] = "k1"
+	signed, err := forged.SignedString(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(signed, new(jwt.RegisteredClaims)); err == nil {
+		t.Error("Parse accepted an HS256 token for an RSA key")
+	}
+
+	// Unknown and missing kid.
+	for _, kid := range []interface{}{"k2", nil} {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, newClaims())
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.Parse(signed, new(jwt.RegisteredClaims)); err == nil {
+			t.Errorf("Parse accepted a token with kid %v", kid)
+		}
+	}
+
+	// Tokens of a HMAC key set are not accepted either.
+	hmacToken, err := NewHMACKeySet("secret").Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(hmacToken, new(jwt.RegisteredClaims)); err == nil {
+		t.Error("Parse accepted a HS256 token")
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "short", 1024)
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Error("LoadKeySet accepted a 1024 bit RSA key")
+	}
+
+	if _, err := LoadKeySet(t.TempDir(), ""); err == nil {
+		t.Error("LoadKeySet of an empty directory succeeded")
+	}
+}
+
+func TestLoadKeySetFromEnv(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", "")
+	for _, secret := range []string{"", DefaultSecret} {
+		t.Setenv("SECRET", secret)
+		if _, err := LoadKeySetFromEnv(false); !errors.Is(err, ErrDefaultSecret) {
+			t.Errorf("SECRET=%q: err = %v, want ErrDefaultSecret", secret, err)
+		}
+		if _, err := LoadKeySetFromEnv(true); err != nil {
+			t.Errorf("SECRET=%q in development: %v", secret, err)
+		}
+	}
+
+	t.Setenv("SECRET", "a real secret")
+	ks, err := LoadKeySetFromEnv(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.SigningKeyID() != hmacKeyID || len(ks.JWKS().Keys) != 0 {
+		t.Errorf("HMAC key set signs with %q and publishes %+v", ks.SigningKeyID(), ks.JWKS())
+	}
+
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "k1")
+	t.Setenv("JWT_KEYS_DIR", dir)
+	if ks, err := LoadKeySetFromEnv(false); err != nil || ks.SigningKeyID() != "k1" {
+		t.Errorf("JWT_KEYS_DIR: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// client calls the API and records every request with its scorer. A client
+// without a scorer is used for setup and verification, which do not score.
+type client struct {
+	base   string
+	http   *http.Client
+	scorer *scorer
+}
+
+type request struct {
+	method string
+	// route is the route pattern of the endpoint, which groups the results.
+	route string
+	path  string
+	token string
+	// json is encoded as the request body if set.
+	json interface{}
+	// form and image make a multipart request body if form is set.
+	form  map[string]string
+	image []byte
+	// accept lists the correct status codes, 200 if empty.
+	accept []int
+}
+
+// do sends the request and decodes a 200 response into out if it is not nil.
+// It returns the status code, or false if the request failed, the status code
+// is not accepted or the body could not be decoded.
+func (c *client) do(ctx context.Context, r request, out interface{}) (int, bool) {
+	if len(r.accept) == 0 {
+		r.accept = []int{http.StatusOK}
+	}
+	res := result{endpoint: r.method + " " + r.route, method: r.method, accept: r.accept}
+
+	req, err := c.newRequest(ctx, r)
+	if err != nil {
+		panic(err)
+	}
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	res.latency = time.Since(start)
+	res.err = err
+	if err == nil {
+		res.status = resp.StatusCode
+	}
+
+	// Requests cut off by the end of the run are neither scored nor failed.
+	if err != nil && ctx.Err() != nil {
+		return 0, false
+	}
+	if c.scorer != nil {
+		c.scorer.record(res)
+	}
+	if err != nil || !accepted(res.status, r.accept) {
+		return res.status, false
+	}
+	if out != nil && res.status == http.StatusOK {
+		if err := json.Unmarshal(body, out); err != nil {
+			c.fail("%s: invalid response body: %v", res.endpoint, err)
+			return res.status, false
+		}
+	}
+	return res.status, true
+}
+
+func (c *client) newRequest(ctx context.Context, r request) (*http.Request, error) {
+	var body io.Reader
+	contentType := ""
+	switch {
+	case r.json != nil:
+		b, err := json.Marshal(r.json)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	case r.form != nil:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for k, v := range r.form {
+			if err := mw.WriteField(k, v); err != nil {
+				return nil, err
+			}
+		}
+		if r.image != nil {
+			fw, err := mw.CreateFormFile("image", "image.png")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := fw.Write(r.image); err != nil {
+				return nil, err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+		body, contentType = &buf, mw.FormDataContentType()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, c.base+r.path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return req, nil
+}
+
+// fail records a validation failure if the client scores.
+func (c *client) fail(format string, args ...interface{}) {
+	if c.scorer != nil {
+		c.scorer.fail(format, args...)
+	}
+}
+
+func itemPath(id int64, suffix string) string {
+	return "/items/" + strconv.FormatInt(id, 10) + suffix
+}
+
+func userItemsPath(id int64) string {
+	return fmt.Sprintf("/users/%d/items", id)
+}
@@ -0,0 +1,90 @@
+// Command bench drives the API with concurrent users and scores it like the
+// hackathon benchmark: users register, log in, browse, search, sell and
+// purchase items while the invariants of the balances are checked. It prints
+// the score breakdown and the latency percentiles of every endpoint.
+//
+// Usage:
+//
+//	go run ./cmd/bench [-url http://127.0.0.1:9000] [-duration 60s] [-workers 8]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func main() {
+	var (
+		baseURL    = flag.String("url", "http://127.0.0.1:9000", "base URL of the API")
+		duration   = flag.Duration("duration", 60*time.Second, "how long to run the load")
+		workers    = flag.Int("workers", 8, "number of concurrent users")
+		timeout    = flag.Duration("timeout", 5*time.Second, "timeout of a single request")
+		initialize = flag.Bool("initialize", true, "call POST /initialize before the run")
+		seed       = flag.Int64("seed", time.Now().UnixNano(), "seed of the random flows")
+	)
+	flag.Parse()
+	os.Exit(run(*baseURL, *duration, *workers, *timeout, *initialize, *seed))
+}
+
+// run returns the exit code: 1 if the benchmark stopped early or found a
+// validation failure.
+func run(baseURL string, duration time.Duration, workers int, timeout time.Duration, initialize bool, seed int64) int {
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: workers * purchaseAttempts},
+	}
+	s := newScorer()
+	base := strings.TrimSuffix(baseURL, "/")
+	b := newBench(&client{base: base, http: httpClient, scorer: s}, &client{base: base, http: httpClient})
+
+	if err := b.setup(context.Background(), initialize); err != nil {
+		fmt.Fprintf(os.Stderr, "benchmark stopped: %s\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b.worker(ctx, seed+int64(i))
+		}(i)
+	}
+
+	// The run ends early by the penalty of the status code mismatches, or as
+	// soon as the benchmark has to stop.
+	abort := ""
+	ticker := time.NewTicker(100 * time.Millisecond)
+	for range ticker.C {
+		if abort = s.abortReason(); abort != "" {
+			break
+		}
+		if time.Since(start) >= duration-s.penalty() {
+			break
+		}
+	}
+	ticker.Stop()
+	cancel()
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	b.verifyState(context.Background())
+	s.report(os.Stdout, elapsed)
+
+	if abort != "" {
+		fmt.Fprintf(os.Stderr, "benchmark stopped: %s\n", abort)
+		return 1
+	}
+	if s.failures() > 0 {
+		return 1
+	}
+	return 0
+}
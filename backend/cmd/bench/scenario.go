@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	statusOnSale = 1
+
+	initialDeposit = 100000
+	// purchaseAttempts is how many times a purchase is sent at once, to check
+	// that an item is sold and paid for only once.
+	purchaseAttempts = 3
+)
+
+type listedItem struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Price        int64  `json:"price"`
+	CategoryName string `json:"category_name"`
+}
+
+type itemDetail struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	CategoryID   int64  `json:"category_id"`
+	CategoryName string `json:"category_name"`
+	UserID       int64  `json:"user_id"`
+	Price        int64  `json:"price"`
+	Description  string `json:"description"`
+	Status       int    `json:"status"`
+}
+
+type category struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type user struct {
+	ID    int64
+	Name  string
+	Token string
+}
+
+// account is what the bench expects the balance of one of its users to be.
+type account struct {
+	deposited int64
+	spent     int64
+	// uncertain is set when a purchase by the user has an unknown outcome,
+	// so its balance cannot be checked.
+	uncertain bool
+}
+
+// balance leaves out sales: sellers are paid once their buyers receive the
+// items, which the bench never confirms.
+func (a *account) balance() int64 {
+	return a.deposited - a.spent
+}
+
+// bench holds the state shared by the workers.
+type bench struct {
+	c *client
+	// verify is an unscored client for the setup and the final verification.
+	verify *client
+	image  []byte
+	// runID tells apart the users of runs against a server that is not
+	// initialized in between, since login names are unique.
+	runID string
+
+	categories []category
+
+	mu       sync.Mutex
+	accounts map[int64]*account
+	users    map[int64]user
+	// sold maps the items bought by the bench to their buyers.
+	sold     map[int64]int64
+	keywords []string
+	userSeq  int
+	itemSeq  int
+}
+
+func newBench(c, verify *client) *bench {
+	return &bench{
+		c:        c,
+		verify:   verify,
+		image:    benchImage(),
+		runID:    strconv.FormatInt(time.Now().Unix(), 36),
+		accounts: make(map[int64]*account),
+		users:    make(map[int64]user),
+		sold:     make(map[int64]int64),
+		keywords: []string{"item", "bench"},
+	}
+}
+
+// setup initializes the server if asked and loads what the workers need.
+func (b *bench) setup(ctx context.Context, initialize bool) error {
+	if initialize {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if status, ok := b.verify.do(ctx, request{method: http.MethodPost, route: "/initialize", path: "/initialize"}, nil); !ok {
+			return fmt.Errorf("failed to initialize: status %d", status)
+		}
+	}
+	if status, ok := b.verify.do(ctx, request{method: http.MethodGet, route: "/items/categories", path: "/items/categories"}, &b.categories); !ok {
+		return fmt.Errorf("failed to get categories: status %d", status)
+	}
+	if len(b.categories) == 0 {
+		return fmt.Errorf("no categories to list items in")
+	}
+	return nil
+}
+
+// worker runs random flows as one user until ctx is done. It starts over as a
+// new user from time to time.
+func (b *bench) worker(ctx context.Context, seed int64) {
+	rnd := rand.New(rand.NewSource(seed))
+	var u user
+	for ctx.Err() == nil {
+		if u.Token == "" || rnd.Intn(50) == 0 {
+			var ok bool
+			if u, ok = b.register(ctx); !ok {
+				continue
+			}
+		}
+		switch n := rnd.Intn(100); {
+		case n < 40:
+			b.browse(ctx, rnd)
+		case n < 65:
+			b.search(ctx, rnd)
+		case n < 80:
+			b.sell(ctx, rnd, u)
+		default:
+			b.purchase(ctx, rnd, u)
+		}
+	}
+}
+
+// register signs up a new user, logs in and deposits the initial balance.
+func (b *bench) register(ctx context.Context) (user, bool) {
+	b.mu.Lock()
+	b.userSeq++
+	name := fmt.Sprintf("bench-%s-%d", b.runID, b.userSeq)
+	b.mu.Unlock()
+	password := "pw-" + name
+
+	var reg struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if _, ok := b.c.do(ctx, request{
+		method: http.MethodPost, route: "/register", path: "/register",
+		json: map[string]string{"name": name, "password": password},
+	}, &reg); !ok {
+		return user{}, false
+	}
+	if reg.Name != name {
+		b.c.fail("POST /register: name is %q, want %q", reg.Name, name)
+	}
+
+	var login struct {
+		ID    int64  `json:"id"`
+		Token string `json:"token"`
+	}
+	if _, ok := b.c.do(ctx, request{
+		method: http.MethodPost, route: "/login", path: "/login",
+		json: map[string]string{"login": name, "password": password},
+	}, &login); !ok {
+		return user{}, false
+	}
+	if login.ID != reg.ID || login.Token == "" {
+		b.c.fail("POST /login: logged in as user %d, want %d", login.ID, reg.ID)
+		return user{}, false
+	}
+	u := user{ID: reg.ID, Name: name, Token: login.Token}
+
+	b.mu.Lock()
+	b.users[u.ID] = u
+	b.accounts[u.ID] = &account{}
+	b.mu.Unlock()
+
+	// Deposits and purchases complete even if the run ends meanwhile, so that
+	// the balances can be verified.
+	if _, ok := b.c.do(context.Background(), request{
+		method: http.MethodPost, route: "/balance", path: "/balance", token: u.Token,
+		json: map[string]int64{"balance": initialDeposit},
+	}, nil); !ok {
+		b.markUncertain(u.ID)
+		return u, true
+	}
+	b.mu.Lock()
+	b.accounts[u.ID].deposited += initialDeposit
+	b.mu.Unlock()
+
+	var balance struct {
+		Balance int64 `json:"balance"`
+	}
+	if _, ok := b.c.do(ctx, request{method: http.MethodGet, route: "/balance", path: "/balance", token: u.Token}, &balance); ok && balance.Balance != initialDeposit {
+		b.c.fail("GET /balance: new user %d has %d yen after depositing %d", u.ID, balance.Balance, initialDeposit)
+	}
+	return u, true
+}
+
+// browse lists the items on sale and opens one of them.
+func (b *bench) browse(ctx context.Context, rnd *rand.Rand) {
+	items, ok := b.listItems(ctx)
+	if !ok || len(items) == 0 {
+		return
+	}
+	listed := items[rnd.Intn(len(items))]
+
+	var item itemDetail
+	if _, ok := b.c.do(ctx, request{method: http.MethodGet, route: "/items/:itemID", path: itemPath(listed.ID, "")}, &item); !ok {
+		return
+	}
+	if item.ID != listed.ID || item.Name != listed.Name {
+		b.c.fail("GET /items/%d: got item %d %q, want %q", listed.ID, item.ID, item.Name, listed.Name)
+	}
+	b.addKeywords(item.Name)
+
+	b.c.do(ctx, request{method: http.MethodGet, route: "/items/:itemID/image", path: itemPath(listed.ID, "/image")}, nil)
+}
+
+func (b *bench) listItems(ctx context.Context) ([]listedItem, bool) {
+	var items []listedItem
+	_, ok := b.c.do(ctx, request{method: http.MethodGet, route: "/items", path: "/items"}, &items)
+	return items, ok
+}
+
+// search looks for a word of a known item name and checks that every result
+// is on sale and contains the word.
+func (b *bench) search(ctx context.Context, rnd *rand.Rand) {
+	b.mu.Lock()
+	keyword := b.keywords[rnd.Intn(len(b.keywords))]
+	b.mu.Unlock()
+
+	var results []itemDetail
+	if _, ok := b.c.do(ctx, request{method: http.MethodGet, route: "/search", path: "/search?name=" + url.QueryEscape(keyword)}, &results); !ok {
+		return
+	}
+	lower := strings.ToLower(keyword)
+	for _, item := range results {
+		if !strings.Contains(strings.ToLower(item.Name), lower) && !strings.Contains(strings.ToLower(item.Description), lower) {
+			b.c.fail("GET /search?name=%s: item %d %q does not contain the keyword", keyword, item.ID, item.Name)
+		}
+		if item.Status != statusOnSale {
+			b.c.fail("GET /search?name=%s: item %d is not on sale", keyword, item.ID)
+		}
+	}
+}
+
+// sell lists a new item and checks that it shows up among the user's items.
+func (b *bench) sell(ctx context.Context, rnd *rand.Rand, u user) {
+	b.mu.Lock()
+	b.itemSeq++
+	name := fmt.Sprintf("bench item %d", b.itemSeq)
+	b.mu.Unlock()
+	cat := b.categories[rnd.Intn(len(b.categories))]
+
+	var added struct {
+		ID int64 `json:"id"`
+	}
+	if _, ok := b.c.do(ctx, request{
+		method: http.MethodPost, route: "/items", path: "/items", token: u.Token,
+		form: map[string]string{
+			"name":        name,
+			"category_id": strconv.FormatInt(cat.ID, 10),
+			"price":       strconv.Itoa(100 + rnd.Intn(50)*100),
+			"description": "listed by " + u.Name,
+		},
+		image: b.image,
+	}, &added); !ok {
+		return
+	}
+	if _, ok := b.c.do(ctx, request{
+		method: http.MethodPost, route: "/sell", path: "/sell", token: u.Token,
+		json: map[string]int64{"item_id": added.ID},
+	}, nil); !ok {
+		return
+	}
+
+	var items []listedItem
+	if _, ok := b.c.do(ctx, request{method: http.MethodGet, route: "/users/:userID/items", path: userItemsPath(u.ID), token: u.Token}, &items); !ok {
+		return
+	}
+	for _, item := range items {
+		if item.ID == added.ID {
+			return
+		}
+	}
+	b.c.fail("GET /users/%d/items: item %d is missing", u.ID, added.ID)
+}
+
+// purchase buys an item of another user. The purchase is sent several times at
+// once, and exactly one of them must succeed.
+func (b *bench) purchase(ctx context.Context, rnd *rand.Rand, u user) {
+	items, ok := b.listItems(ctx)
+	if !ok || len(items) == 0 {
+		return
+	}
+	listed := items[rnd.Intn(len(items))]
+
+	var item itemDetail
+	if _, ok := b.c.do(ctx, request{method: http.MethodGet, route: "/items/:itemID", path: itemPath(listed.ID, "")}, &item); !ok {
+		return
+	}
+	if item.UserID == u.ID || item.Status != statusOnSale {
+		return
+	}
+
+	var wg sync.WaitGroup
+	statuses := make([]int, purchaseAttempts)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _ = b.c.do(context.Background(), request{
+				method: http.MethodPost, route: "/purchase/:itemID", path: "/purchase/" + strconv.FormatInt(item.ID, 10),
+				token: u.Token, accept: []int{http.StatusOK, http.StatusPreconditionFailed},
+			}, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusPreconditionFailed:
+		default:
+			// The purchase may or may not have happened.
+			b.markUncertain(u.ID)
+		}
+	}
+	if succeeded == 0 {
+		return
+	}
+	if succeeded > 1 {
+		b.c.fail("POST /purchase/%d: succeeded %d times", item.ID, succeeded)
+	}
+
+	b.mu.Lock()
+	if prev, ok := b.sold[item.ID]; ok {
+		b.c.fail("POST /purchase/%d: bought by user %d after user %d", item.ID, u.ID, prev)
+	}
+	b.sold[item.ID] = u.ID
+	for i := 0; i < succeeded; i++ {
+		b.accounts[u.ID].spent += item.Price
+	}
+	b.mu.Unlock()
+
+	var balance struct {
+		Balance int64 `json:"balance"`
+	}
+	if _, ok := b.c.do(ctx, request{method: http.MethodGet, route: "/balance", path: "/balance", token: u.Token}, &balance); ok && balance.Balance < 0 {
+		b.c.fail("GET /balance: user %d has a negative balance %d", u.ID, balance.Balance)
+	}
+}
+
+func (b *bench) markUncertain(ids ...int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, id := range ids {
+		if a, ok := b.accounts[id]; ok {
+			a.uncertain = true
+		}
+	}
+}
+
+func (b *bench) addKeywords(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	const maxKeywords = 200
+	for _, w := range strings.Fields(name) {
+		if len(b.keywords) < maxKeywords && len(w) > 2 {
+			b.keywords = append(b.keywords, w)
+		}
+	}
+}
+
+// verifyState checks the invariants once the workers have stopped: every sold
+// item is no longer on sale, and the balance of every user of the bench is
+// what its deposits and purchases add up to, both in the users table
+// and in the ledger.
+func (b *bench) verifyState(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fail := b.c.scorer.fail
+	for id := range b.sold {
+		var item itemDetail
+		if _, ok := b.verify.do(ctx, request{method: http.MethodGet, route: "/items/:itemID", path: itemPath(id, "")}, &item); !ok {
+			fail("verify: failed to get sold item %d", id)
+			continue
+		}
+		if item.Status == statusOnSale {
+			fail("verify: sold item %d is still on sale", id)
+		}
+	}
+
+	for id, a := range b.accounts {
+		u := b.users[id]
+		var balance struct {
+			Balance int64 `json:"balance"`
+		}
+		if _, ok := b.verify.do(ctx, request{method: http.MethodGet, route: "/balance", path: "/balance", token: u.Token}, &balance); !ok {
+			fail("verify: failed to get the balance of user %d", id)
+			continue
+		}
+		if balance.Balance < 0 {
+			fail("verify: user %d has a negative balance %d", id, balance.Balance)
+		}
+		if !a.uncertain && balance.Balance != a.balance() {
+			fail("verify: user %d has %d yen, want %d", id, balance.Balance, a.balance())
+		}
+
+		var history struct {
+			Balance int64 `json:"balance"`
+		}
+		if _, ok := b.verify.do(ctx, request{method: http.MethodGet, route: "/balance/history", path: "/balance/history", token: u.Token}, &history); !ok {
+			fail("verify: failed to get the balance history of user %d", id)
+			continue
+		}
+		if history.Balance != balance.Balance {
+			fail("verify: ledger balance of user %d is %d, balance is %d", id, history.Balance, balance.Balance)
+		}
+	}
+}
+
+// benchImage is the PNG uploaded with every listed item.
+func benchImage() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Scoring rules of the hackathon benchmark, see the README.
+const (
+	getPoints         = 1
+	postPoints        = 3
+	searchPoints      = 5
+	validationPenalty = -10
+
+	// requestDeadline is the latency under which a successful request scores.
+	requestDeadline = time.Second
+	// mismatchPenalty shortens the run for every response whose status code
+	// differs from the expected 200.
+	mismatchPenalty = 300 * time.Millisecond
+
+	maxTimeouts         = 10
+	maxInvalidResponses = 100
+)
+
+// result is the outcome of one scored request.
+type result struct {
+	// endpoint is the method and the route pattern, e.g. "GET /items/:itemID".
+	endpoint string
+	method   string
+	status   int
+	// accept lists the status codes that are a correct response. A status
+	// other than 200 is correct but does not score.
+	accept  []int
+	latency time.Duration
+	err     error
+}
+
+type endpointStats struct {
+	requests  int
+	ok        int
+	slow      int
+	failed    int
+	points    int
+	latencies []time.Duration
+}
+
+// scorer aggregates the results of every worker.
+type scorer struct {
+	mu                 sync.Mutex
+	endpoints          map[string]*endpointStats
+	validationFailures []string
+	mismatches         int
+	timeouts           int
+	invalid            int
+}
+
+func newScorer() *scorer {
+	return &scorer{endpoints: make(map[string]*endpointStats)}
+}
+
+func (s *scorer) record(r result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.endpoints[r.endpoint]
+	if !ok {
+		st = &endpointStats{}
+		s.endpoints[r.endpoint] = st
+	}
+	st.requests++
+
+	if r.err != nil {
+		st.failed++
+		if isTimeout(r.err) {
+			s.timeouts++
+		} else {
+			s.invalid++
+		}
+		return
+	}
+	st.latencies = append(st.latencies, r.latency)
+
+	if !accepted(r.status, r.accept) {
+		st.failed++
+		s.invalid++
+		if accepted(200, r.accept) {
+			s.mismatches++
+		}
+		return
+	}
+	if r.status != 200 {
+		return
+	}
+	if r.latency > requestDeadline {
+		st.slow++
+		return
+	}
+	st.ok++
+	st.points += points(r.method, r.endpoint)
+}
+
+// fail records a validation failure.
+func (s *scorer) fail(format string, args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validationFailures = append(s.validationFailures, fmt.Sprintf(format, args...))
+}
+
+func (s *scorer) failures() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.validationFailures)
+}
+
+// penalty is how much the run is shortened by status code mismatches.
+func (s *scorer) penalty() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.mismatches) * mismatchPenalty
+}
+
+// abortReason returns why the benchmark must stop, or an empty string.
+func (s *scorer) abortReason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.timeouts > maxTimeouts:
+		return fmt.Sprintf("more than %d calls timed out", maxTimeouts)
+	case s.invalid > maxInvalidResponses:
+		return "too many invalid responses"
+	}
+	return ""
+}
+
+func (s *scorer) score() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scoreLocked()
+}
+
+func (s *scorer) scoreLocked() int {
+	score := len(s.validationFailures) * validationPenalty
+	for _, st := range s.endpoints {
+		score += st.points
+	}
+	return score
+}
+
+// report prints the score breakdown and the latency percentiles of every
+// endpoint.
+func (s *scorer) report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.endpoints))
+	for name := range s.endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "endpoint\trequests\tok\tslow\tfailed\tpoints\tp50\tp90\tp99\tmax\t")
+	var requests, total int
+	for _, name := range names {
+		st := s.endpoints[name]
+		requests += st.requests
+		total += st.points
+		sort.Slice(st.latencies, func(i, j int) bool { return st.latencies[i] < st.latencies[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t\n", name,
+			st.requests, st.ok, st.slow, st.failed, st.points,
+			formatLatency(percentile(st.latencies, 50)),
+			formatLatency(percentile(st.latencies, 90)),
+			formatLatency(percentile(st.latencies, 99)),
+			formatLatency(percentile(st.latencies, 100)))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "requests:            %d (%.1f req/s)\n", requests, float64(requests)/elapsed.Seconds())
+	fmt.Fprintf(w, "points:              %d\n", total)
+	fmt.Fprintf(w, "validation failures: %d (%d)\n", len(s.validationFailures), len(s.validationFailures)*validationPenalty)
+	fmt.Fprintf(w, "status mismatches:   %d (-%s of run time)\n", s.mismatches, time.Duration(s.mismatches)*mismatchPenalty)
+	fmt.Fprintf(w, "timeouts:            %d\n", s.timeouts)
+	fmt.Fprintf(w, "score:               %d\n", s.scoreLocked())
+
+	const maxListed = 20
+	for i, msg := range s.validationFailures {
+		if i == maxListed {
+			fmt.Fprintf(w, "  ... and %d more\n", len(s.validationFailures)-maxListed)
+			break
+		}
+		if i == 0 {
+			fmt.Fprintln(w, "\nvalidation failures:")
+		}
+		fmt.Fprintf(w, "  %s\n", msg)
+	}
+}
+
+func points(method, endpoint string) int {
+	switch {
+	case endpoint == "GET /search":
+		return searchPoints
+	case method == "POST":
+		return postPoints
+	case method == "GET":
+		return getPoints
+	}
+	return 0
+}
+
+func accepted(status int, accept []int) bool {
+	for _, a := range accept {
+		if status == a {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// percentile returns the p-th percentile of the sorted latencies by the
+// nearest-rank method, or zero if there are none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(100 * time.Microsecond).String()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestScorer(t *testing.T) {
+	ok := []int{http.StatusOK}
+	s := newScorer()
+	for _, r := range []result{
+		{endpoint: "GET /items", method: "GET", status: 200, accept: ok, latency: time.Millisecond},
+		{endpoint: "GET /search", method: "GET", status: 200, accept: ok, latency: time.Millisecond},
+		{endpoint: "POST /sell", method: "POST", status: 200, accept: ok, latency: time.Millisecond},
+		// Too slow to score.
+		{endpoint: "POST /sell", method: "POST", status: 200, accept: ok, latency: 2 * time.Second},
+		// Correct, but not a success.
+		{endpoint: "POST /purchase/:itemID", method: "POST", status: 412, accept: []int{200, 412}, latency: time.Millisecond},
+		{endpoint: "GET /items", method: "GET", status: 500, accept: ok, latency: time.Millisecond},
+		{endpoint: "GET /items", method: "GET", err: context.DeadlineExceeded},
+	} {
+		s.record(r)
+	}
+	s.fail("double credit")
+
+	if got, want := s.score(), 1+5+3-10; got != want {
+		t.Errorf("score = %d, want %d", got, want)
+	}
+	if got, want := s.penalty(), mismatchPenalty; got != want {
+		t.Errorf("penalty = %s, want %s", got, want)
+	}
+	if s.timeouts != 1 || s.invalid != 1 {
+		t.Errorf("timeouts, invalid = %d, %d, want 1, 1", s.timeouts, s.invalid)
+	}
+	if st := s.endpoints["POST /sell"]; st.ok != 1 || st.slow != 1 {
+		t.Errorf("POST /sell ok, slow = %d, %d, want 1, 1", st.ok, st.slow)
+	}
+
+	for i := 0; i <= maxTimeouts; i++ {
+		s.record(result{endpoint: "GET /items", method: "GET", err: errors.New("connection refused")})
+	}
+	if s.abortReason() != "" {
+		t.Errorf("aborted on errors that are not timeouts")
+	}
+	for i := 0; i < maxTimeouts; i++ {
+		s.record(result{endpoint: "GET /items", method: "GET", err: context.DeadlineExceeded})
+	}
+	if s.abortReason() == "" {
+		t.Errorf("not aborted after %d timeouts", s.timeouts)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	} {
+		if got := percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no latencies = %s, want 0", got)
+	}
+}
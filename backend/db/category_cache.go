@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// CachedItemRepository is an ItemRepository that keeps every category in
+// memory. Categories are only ever added: AddCategory invalidates the cache,
+// and GetCategory asks the repository about IDs it does not know and caches
+// what it finds, so that categories added by other processes are found too. Call
+// InvalidateCategories after changing categories in any other way, e.g. with
+// Initialize.
+type CachedItemRepository struct {
+	ItemRepository
+
+	mu sync.RWMutex
+	// categories is nil until loaded.
+	categories []domain.Category
+	byID       map[int64]domain.Category
+	// generation counts the invalidations, so that a load racing with one
+	// does not cache what it read before.
+	generation uint64
+}
+
+func NewCachedItemRepository(repo ItemRepository) *CachedItemRepository {
+	return &CachedItemRepository{ItemRepository: repo}
+}
+
+// InvalidateCategories drops the cached categories, so that they are loaded
+// again on the next use.
+func (r *CachedItemRepository) InvalidateCategories() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.categories, r.byID = nil, nil
+	r.generation++
+}
+
+func (r *CachedItemRepository) AddCategory(ctx context.Context, category domain.Category) (domain.Category, error) {
+	added, err := r.ItemRepository.AddCategory(ctx, category)
+	if err != nil {
+		return domain.Category{}, err
+	}
+	r.InvalidateCategories()
+	return added, nil
+}
+
+func (r *CachedItemRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
+	if _, err := r.load(ctx); err != nil {
+		return domain.Category{}, err
+	}
+	r.mu.RLock()
+	cat, ok := r.byID[id]
+	r.mu.RUnlock()
+	if ok {
+		return cat, nil
+	}
+
+	cat, err := r.ItemRepository.GetCategory(ctx, id)
+	if err != nil {
+		return domain.Category{}, err
+	}
+	r.add(cat)
+	return cat, nil
+}
+
+// GetCategories serves the unpaginated list from the cache. Pages are passed
+// to the repository, whose cursors the cache does not know.
+func (r *CachedItemRepository) GetCategories(ctx context.Context, page Page) ([]domain.Category, string, error) {
+	if page.Limit > 0 || page.Cursor != "" {
+		return r.ItemRepository.GetCategories(ctx, page)
+	}
+	cats, err := r.load(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return append([]domain.Category(nil), cats...), "", nil
+}
+
+// load returns the cached categories, loading them if needed.
+func (r *CachedItemRepository) load(ctx context.Context) ([]domain.Category, error) {
+	r.mu.RLock()
+	cats, generation := r.categories, r.generation
+	r.mu.RUnlock()
+	if cats != nil {
+		return cats, nil
+	}
+
+	cats, _, err := r.ItemRepository.GetCategories(ctx, Page{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load categories")
+	}
+	if cats == nil {
+		cats = []domain.Category{}
+	}
+	byID := make(map[int64]domain.Category, len(cats))
+	for _, cat := range cats {
+		byID[cat.ID] = cat
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation == generation {
+		r.categories, r.byID = cats, byID
+	}
+	return cats, nil
+}
+
+// add caches a category that was added around the cache, e.g. by another
+// process, keeping the categories ordered by ID. The slice is copied, since
+// callers of load may still hold the old one.
+func (r *CachedItemRepository) add(cat domain.Category) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byID == nil {
+		return
+	}
+	if _, ok := r.byID[cat.ID]; ok {
+		return
+	}
+	i := sort.Search(len(r.categories), func(i int) bool { return r.categories[i].ID > cat.ID })
+	cats := make([]domain.Category, 0, len(r.categories)+1)
+	cats = append(cats, r.categories[:i]...)
+	cats = append(cats, cat)
+	r.categories = append(cats, r.categories[i:]...)
+	r.byID[cat.ID] = cat
+}
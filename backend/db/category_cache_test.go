@@ -0,0 +1,90 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// countingItemRepository counts the category queries that reach the
+// repository.
+type countingItemRepository struct {
+	db.ItemRepository
+	queries int
+}
+
+func (r *countingItemRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
+	r.queries++
+	return r.ItemRepository.GetCategory(ctx, id)
+}
+
+func (r *countingItemRepository) GetCategories(ctx context.Context, page db.Page) ([]domain.Category, string, error) {
+	r.queries++
+	return r.ItemRepository.GetCategories(ctx, page)
+}
+
+func TestCachedItemRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingItemRepository{ItemRepository: memory.NewItemRepository(memory.NewStore())}
+	cache := db.NewCachedItemRepository(repo)
+
+	food, err := cache.AddCategory(ctx, domain.Category{Name: "food"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if cat, err := cache.GetCategory(ctx, food.ID); err != nil || cat != food {
+			t.Fatalf("GetCategory = %+v, %v, want %+v", cat, err, food)
+		}
+		if cats, _, err := cache.GetCategories(ctx, db.Page{}); err != nil || len(cats) != 1 {
+			t.Fatalf("GetCategories = %+v, %v", cats, err)
+		}
+	}
+	if repo.queries != 1 {
+		t.Errorf("%d queries, want 1", repo.queries)
+	}
+
+	// Adding a category invalidates the cache.
+	if _, err := cache.AddCategory(ctx, domain.Category{Name: "fashion"}); err != nil {
+		t.Fatal(err)
+	}
+	if cats, _, err := cache.GetCategories(ctx, db.Page{}); err != nil || len(cats) != 2 {
+		t.Errorf("GetCategories after AddCategory = %+v, %v", cats, err)
+	}
+
+	// Categories added around the cache, e.g. by another process, are found.
+	furniture, err := repo.AddCategory(ctx, domain.Category{Name: "furniture"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := repo.queries
+	if cat, err := cache.GetCategory(ctx, furniture.ID); err != nil || cat != furniture {
+		t.Errorf("GetCategory of an uncached category = %+v, %v", cat, err)
+	}
+	if cats, _, err := cache.GetCategories(ctx, db.Page{}); err != nil || len(cats) != 3 || cats[2] != furniture {
+		t.Errorf("GetCategories after finding an uncached category = %+v, %v", cats, err)
+	}
+	// The category found is cached without reloading the others.
+	if cat, err := cache.GetCategory(ctx, furniture.ID); err != nil || cat != furniture {
+		t.Errorf("GetCategory of a found category = %+v, %v", cat, err)
+	}
+	if repo.queries != queries+1 {
+		t.Errorf("%d queries to find an uncached category, want 1", repo.queries-queries)
+	}
+	if _, err := cache.GetCategory(ctx, 100); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetCategory of a missing category: got %v, want db.ErrNotFound", err)
+	}
+
+	// Pages come from the repository.
+	queries = repo.queries
+	if cats, next, err := cache.GetCategories(ctx, db.Page{Limit: 2}); err != nil || len(cats) != 2 || next == "" {
+		t.Errorf("GetCategories(limit 2) = %+v, %q, %v", cats, next, err)
+	}
+	if repo.queries != queries+1 {
+		t.Error("GetCategories of a page did not query the repository")
+	}
+}
@@ -0,0 +1,63 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/dbtest"
+)
+
+// TestConformance runs the conformance suite against every database the
+// repositories support. SQLite always runs in a temporary file; PostgreSQL and
+// MySQL run when TEST_POSTGRES_URL and TEST_MYSQL_URL point at a database
+// whose tables may be dropped, e.g. one started by
+//
+//	docker compose --profile db up -d postgres mysql
+func TestConformance(t *testing.T) {
+	backends := []struct {
+		name string
+		url  string
+	}{
+		{"sqlite", "sqlite://" + filepath.Join(t.TempDir(), "conformance.sqlite3")},
+		{"postgres", os.Getenv("TEST_POSTGRES_URL")},
+		{"mysql", os.Getenv("TEST_MYSQL_URL")},
+	}
+
+	for _, b := range backends {
+		b := b
+		t.Run(b.name, func(t *testing.T) {
+			if b.url == "" {
+				t.Skipf("set TEST_%s_URL to run", strings.ToUpper(b.name))
+			}
+			ctx := context.Background()
+			sqlDB, err := db.Open(ctx, b.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sqlDB.Close()
+
+			dbtest.Run(t, func(t *testing.T) dbtest.Repositories {
+				if err := db.Reset(ctx, sqlDB); err != nil {
+					t.Fatalf("failed to reset schema: %v", err)
+				}
+				if err := db.PrepareSearchIndex(ctx, sqlDB); err != nil {
+					t.Fatalf("failed to prepare search index: %v", err)
+				}
+				return dbtest.Repositories{
+					Users:       db.NewUserRepository(sqlDB),
+					Items:       db.NewItemRepository(sqlDB),
+					Ledger:      db.NewLedgerRepository(sqlDB),
+					Purchase:    db.NewPurchaseService(sqlDB),
+					Orders:      db.NewOrderService(sqlDB),
+					Idempotency: db.NewIdempotencyRepository(sqlDB),
+					Sessions:    db.NewSessionRepository(sqlDB),
+					RateLimits:  db.NewRateLimitRepository(sqlDB),
+				}
+			})
+		})
+	}
+}
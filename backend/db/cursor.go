@@ -0,0 +1,68 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+)
+
+var ErrInvalidCursor = newError(ErrInvalidArgument, "invalid cursor")
+
+// Page selects a page of a list. A zero Limit returns every remaining row.
+// Cursor is the opaque next cursor returned with the previous page, or empty
+// for the first page.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// pageCursor holds the sort key of the last row of a page. Which fields are
+// set depends on the ordering of the list.
+type pageCursor struct {
+	// Time is the timestamp the list is sorted by.
+	Time   string `json:"t,omitempty"`
+	Price  int64  `json:"p,omitempty"`
+	ID     int64  `json:"i,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+func (c pageCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns nil for the first page.
+func decodeCursor(s string) (*pageCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// limitArg is the LIMIT for the query of a page. It fetches one extra row to
+// know whether there is a next page. Not every dialect has a way to say no
+// limit, so an unlimited page uses the largest LIMIT instead.
+func (p Page) limitArg() int64 {
+	if p.Limit <= 0 {
+		return math.MaxInt64
+	}
+	return int64(p.Limit) + 1
+}
+
+// paginate trims the extra row fetched by limitArg and returns the cursor of
+// the next page, or an empty string if rows is the last page.
+func paginate[T any](rows []T, p Page, key func(T) pageCursor) ([]T, string) {
+	if p.Limit <= 0 || len(rows) <= p.Limit {
+		return rows, ""
+	}
+	rows = rows[:p.Limit]
+	return rows, key(rows[len(rows)-1]).encode()
+}
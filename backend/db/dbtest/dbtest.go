@@ -0,0 +1,1008 @@
+// Package dbtest is the conformance suite of the repositories in package db.
+// Every implementation, SQL or in-memory, must pass it.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// Repositories are the implementations under test. They share their storage,
+// like repositories created from the same *sql.DB.
+type Repositories struct {
+	Users       db.UserRepository
+	Items       db.ItemRepository
+	Ledger      db.LedgerRepository
+	Purchase    db.PurchaseService
+	Orders      db.OrderService
+	Idempotency db.IdempotencyRepository
+	Sessions    db.SessionRepository
+	RateLimits  db.RateLimitRepository
+}
+
+var tests = []struct {
+	name string
+	fn   func(t *testing.T, r Repositories)
+}{
+	{"Users", testUsers},
+	{"Categories", testCategories},
+	{"Items", testItems},
+	{"ItemStatus", testItemStatus},
+	{"ItemUpdatedAt", testItemUpdatedAt},
+	{"ItemImages", testItemImages},
+	{"ImageVariants", testImageVariants},
+	{"Search", testSearch},
+	{"Purchase", testPurchase},
+	{"Holds", testHolds},
+	{"Orders", testOrders},
+	{"Idempotency", testIdempotency},
+	{"Sessions", testSessions},
+	{"RateLimits", testRateLimits},
+}
+
+// Run runs every conformance test as a subtest. newRepositories is called
+// before each test and must return repositories with empty storage.
+func Run(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) { tt.fn(t, newRepositories(t)) })
+	}
+}
+
+func addTestUser(t *testing.T, r Repositories, name string, balance int64) int64 {
+	t.Helper()
+	ctx := context.Background()
+	id, err := r.Users.AddUser(ctx, domain.User{Name: name, Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 0 {
+		if err := r.Ledger.Deposit(ctx, id, balance); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func addTestItem(t *testing.T, r Repositories, sellerID int64, name string, price int64, status domain.ItemStatus) domain.Item {
+	t.Helper()
+	item, err := r.Items.AddItem(context.Background(), domain.Item{
+		Name:        name,
+		Price:       price,
+		Description: "description of " + name,
+		CategoryID:  1,
+		UserID:      sellerID,
+		Status:      status,
+		Image:       domain.ItemImage{Key: "key-" + name, ContentType: "image/png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func testUsers(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Users
+
+	alice := addTestUser(t, r, "Alice", 0)
+	bob := addTestUser(t, r, "Bob", 0)
+	if alice == 0 || alice == bob {
+		t.Fatalf("AddUser returned ids %d and %d", alice, bob)
+	}
+
+	if err := r.Ledger.Deposit(ctx, bob, 300); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.GetUser(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != bob || user.Name != "Bob" || user.Password != "hash" || user.Balance != 300 {
+		t.Errorf("GetUser = %+v", user)
+	}
+
+	if _, err := repo.GetUser(ctx, bob+100); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetUser of a missing user: got %v, want db.ErrNotFound", err)
+	}
+
+	// Login names and emails
+	carol, err := repo.AddUser(ctx, domain.User{Name: "Carol", Password: "hash", LoginName: "carol", Email: "carol@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AddUser(ctx, domain.User{Name: "Dave", Password: "hash", LoginName: "dave"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		user domain.User
+		want error
+	}{
+		{domain.User{Name: "Carol", LoginName: "carol"}, db.ErrLoginNameTaken},
+		{domain.User{Name: "Carol", LoginName: "carol2", Email: "carol@example.com"}, db.ErrEmailTaken},
+		{domain.User{Name: "Carol", LoginName: "carol", Email: "carol@example.com"}, db.ErrEmailTaken},
+		{domain.User{Name: "Dave", LoginName: "dave", Email: "dave@example.com"}, db.ErrLoginNameTaken},
+	} {
+		if _, err := repo.AddUser(ctx, tt.user); !errors.Is(err, tt.want) || !errors.Is(err, db.ErrConflict) {
+			t.Errorf("AddUser(%+v) = %v, want %v", tt.user, err, tt.want)
+		}
+	}
+
+	user, err = repo.GetUserByLoginName(ctx, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != carol || user.LoginName != "carol" || user.Email != "carol@example.com" {
+		t.Errorf("GetUserByLoginName = %+v", user)
+	}
+	if user, err := repo.GetUserByEmail(ctx, "carol@example.com"); err != nil || user.ID != carol {
+		t.Errorf("GetUserByEmail = %+v, %v", user, err)
+	}
+	if _, err := repo.GetUserByLoginName(ctx, "nobody"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetUserByLoginName of a missing user: got %v, want db.ErrNotFound", err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "nobody@example.com"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetUserByEmail of a missing user: got %v, want db.ErrNotFound", err)
+	}
+	// Users without a login name or email do not conflict.
+	if user, err := repo.GetUser(ctx, alice); err != nil || user.LoginName != "" || user.Email != "" {
+		t.Errorf("GetUser of a user without login name = %+v, %v", user, err)
+	}
+}
+
+func testCategories(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Items
+
+	var want []domain.Category
+	for _, name := range []string{"food", "fashion", "furniture"} {
+		cat, err := repo.AddCategory(ctx, domain.Category{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, cat)
+	}
+
+	cat, err := repo.GetCategory(ctx, want[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cat != want[1] {
+		t.Errorf("GetCategory = %+v, want %+v", cat, want[1])
+	}
+
+	var got []domain.Category
+	page := db.Page{Limit: 2}
+	for {
+		cats, next, err := repo.GetCategories(ctx, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, cats...)
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetCategories returned %d categories, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("category %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func testItems(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Items
+	seller := addTestUser(t, r, "Alice", 0)
+	other := addTestUser(t, r, "Bob", 0)
+
+	var ids []int64
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		ids = append(ids, addTestItem(t, r, seller, name, 100, domain.ItemStatusOnSale).ID)
+	}
+	addTestItem(t, r, other, "f", 100, domain.ItemStatusInitial)
+
+	item, err := repo.GetItem(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "a" || item.Price != 100 || item.UserID != seller || item.Status != domain.ItemStatusOnSale {
+		t.Errorf("GetItem = %+v", item)
+	}
+	if item.Image.Key != "key-a" || item.Image.ContentType != "image/png" {
+		t.Errorf("GetItem image = %+v", item.Image)
+	}
+	if since := time.Since(item.CreatedAt); since < -time.Second || since > time.Minute || item.CreatedAt.Location() != time.UTC || !item.UpdatedAt.Equal(item.CreatedAt) {
+		t.Errorf("GetItem timestamps = %v, %v, want now in UTC", item.CreatedAt, item.UpdatedAt)
+	}
+	if _, err := repo.GetItem(ctx, ids[len(ids)-1]+100); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetItem of a missing item: got %v, want db.ErrNotFound", err)
+	}
+
+	// Items added in the same second are ordered by id, newest first.
+	var got []int64
+	page := db.Page{Limit: 2}
+	for {
+		items, next, err := repo.GetItemsByUserID(ctx, seller, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			got = append(got, item.ID)
+		}
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+	if len(got) != len(ids) {
+		t.Fatalf("GetItemsByUserID returned %v, want %d items", got, len(ids))
+	}
+	for i, id := range got {
+		if want := ids[len(ids)-1-i]; id != want {
+			t.Errorf("item %d = %d, want %d", i, id, want)
+		}
+	}
+
+	onSale, _, err := repo.GetOnSaleItems(ctx, db.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onSale) != len(ids) {
+		t.Errorf("GetOnSaleItems returned %d items, want %d", len(onSale), len(ids))
+	}
+
+	if _, _, err := repo.GetOnSaleItems(ctx, db.Page{Limit: 1, Cursor: "!"}); err != db.ErrInvalidCursor {
+		t.Errorf("GetOnSaleItems with an invalid cursor: got %v, want ErrInvalidCursor", err)
+	}
+
+	// Lists carry the name of the category, and keep items whose category
+	// does not exist.
+	food, err := repo.AddCategory(ctx, domain.Category{Name: "food"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol := addTestUser(t, r, "Carol", 0)
+	for _, categoryID := range []int64{food.ID + 100, food.ID} {
+		if _, err := repo.AddItem(ctx, domain.Item{Name: "g", Price: 100, CategoryID: categoryID, UserID: carol, Status: domain.ItemStatusInitial}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, _, err := repo.GetItemsByUserID(ctx, carol, db.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].CategoryName != "food" || items[1].CategoryName != "" || items[1].CategoryID != food.ID+100 {
+		t.Errorf("GetItemsByUserID = %+v, want items of food and of a missing category", items)
+	}
+}
+
+func testItemStatus(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Items
+	item := addTestItem(t, r, addTestUser(t, r, "Alice", 0), "a", 100, domain.ItemStatusInitial)
+
+	if err := repo.UpdateItemStatus(ctx, item.ID, domain.ItemStatusOnSale); err != nil {
+		t.Fatal(err)
+	}
+	err := repo.UpdateItemStatus(ctx, item.ID, domain.ItemStatusInitial)
+	if !errors.Is(err, domain.ErrInvalidStatusTransition) {
+		t.Errorf("invalid transition: got %v, want ErrInvalidStatusTransition", err)
+	}
+
+	history, err := repo.GetItemStatusHistory(ctx, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].FromStatus != domain.ItemStatusInitial || history[0].ToStatus != domain.ItemStatusOnSale {
+		t.Errorf("GetItemStatusHistory = %+v", history)
+	}
+}
+
+// testItemUpdatedAt checks that every change to an item or its images bumps
+// its updated_at, and that the items of a user are still sorted by created_at.
+func testItemUpdatedAt(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Items
+	seller := addTestUser(t, r, "Alice", 0)
+	item := addTestItem(t, r, seller, "a", 100, domain.ItemStatusInitial)
+	newer := addTestItem(t, r, seller, "c", 100, domain.ItemStatusInitial)
+
+	for _, change := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"UpdateItem", func() error {
+			item.Name = "b"
+			return repo.UpdateItem(ctx, item)
+		}},
+		{"UpdateItemStatus", func() error { return repo.UpdateItemStatus(ctx, item.ID, domain.ItemStatusOnSale) }},
+		{"UpdateItemImage", func() error {
+			return repo.UpdateItemImage(ctx, item.ID, domain.ItemImage{Key: "key-b", ContentType: "image/png"})
+		}},
+		{"AddItemImage", func() error {
+			_, err := repo.AddItemImage(ctx, item.ID, domain.ItemImage{Key: "second", ContentType: "image/png"})
+			return err
+		}},
+	} {
+		before, err := repo.GetItem(ctx, item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Timestamps have a resolution of a second.
+		time.Sleep(time.Second)
+		if err := change.fn(); err != nil {
+			t.Fatalf("%s: %v", change.name, err)
+		}
+		after, err := repo.GetItem(ctx, item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !after.UpdatedAt.After(before.UpdatedAt) || !after.CreatedAt.Equal(before.CreatedAt) {
+			t.Errorf("%s: timestamps %v, %v, want updated after %v", change.name, after.CreatedAt, after.UpdatedAt, before.UpdatedAt)
+		}
+	}
+
+	items, _, err := repo.GetItemsByUserID(ctx, seller, db.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].ID != newer.ID || items[1].ID != item.ID {
+		t.Errorf("GetItemsByUserID after updating the older item = %+v, want %d first", items, newer.ID)
+	}
+}
+
+func testItemImages(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Items
+	item := addTestItem(t, r, addTestUser(t, r, "Alice", 0), "a", 100, domain.ItemStatusInitial)
+	first, err := repo.GetItemImage(ctx, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := repo.AddItemImage(ctx, item.ID, domain.ItemImage{Key: "second", ContentType: "image/jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := repo.AddItemImage(ctx, item.ID, domain.ItemImage{Key: "third", ContentType: "image/jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Position != 1 || third.Position != 2 {
+		t.Errorf("positions of added images = %d, %d", second.Position, third.Position)
+	}
+	other := addTestItem(t, r, item.UserID, "b", 100, domain.ItemStatusInitial)
+	for i := 1; i < domain.MaxItemImages; i++ {
+		if _, err := repo.AddItemImage(ctx, other.ID, domain.ItemImage{Key: "more", ContentType: "image/jpeg"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.AddItemImage(ctx, other.ID, domain.ItemImage{Key: "more", ContentType: "image/jpeg"}); err != db.ErrTooManyItemImages {
+		t.Errorf("adding too many images: got %v, want ErrTooManyItemImages", err)
+	}
+
+	if err := repo.ReorderItemImages(ctx, item.ID, []int64{third.ID, first.ID}); err != db.ErrInvalidImageOrder {
+		t.Errorf("incomplete order: got %v, want db.ErrInvalidImageOrder", err)
+	}
+	if err := repo.ReorderItemImages(ctx, item.ID, []int64{third.ID, first.ID, second.ID}); err != nil {
+		t.Fatal(err)
+	}
+	primary, err := repo.GetItemImage(ctx, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.ID != third.ID {
+		t.Errorf("primary image after reorder = %d, want %d", primary.ID, third.ID)
+	}
+
+	if err := repo.DeleteItemImage(ctx, item.ID, third.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteItemImage(ctx, item.ID, third.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("deleting a missing image: got %v, want db.ErrNotFound", err)
+	}
+	images, err := repo.GetItemImages(ctx, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images[0].ID != first.ID || images[0].Position != 0 || images[1].ID != second.ID || images[1].Position != 1 {
+		t.Errorf("GetItemImages after delete = %+v", images)
+	}
+
+	if err := repo.DeleteItemImage(ctx, item.ID, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteItemImage(ctx, item.ID, second.ID); err != db.ErrOnlyItemImage {
+		t.Errorf("deleting the only image: got %v, want db.ErrOnlyItemImage", err)
+	}
+}
+
+func testImageVariants(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Items
+
+	variant := domain.ImageVariant{ImageKey: "image", Size: domain.ImageSizeThumb, Key: "thumb", ContentType: "image/jpeg", Width: 200, Height: 100}
+	if err := repo.AddImageVariants(ctx, []domain.ImageVariant{variant}); err != nil {
+		t.Fatal(err)
+	}
+	// Existing variants are kept.
+	changed := variant
+	changed.Key = "other"
+	if err := repo.AddImageVariants(ctx, []domain.ImageVariant{changed}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetImageVariant(ctx, "image", domain.ImageSizeThumb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != variant {
+		t.Errorf("GetImageVariant = %+v, want %+v", got, variant)
+	}
+	if _, err := repo.GetImageVariant(ctx, "image", domain.ImageSizeMedium); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetImageVariant of a missing size: got %v, want db.ErrNotFound", err)
+	}
+}
+
+func testSearch(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Items
+	seller := addTestUser(t, r, "Alice", 0)
+	tomato := addTestItem(t, r, seller, "Tomato", 200, domain.ItemStatusOnSale)
+	addTestItem(t, r, seller, "Tomato juice", 300, domain.ItemStatusInitial)
+	addTestItem(t, r, seller, "100% juice", 400, domain.ItemStatusOnSale)
+	addTestItem(t, r, seller, "Onion", 100, domain.ItemStatusOnSale)
+
+	tests := []struct {
+		keyword string
+		want    []string
+	}{
+		{"TOMATO", []string{"Tomato"}},
+		{"to", []string{"Tomato"}},
+		{"0%", []string{"100% juice"}},
+		{"_", nil},
+	}
+	for _, tt := range tests {
+		items, _, err := repo.SearchItems(ctx, db.ItemSearchParams{
+			Keyword:  tt.keyword,
+			Statuses: []domain.ItemStatus{domain.ItemStatusOnSale},
+			Sort:     db.ItemSearchSortRelevance,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("SearchItems(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+
+	items, _, err := repo.SearchItems(ctx, db.ItemSearchParams{
+		Keyword:  "juice",
+		Statuses: []domain.ItemStatus{domain.ItemStatusOnSale, domain.ItemStatusInitial},
+		MaxPrice: 300,
+		Sort:     db.ItemSearchSortPriceAsc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != tomato.ID+1 {
+		t.Errorf("SearchItems with filters = %+v", items)
+	}
+
+	// Paging through the results returns them in the same order as one page.
+	for _, sort := range []db.ItemSearchSort{db.ItemSearchSortRelevance, db.ItemSearchSortNewest, db.ItemSearchSortPriceAsc, db.ItemSearchSortPriceDesc} {
+		params := db.ItemSearchParams{Keyword: "o", Sort: sort}
+		all, _, err := repo.SearchItems(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paged []domain.Item
+		params.Page.Limit = 1
+		for {
+			items, next, err := repo.SearchItems(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, items...)
+			if next == "" {
+				break
+			}
+			params.Page.Cursor = next
+		}
+		if len(all) != 4 || len(paged) != len(all) {
+			t.Fatalf("SearchItems sorted by %s returned %d items, %d when paged", sort, len(all), len(paged))
+		}
+		for i := range all {
+			if paged[i].ID != all[i].ID {
+				t.Errorf("SearchItems sorted by %s: item %d is %d when paged, want %d", sort, i, paged[i].ID, all[i].ID)
+			}
+		}
+	}
+}
+
+func testPurchase(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	users, ledger, service := r.Users, r.Ledger, r.Purchase
+	now := time.Now()
+
+	seller := addTestUser(t, r, "Alice", 0)
+	buyer := addTestUser(t, r, "Bob", 1000)
+	cheap := addTestItem(t, r, seller, "cheap", 600, domain.ItemStatusOnSale)
+	expensive := addTestItem(t, r, seller, "expensive", 2000, domain.ItemStatusOnSale)
+
+	if err := service.Purchase(ctx, seller, cheap.ID, now); err != db.ErrPurchaseOwnItem {
+		t.Errorf("purchasing own item: got %v, want db.ErrPurchaseOwnItem", err)
+	}
+	if err := service.Purchase(ctx, buyer, expensive.ID, now); err != db.ErrInsufficientBalance {
+		t.Errorf("purchasing without balance: got %v, want db.ErrInsufficientBalance", err)
+	}
+	if err := service.Purchase(ctx, buyer, cheap.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Purchase(ctx, buyer, cheap.ID, now); err != db.ErrItemNotOnSale {
+		t.Errorf("purchasing twice: got %v, want db.ErrItemNotOnSale", err)
+	}
+	if err := service.Purchase(ctx, buyer, expensive.ID+100, now); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("purchasing a missing item: got %v, want db.ErrNotFound", err)
+	}
+
+	// The seller is paid once the order is completed.
+	for id, want := range map[int64]int64{seller: 0, buyer: 400} {
+		user, err := users.GetUser(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balance, err := ledger.GetLedgerBalance(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Balance != want || balance != want {
+			t.Errorf("balance of user %d = %d (ledger %d), want %d", id, user.Balance, balance, want)
+		}
+	}
+
+	entries, err := ledger.GetEntriesByUserID(ctx, buyer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Kind != domain.LedgerKindPurchase || entries[0].Amount != -600 || entries[0].ItemID != cheap.ID || entries[1].ItemID != 0 {
+		t.Errorf("ledger entries of the buyer = %+v", entries)
+	}
+}
+
+func testHolds(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	users, items, ledger, service := r.Users, r.Items, r.Ledger, r.Purchase
+
+	seller := addTestUser(t, r, "Alice", 0)
+	buyer := addTestUser(t, r, "Bob", 1000)
+	other := addTestUser(t, r, "Carol", 1000)
+	item := addTestItem(t, r, seller, "item", 600, domain.ItemStatusOnSale)
+	expensive := addTestItem(t, r, seller, "expensive", 2000, domain.ItemStatusOnSale)
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	if _, err := service.Reserve(ctx, seller, item.ID, now, expiresAt); err != db.ErrPurchaseOwnItem {
+		t.Errorf("reserving own item: got %v, want db.ErrPurchaseOwnItem", err)
+	}
+	if _, err := service.Reserve(ctx, buyer, expensive.ID, now, expiresAt); err != db.ErrInsufficientBalance {
+		t.Errorf("reserving without balance: got %v, want db.ErrInsufficientBalance", err)
+	}
+	if _, err := service.Reserve(ctx, buyer, expensive.ID+100, now, expiresAt); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("reserving a missing item: got %v, want db.ErrNotFound", err)
+	}
+
+	hold, err := service.Reserve(ctx, buyer, item.ID, now, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hold.ItemID != item.ID || hold.BuyerID != buyer || hold.Amount != 600 || !hold.ExpiresAt.Equal(expiresAt.Truncate(time.Second)) {
+		t.Errorf("Reserve = %+v", hold)
+	}
+	checkBalances := func(when string, want map[int64]int64) {
+		t.Helper()
+		for id, want := range want {
+			user, err := users.GetUser(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			balance, err := ledger.GetLedgerBalance(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Balance != want || balance != want {
+				t.Errorf("%s: balance of user %d = %d (ledger %d), want %d", when, id, user.Balance, balance, want)
+			}
+		}
+		if balance, err := ledger.GetLedgerBalance(ctx, domain.EscrowAccountID); err != nil {
+			t.Fatal(err)
+		} else if want := 1000 + 1000 - want[buyer] - want[other] - want[seller]; balance != want {
+			t.Errorf("%s: escrow balance = %d, want %d", when, balance, want)
+		}
+	}
+	checkStatus := func(when string, id int64, want domain.ItemStatus) {
+		t.Helper()
+		got, err := items.GetItem(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != want {
+			t.Errorf("%s: item status = %s, want %s", when, got.Status, want)
+		}
+	}
+	checkBalances("after reserving", map[int64]int64{seller: 0, buyer: 400, other: 1000})
+	checkStatus("after reserving", item.ID, domain.ItemStatusReserved)
+
+	if _, err := service.Reserve(ctx, other, item.ID, now, expiresAt); err != db.ErrItemReserved {
+		t.Errorf("reserving a reserved item: got %v, want db.ErrItemReserved", err)
+	}
+	if err := service.Purchase(ctx, other, item.ID, now); err != db.ErrItemReserved {
+		t.Errorf("purchasing an item reserved by another buyer: got %v, want db.ErrItemReserved", err)
+	}
+	if n, err := service.ReleaseExpiredHolds(ctx, now); err != nil || n != 0 {
+		t.Errorf("ReleaseExpiredHolds before the expiry = %d, %v, want 0", n, err)
+	}
+	if err := service.Purchase(ctx, buyer, item.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	checkBalances("after purchasing", map[int64]int64{seller: 0, buyer: 400, other: 1000})
+	checkStatus("after purchasing", item.ID, domain.ItemStatusSoldOut)
+
+	// An expired hold is released by ReleaseExpiredHolds, or by the next
+	// purchase if it runs first.
+	second := addTestItem(t, r, seller, "second", 300, domain.ItemStatusOnSale)
+	third := addTestItem(t, r, seller, "third", 100, domain.ItemStatusOnSale)
+	for _, id := range []int64{second.ID, third.ID} {
+		if _, err := service.Reserve(ctx, buyer, id, now, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkBalances("after reserving two more", map[int64]int64{seller: 0, buyer: 0, other: 1000})
+	later := expiresAt.Add(time.Second)
+	if err := service.Purchase(ctx, other, third.ID, later); err != nil {
+		t.Errorf("purchasing an item with an expired hold: %v", err)
+	}
+	if n, err := service.ReleaseExpiredHolds(ctx, later); err != nil || n != 1 {
+		t.Errorf("ReleaseExpiredHolds after the expiry = %d, %v, want 1", n, err)
+	}
+	checkStatus("after the expiry", second.ID, domain.ItemStatusOnSale)
+	checkStatus("after the expiry", third.ID, domain.ItemStatusSoldOut)
+	checkBalances("after the expiry", map[int64]int64{seller: 0, buyer: 400, other: 900})
+
+	entries, err := ledger.GetEntriesByUserID(ctx, buyer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []domain.LedgerKind
+	for _, e := range entries {
+		kinds = append(kinds, e.Kind)
+	}
+	want := []domain.LedgerKind{domain.LedgerKindRelease, domain.LedgerKindRelease, domain.LedgerKindHold, domain.LedgerKindHold, domain.LedgerKindHold, domain.LedgerKindDeposit}
+	if fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("ledger entries of the buyer = %v, want %v", kinds, want)
+	}
+}
+
+func testOrders(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	users, items, service, orders := r.Users, r.Items, r.Purchase, r.Orders
+	now := time.Now()
+
+	seller := addTestUser(t, r, "Alice", 0)
+	buyer := addTestUser(t, r, "Bob", 1000)
+	first := addTestItem(t, r, seller, "first", 600, domain.ItemStatusOnSale)
+	second := addTestItem(t, r, seller, "second", 300, domain.ItemStatusOnSale)
+	if err := service.Purchase(ctx, buyer, first.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Reserve(ctx, buyer, second.ID, now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Purchase(ctx, buyer, second.ID, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int64{seller, buyer} {
+		got, err := orders.GetOrdersByUserID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].ItemID != second.ID || got[1].ItemID != first.ID {
+			t.Fatalf("orders of user %d = %+v", id, got)
+		}
+		o := got[1]
+		if o.BuyerID != buyer || o.SellerID != seller || o.Amount != 600 || o.Status != domain.OrderStatusPaid || o.CreatedAt.IsZero() || !o.ShippedAt.IsZero() || !o.CompletedAt.IsZero() {
+			t.Errorf("order of the first item = %+v", o)
+		}
+	}
+	if got, err := orders.GetOrdersByUserID(ctx, buyer+100); err != nil || len(got) != 0 {
+		t.Errorf("orders of another user = %+v, %v", got, err)
+	}
+
+	if _, err := orders.Ship(ctx, buyer, first.ID, "T1", now); err != db.ErrNotSeller {
+		t.Errorf("shipping as the buyer: got %v, want db.ErrNotSeller", err)
+	}
+	if _, err := orders.Ship(ctx, seller, first.ID+100, "T1", now); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("shipping a missing order: got %v, want db.ErrNotFound", err)
+	}
+	if _, err := orders.Receive(ctx, buyer, first.ID, now); err != db.ErrOrderNotShipped {
+		t.Errorf("receiving before shipping: got %v, want db.ErrOrderNotShipped", err)
+	}
+	shipped, err := orders.Ship(ctx, seller, first.ID, "T1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shipped.Status != domain.OrderStatusShipped || shipped.TrackingNumber != "T1" || !shipped.ShippedAt.Equal(now.Truncate(time.Second)) {
+		t.Errorf("Ship = %+v", shipped)
+	}
+	if _, err := orders.Ship(ctx, seller, first.ID, "T2", now); err != db.ErrOrderNotPaid {
+		t.Errorf("shipping twice: got %v, want db.ErrOrderNotPaid", err)
+	}
+	if _, err := orders.Receive(ctx, seller, first.ID, now); err != db.ErrNotBuyer {
+		t.Errorf("receiving as the seller: got %v, want db.ErrNotBuyer", err)
+	}
+	if _, err := orders.Ship(ctx, seller, second.ID, "T3", now); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSeller := func(when string, want int64) {
+		t.Helper()
+		user, err := users.GetUser(ctx, seller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balance, err := r.Ledger.GetLedgerBalance(ctx, seller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Balance != want || balance != want {
+			t.Errorf("%s: balance of the seller = %d (ledger %d), want %d", when, user.Balance, balance, want)
+		}
+	}
+	checkSeller("after shipping", 0)
+
+	received, err := orders.Receive(ctx, buyer, first.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Status != domain.OrderStatusCompleted || received.TrackingNumber != "T1" || !received.CompletedAt.Equal(now.Truncate(time.Second)) {
+		t.Errorf("Receive = %+v", received)
+	}
+	if _, err := orders.Receive(ctx, buyer, first.ID, now); err != db.ErrOrderNotShipped {
+		t.Errorf("receiving twice: got %v, want db.ErrOrderNotShipped", err)
+	}
+	checkSeller("after receiving", 600)
+	if item, err := items.GetItem(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	} else if item.Status != domain.ItemStatusCompleted {
+		t.Errorf("status of a received item = %s", item.Status)
+	}
+
+	later := now.Add(time.Hour)
+	if n, err := orders.CompleteShippedOrders(ctx, later, now.Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("CompleteShippedOrders before the shipment = %d, %v, want 0", n, err)
+	}
+	if n, err := orders.CompleteShippedOrders(ctx, later, now); err != nil || n != 1 {
+		t.Errorf("CompleteShippedOrders after the shipment = %d, %v, want 1", n, err)
+	}
+	checkSeller("after completing shipped orders", 900)
+	if balance, err := r.Ledger.GetLedgerBalance(ctx, domain.EscrowAccountID); err != nil || balance != 0 {
+		t.Errorf("escrow balance = %d, %v, want 0", balance, err)
+	}
+}
+
+func testIdempotency(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Idempotency
+	locked := time.Now().Add(time.Minute)
+
+	rec, ok, err := repo.Reserve(ctx, 1, "key", "fingerprint", locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("first Reserve returned existing record %+v", rec)
+	}
+	if _, ok, err := repo.Reserve(ctx, 1, "key", "fingerprint", locked); err != nil || ok {
+		t.Errorf("second Reserve = %v, %v, want an existing record", ok, err)
+	}
+	// Keys are per user.
+	if _, ok, err := repo.Reserve(ctx, 2, "key", "fingerprint", locked); err != nil || !ok {
+		t.Errorf("Reserve by another user = %v, %v, want a new record", ok, err)
+	}
+
+	rec.StatusCode, rec.ContentType, rec.Body = 200, "application/json", []byte(`"successful"`)
+	if err := repo.Complete(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := repo.Reserve(ctx, 1, "key", "fingerprint", locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || !got.Completed() || got.StatusCode != 200 || string(got.Body) != `"successful"` || got.Fingerprint != "fingerprint" {
+		t.Errorf("Reserve of a completed key = %+v, %v", got, ok)
+	}
+
+	if err := repo.Release(ctx, 1, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := repo.Reserve(ctx, 1, "key", "other", locked); err != nil || !ok {
+		t.Errorf("Reserve after Release = %v, %v, want a new record", ok, err)
+	}
+
+	// A key still in flight after its lock expired is taken over.
+	if _, ok, err := repo.Reserve(ctx, 3, "key", "fingerprint", time.Now().Add(-time.Minute)); err != nil || !ok {
+		t.Fatalf("Reserve = %v, %v, want a new record", ok, err)
+	}
+	if _, ok, err := repo.Reserve(ctx, 3, "key", "other", locked); err != nil || !ok {
+		t.Errorf("Reserve of a key with an expired lock = %v, %v, want a new record", ok, err)
+	}
+	if got, ok, err := repo.Reserve(ctx, 3, "key", "fingerprint", locked); err != nil || ok || got.Fingerprint != "other" {
+		t.Errorf("Reserve of a taken over key = %+v, %v, %v, want the record of the new request", got, ok, err)
+	}
+}
+
+func testSessions(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.Sessions
+
+	first, err := repo.AddSession(ctx, 1, "hash1", "agent1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 || first.UserID != 1 || first.UserAgent != "agent1" || !first.Active(time.Now()) {
+		t.Errorf("AddSession = %+v", first)
+	}
+	second, err := repo.AddSession(ctx, 1, "hash2", "agent2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AddSession(ctx, 2, "hash3", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetSession(ctx, first.ID)
+	if err != nil || got != first {
+		t.Errorf("GetSession = %+v, %v, want %+v", got, err, first)
+	}
+	if _, err := repo.GetSession(ctx, 9999); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetSession of a missing session = %v, want db.ErrNotFound", err)
+	}
+
+	rotated, err := repo.RotateRefreshToken(ctx, "hash1", "hash1b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ID != first.ID || rotated.RefreshTokenHash != "hash1b" {
+		t.Errorf("RotateRefreshToken = %+v", rotated)
+	}
+	// A refresh token is accepted only once.
+	if _, err := repo.RotateRefreshToken(ctx, "hash1", "hash1c"); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("RotateRefreshToken of a used token = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	sessions, err := repo.GetActiveSessionsByUserID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("GetActiveSessionsByUserID = %+v, want 2 sessions", sessions)
+	}
+
+	if err := repo.RevokeSession(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RevokeSession(ctx, second.ID); err != nil {
+		t.Errorf("RevokeSession of a revoked session = %v", err)
+	}
+	if err := repo.RevokeSession(ctx, 9999); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("RevokeSession of a missing session = %v, want db.ErrNotFound", err)
+	}
+	revoked, err := repo.GetSession(ctx, second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.RevokedAt == "" || revoked.Active(time.Now()) {
+		t.Errorf("revoked session = %+v, want inactive", revoked)
+	}
+	if _, err := repo.RotateRefreshToken(ctx, "hash2", "hash2b"); !errors.Is(err, db.ErrInvalidRefreshToken) {
+		t.Errorf("RotateRefreshToken of a revoked session = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	sessions, err = repo.GetActiveSessionsByUserID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != first.ID {
+		t.Errorf("GetActiveSessionsByUserID after revoking = %+v, want only session %d", sessions, first.ID)
+	}
+}
+
+func testRateLimits(t *testing.T, r Repositories) {
+	ctx := context.Background()
+	repo := r.RateLimits
+	start := time.UnixMilli(time.Now().UnixMilli())
+
+	hit := func(key string, at time.Duration) time.Duration {
+		t.Helper()
+		retryAfter, err := repo.AddHit(ctx, key, start.Add(at), time.Minute, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return retryAfter
+	}
+	if hit("ip", 0) != 0 || hit("ip", 10*time.Second) != 0 {
+		t.Error("AddHit refused a hit within the limit")
+	}
+	if got := hit("ip", 20*time.Second); got != 40*time.Second {
+		t.Errorf("AddHit over the limit = %s, want 40s until the first hit leaves the window", got)
+	}
+	// Keys are limited separately.
+	if got := hit("other", 20*time.Second); got != 0 {
+		t.Errorf("AddHit on another key = %s, want 0", got)
+	}
+	// Refused hits are not recorded, so the window slides past the first hit.
+	if got := hit("ip", time.Minute+time.Second); got != 0 {
+		t.Errorf("AddHit after the first hit left the window = %s, want 0", got)
+	}
+	if got := hit("ip", time.Minute+2*time.Second); got != 8*time.Second {
+		t.Errorf("AddHit over the limit again = %s, want 8s", got)
+	}
+	if _, err := repo.AddHit(ctx, "ip", start, db.MaxRateLimitWindow+time.Second, 1); err == nil {
+		t.Error("AddHit with a window longer than MaxRateLimitWindow succeeded")
+	}
+
+	policy := domain.LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 3 * time.Minute}
+	if l, err := repo.GetLockout(ctx, "user", start); err != nil || l.Failures != 0 {
+		t.Errorf("GetLockout without failures = %+v, %v", l, err)
+	}
+	var l domain.Lockout
+	for i, want := range []time.Duration{0, 0, time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		now := start.Add(time.Duration(i) * time.Second)
+		var err error
+		if l, err = repo.AddFailure(ctx, "user", now, policy); err != nil {
+			t.Fatal(err)
+		}
+		if l.Failures != i+1 || l.RetryAfter(now) != want {
+			t.Errorf("failure %d: lockout = %+v, want locked for %s", i+1, l, want)
+		}
+	}
+	got, err := repo.GetLockout(ctx, "user", start.Add(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Failures != 5 || !got.LockedUntil.Equal(l.LockedUntil) || !got.LastFailureAt.Equal(l.LastFailureAt) {
+		t.Errorf("GetLockout = %+v, want %+v", got, l)
+	}
+	// Failures are forgotten after LoginFailureTTL.
+	later := start.Add(db.LoginFailureTTL + time.Hour)
+	if got, err := repo.GetLockout(ctx, "user", later); err != nil || got.Failures != 0 {
+		t.Errorf("GetLockout after LoginFailureTTL = %+v, %v", got, err)
+	}
+	if got, err := repo.AddFailure(ctx, "user", later, policy); err != nil || got.Failures != 1 || got.RetryAfter(later) != 0 {
+		t.Errorf("AddFailure after LoginFailureTTL = %+v, %v", got, err)
+	}
+
+	if err := repo.ResetFailures(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.GetLockout(ctx, "user", later); err != nil || got.Failures != 0 {
+		t.Errorf("GetLockout after ResetFailures = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// dialect is the SQL flavor of a database. Queries are written for SQLite
+// with ? placeholders and rewritten by dbConn and dbTx where the others differ.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+	dialectMySQL
+)
+
+func (d dialect) String() string {
+	switch d {
+	case dialectPostgres:
+		return "postgres"
+	case dialectMySQL:
+		return "mysql"
+	default:
+		return "sqlite"
+	}
+}
+
+func dialectOf(db *sql.DB) dialect {
+	switch db.Driver().(type) {
+	case *pq.Driver:
+		return dialectPostgres
+	case *mysql.MySQLDriver:
+		return dialectMySQL
+	default:
+		return dialectSQLite
+	}
+}
+
+// rebind replaces the ? placeholders of the query with $1, $2, ... for
+// PostgreSQL. Question marks in string literals are kept.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n, quoted := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// insertOrIgnore turns an INSERT INTO statement into one that skips rows
+// conflicting with a unique key.
+func (d dialect) insertOrIgnore(query string) string {
+	switch d {
+	case dialectPostgres:
+		return query + " ON CONFLICT DO NOTHING"
+	case dialectMySQL:
+		return strings.Replace(query, "INSERT INTO", "INSERT IGNORE INTO", 1)
+	default:
+		return strings.Replace(query, "INSERT INTO", "INSERT OR IGNORE INTO", 1)
+	}
+}
+
+// forUpdate is the locking clause of a SELECT whose rows are updated later in
+// the transaction. SQLite locks the whole database when the transaction
+// begins instead.
+func (d dialect) forUpdate() string {
+	if d == dialectSQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// like is the case-insensitive LIKE operator.
+func (d dialect) like() string {
+	if d == dialectPostgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// isUniqueViolation reports whether err is the error of every driver for a
+// statement that would duplicate a unique key.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	var pqErr *pq.Error
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	case errors.As(err, &pqErr):
+		return pqErr.Code == "23505"
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1062
+	}
+	return false
+}
+
+// dbConn is a *sql.DB that runs queries written with ? placeholders on every
+// dialect.
+type dbConn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func newConn(db *sql.DB) *dbConn {
+	return &dbConn{DB: db, dialect: dialectOf(db)}
+}
+
+func (c *dbConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *dbConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *dbConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *dbConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dbTx, error) {
+	tx, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{Tx: tx, dialect: c.dialect}, nil
+}
+
+// insert runs an INSERT statement and returns the id of the inserted row.
+func (c *dbConn) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return insertID(ctx, c, c.dialect, query, args...)
+}
+
+// dbTx is the *sql.Tx of a dbConn.
+type dbTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *dbTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+func (tx *dbTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+func (tx *dbTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+func (tx *dbTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return tx.Tx.PrepareContext(ctx, tx.dialect.rebind(query))
+}
+
+func (tx *dbTx) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return insertID(ctx, tx, tx.dialect, query, args...)
+}
+
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertID returns the id of the row inserted by query. The PostgreSQL driver
+// does not support LastInsertId, so the id is returned by the query instead.
+func insertID(ctx context.Context, q queryer, d dialect, query string, args ...interface{}) (int64, error) {
+	var id int64
+	if d == dialectPostgres {
+		err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
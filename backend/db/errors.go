@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// The kinds of repository errors. Repositories return errors that wrap one
+// of them, so callers test the kind with errors.Is and keep the message of
+// the error itself, e.g. "item not found".
+var (
+	// ErrNotFound is wrapped by the errors of rows that do not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is wrapped by the errors of rows that clash with existing
+	// ones, e.g. a login name that is already taken.
+	ErrConflict = errors.New("conflict")
+	// ErrPreconditionFailed is wrapped by the errors of changes that the
+	// current state of a row does not allow, e.g. buying a sold out item.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrInvalidArgument is wrapped by the errors of arguments that are
+	// malformed whatever the state of the database, e.g. an invalid cursor.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrUnauthenticated is wrapped by the errors of credentials that do not
+	// identify anyone, e.g. a refresh token that was already used.
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// kindError is an error with its own message that wraps one of the kinds.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func newError(kind error, msg string) error {
+	return &kindError{kind: kind, msg: msg}
+}
+
+func (e *kindError) Error() string { return e.msg }
+
+func (e *kindError) Unwrap() error { return e.kind }
+
+// NotFound returns an error wrapping ErrNotFound that names what was not
+// found, e.g. "item not found".
+func NotFound(what string) error {
+	return newError(ErrNotFound, what+" not found")
+}
+
+// notFound converts sql.ErrNoRows into NotFound(what) and returns any other
+// error as is.
+func notFound(err error, what string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound(what)
+	}
+	return err
+}
@@ -0,0 +1,3 @@
+package db
+
+var PrepareSearchIndex = prepareSearchIndex
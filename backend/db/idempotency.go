@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// IdempotencyKeyTTL is how long a stored response is replayed for.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+type IdempotencyRepository interface {
+	// Reserve stores an in-flight record for the key, locked until
+	// lockedUntil. If a record already exists it is returned together with
+	// false instead, unless it is still in flight and its lock expired: then
+	// the request that reserved it is assumed to have died, and the key is
+	// reserved again for the caller.
+	Reserve(ctx context.Context, userID int64, key string, fingerprint string, lockedUntil time.Time) (domain.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record domain.IdempotencyRecord) error
+	Release(ctx context.Context, userID int64, key string) error
+}
+
+type IdempotencyDBRepository struct {
+	*dbConn
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &IdempotencyDBRepository{dbConn: newConn(db)}
+}
+
+func (r *IdempotencyDBRepository) Reserve(ctx context.Context, userID int64, key string, fingerprint string, lockedUntil time.Time) (domain.IdempotencyRecord, bool, error) {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	expired := domain.FormatTime(now.Add(-IdempotencyKeyTTL))
+	if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < ?", expired); err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+
+	// A concurrent request with the same key makes the insert a no-op, and
+	// its record is returned instead.
+	res, err := tx.ExecContext(ctx, tx.dialect.insertOrIgnore("INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, locked_until) VALUES (?, ?, ?, ?)"),
+		userID, key, fingerprint, domain.FormatTime(lockedUntil))
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+	reserved, err := affectsOneRow(res)
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+	if !reserved {
+		// Records in flight from before locked_until was added have no lock
+		// and are taken over too.
+		res, err := tx.ExecContext(ctx, `UPDATE idempotency_keys SET fingerprint = ?, locked_until = ?, created_at = ?
+			WHERE user_id = ? AND idempotency_key = ? AND status_code IS NULL AND (locked_until IS NULL OR locked_until < ?)`,
+			fingerprint, domain.FormatTime(lockedUntil), domain.FormatTime(now), userID, key, domain.FormatTime(now))
+		if err != nil {
+			return domain.IdempotencyRecord{}, false, err
+		}
+		if reserved, err = affectsOneRow(res); err != nil {
+			return domain.IdempotencyRecord{}, false, err
+		}
+	}
+	if reserved {
+		if err := tx.Commit(); err != nil {
+			return domain.IdempotencyRecord{}, false, err
+		}
+		return domain.IdempotencyRecord{UserID: userID, Key: key, Fingerprint: fingerprint}, true, nil
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT user_id, idempotency_key, fingerprint, status_code, content_type, body, created_at FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?", userID, key)
+
+	var rec domain.IdempotencyRecord
+	var status sql.NullInt64
+	var contentType sql.NullString
+	if err := row.Scan(&rec.UserID, &rec.Key, &rec.Fingerprint, &status, &contentType, &rec.Body, &rec.CreatedAt); err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+	rec.StatusCode = int(status.Int64)
+	rec.ContentType = contentType.String
+	return rec, false, tx.Commit()
+}
+
+func (r *IdempotencyDBRepository) Complete(ctx context.Context, record domain.IdempotencyRecord) error {
+	_, err := r.ExecContext(ctx, "UPDATE idempotency_keys SET status_code = ?, content_type = ?, body = ?, locked_until = NULL WHERE user_id = ? AND idempotency_key = ?", record.StatusCode, record.ContentType, record.Body, record.UserID, record.Key)
+	return err
+}
+
+func (r *IdempotencyDBRepository) Release(ctx context.Context, userID int64, key string) error {
+	_, err := r.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?", userID, key)
+	return err
+}
+
+func affectsOneRow(res sql.Result) (bool, error) {
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
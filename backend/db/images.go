@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// PutImageFunc stores image data and returns a reference to it.
+type PutImageFunc func(ctx context.Context, data []byte) (domain.ItemImage, error)
+
+// MoveImagesToStore moves images still stored as blobs in items.image into the
+// image store with put, one item at a time so that only one blob is held in
+// memory. It returns the number of moved images.
+func MoveImagesToStore(ctx context.Context, sqlDB *sql.DB, put PutImageFunc) (int, error) {
+	db := newConn(sqlDB)
+	rows, err := db.QueryContext(ctx, "SELECT id FROM items WHERE image IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := moveImageToStore(ctx, db, put, id); err != nil {
+			return i, errors.Wrapf(err, "failed to move image of item %d", id)
+		}
+	}
+	return len(ids), nil
+}
+
+func moveImageToStore(ctx context.Context, db *dbConn, put PutImageFunc, id int64) error {
+	var data []byte
+	if err := db.QueryRowContext(ctx, "SELECT image FROM items WHERE id = ?", id).Scan(&data); err != nil {
+		return err
+	}
+
+	image, err := put(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setItemImage(ctx, tx, id, image); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var (
+	ErrTooManyItemImages = newError(ErrPreconditionFailed, fmt.Sprintf("an item can have at most %d images", domain.MaxItemImages))
+	ErrInvalidImageOrder = newError(ErrInvalidArgument, "image order must list every image of the item exactly once")
+	ErrOnlyItemImage     = newError(ErrPreconditionFailed, "cannot delete the only image of an item")
+)
+
+const itemImageColumns = "id, position, image_key, content_type"
+
+func scanItemImage(row rowScanner, image *domain.ItemImage) error {
+	return row.Scan(&image.ID, &image.Position, &image.Key, &image.ContentType)
+}
+
+func (r *ItemDBRepository) GetItemImages(ctx context.Context, itemID int64) ([]domain.ItemImage, error) {
+	return getItemImages(ctx, r.dbConn, itemID)
+}
+
+func getItemImages(ctx context.Context, q queryer, itemID int64) ([]domain.ItemImage, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+itemImageColumns+" FROM item_images WHERE item_id = ? ORDER BY position, id", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []domain.ItemImage
+	for rows.Next() {
+		var image domain.ItemImage
+		if err := scanItemImage(rows, &image); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// AddItemImage appends an image after the existing images of the item.
+func (r *ItemDBRepository) AddItemImage(ctx context.Context, itemID int64, image domain.ItemImage) (domain.ItemImage, error) {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.ItemImage{}, err
+	}
+	defer tx.Rollback()
+
+	var count, next int
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(MAX(position) + 1, 0) FROM item_images WHERE item_id = ?", itemID)
+	if err := row.Scan(&count, &next); err != nil {
+		return domain.ItemImage{}, err
+	}
+	if count >= domain.MaxItemImages {
+		return domain.ItemImage{}, ErrTooManyItemImages
+	}
+
+	image.ID, err = tx.insert(ctx, "INSERT INTO item_images (item_id, position, image_key, content_type) VALUES (?, ?, ?, ?)", itemID, next, image.Key, image.ContentType)
+	if err != nil {
+		return domain.ItemImage{}, err
+	}
+	image.Position = next
+	return image, tx.Commit()
+}
+
+// DeleteItemImage removes the image from the item and closes the gap in the
+// positions of the remaining images. It returns an ErrNotFound if the item
+// has no such image, and ErrOnlyItemImage if it is the only image of the item.
+func (r *ItemDBRepository) DeleteItemImage(ctx context.Context, itemID int64, imageID int64) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Every image of the item is locked, so that concurrent deletes cannot
+	// remove its last two images.
+	rows, err := tx.QueryContext(ctx, "SELECT id, position FROM item_images WHERE item_id = ?"+tx.dialect.forUpdate(), itemID)
+	if err != nil {
+		return err
+	}
+	count, position := 0, -1
+	for rows.Next() {
+		var id int64
+		var p int
+		if err := rows.Scan(&id, &p); err != nil {
+			rows.Close()
+			return err
+		}
+		if id == imageID {
+			position = p
+		}
+		count++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if position < 0 {
+		return NotFound("image")
+	}
+	if count == 1 {
+		return ErrOnlyItemImage
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM item_images WHERE id = ?", imageID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE item_images SET position = position - 1 WHERE item_id = ? AND position > ?", itemID, position); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderItemImages sets the order of the images of the item. imageIDs must
+// contain the ID of every image of the item exactly once.
+func (r *ItemDBRepository) ReorderItemImages(ctx context.Context, itemID int64, imageIDs []int64) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	images, err := getItemImages(ctx, tx, itemID)
+	if err != nil {
+		return err
+	}
+	if len(images) != len(imageIDs) {
+		return ErrInvalidImageOrder
+	}
+	positions := make(map[int64]int, len(imageIDs))
+	for i, id := range imageIDs {
+		positions[id] = i
+	}
+	for _, image := range images {
+		if _, ok := positions[image.ID]; !ok {
+			return ErrInvalidImageOrder
+		}
+	}
+
+	for id, position := range positions {
+		if _, err := tx.ExecContext(ctx, "UPDATE item_images SET position = ? WHERE id = ?", position, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+type LedgerRepository interface {
+	Deposit(ctx context.Context, userID int64, amount int64) error
+	GetEntriesByUserID(ctx context.Context, userID int64) ([]domain.LedgerEntry, error)
+	GetLedgerBalance(ctx context.Context, userID int64) (int64, error)
+}
+
+type LedgerDBRepository struct {
+	*dbConn
+}
+
+func NewLedgerRepository(db *sql.DB) LedgerRepository {
+	return &LedgerDBRepository{dbConn: newConn(db)}
+}
+
+func (r *LedgerDBRepository) Deposit(ctx context.Context, userID int64, amount int64) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET balance = balance + ? WHERE id = ?", amount, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return NotFound("user")
+	}
+
+	if err := insertLedgerTransaction(ctx, tx, domain.LedgerKindDeposit, 0, domain.ExternalAccountID, userID, amount); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *LedgerDBRepository) GetEntriesByUserID(ctx context.Context, userID int64) ([]domain.LedgerEntry, error) {
+	rows, err := r.QueryContext(ctx, "SELECT id, transaction_id, user_id, item_id, kind, amount, created_at FROM ledger_entries WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []domain.LedgerEntry
+	for rows.Next() {
+		var entry domain.LedgerEntry
+		var itemID sql.NullInt64
+		if err := rows.Scan(&entry.ID, &entry.TransactionID, &entry.UserID, &itemID, &entry.Kind, &entry.Amount, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.ItemID = itemID.Int64
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetLedgerBalance recomputes the balance of a user from the ledger. Every
+// change of users.balance is recorded, and balances held before the ledger
+// existed got an opening entry, so it equals users.balance.
+func (r *LedgerDBRepository) GetLedgerBalance(ctx context.Context, userID int64) (int64, error) {
+	row := r.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE user_id = ?", userID)
+
+	var balance int64
+	return balance, row.Scan(&balance)
+}
+
+// insertLedgerTransaction records a movement of amount from one account to
+// another as a debit/credit pair sharing a transaction ID.
+func insertLedgerTransaction(ctx context.Context, tx *dbTx, kind domain.LedgerKind, itemID int64, from int64, to int64, amount int64) error {
+	txID, err := newTransactionID()
+	if err != nil {
+		return err
+	}
+
+	var item sql.NullInt64
+	if itemID != 0 {
+		item = sql.NullInt64{Int64: itemID, Valid: true}
+	}
+
+	query := "INSERT INTO ledger_entries (transaction_id, user_id, item_id, kind, amount) VALUES (?, ?, ?, ?, ?), (?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, query,
+		txID, from, item, kind, -amount,
+		txID, to, item, kind, amount,
+	)
+	return err
+}
+
+func newTransactionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
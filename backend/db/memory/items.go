@@ -0,0 +1,411 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+type ItemRepository struct {
+	*Store
+}
+
+func NewItemRepository(s *Store) db.ItemRepository {
+	return &ItemRepository{Store: s}
+}
+
+func (r *ItemRepository) AddItem(ctx context.Context, item domain.Item) (domain.Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastItemID++
+	added := item
+	added.ID = r.lastItemID
+	added.CreatedAt = now()
+	added.UpdatedAt = added.CreatedAt
+	added.Image = domain.ItemImage{}
+	r.items[added.ID] = &added
+
+	if item.Image.Key != "" {
+		r.setItemImage(added.ID, item.Image)
+	}
+	added.Image = item.Image
+	return added, nil
+}
+
+func (r *ItemRepository) AddCategory(ctx context.Context, category domain.Category) (domain.Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastCategoryID++
+	category.ID = r.lastCategoryID
+	r.categories = append(r.categories, category)
+	return category, nil
+}
+
+func (r *ItemRepository) GetItem(ctx context.Context, id int64) (domain.Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, ok := r.items[id]
+	if !ok {
+		return domain.Item{}, db.NotFound("item")
+	}
+	res := *item
+	if images := r.images[id]; len(images) > 0 {
+		res.Image = images[0]
+	}
+	return res, nil
+}
+
+func (r *ItemRepository) GetItemImage(ctx context.Context, id int64) (domain.ItemImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := r.images[id]
+	if len(images) == 0 {
+		return domain.ItemImage{}, db.NotFound("image")
+	}
+	return images[0], nil
+}
+
+func (r *ItemRepository) GetOnSaleItems(ctx context.Context, p db.Page) ([]domain.ItemSummary, string, error) {
+	return r.listItems(p, updatedLater, func(item *domain.Item) bool {
+		return item.Status == domain.ItemStatusOnSale
+	})
+}
+
+func (r *ItemRepository) GetItemsByUserID(ctx context.Context, userID int64, p db.Page) ([]domain.ItemSummary, string, error) {
+	return r.listItems(p, createdLater, func(item *domain.Item) bool {
+		return item.UserID == userID
+	})
+}
+
+// listItems returns the page of the items matching the filter, sorted by less.
+func (r *ItemRepository) listItems(p db.Page, less func(a, b domain.Item) bool, filter func(*domain.Item) bool) ([]domain.ItemSummary, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	items := r.filterItems(filter)
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+
+	names := make(map[int64]string, len(r.categories))
+	for _, cat := range r.categories {
+		names[cat.ID] = cat.Name
+	}
+	summaries := make([]domain.ItemSummary, len(items))
+	for i, item := range items {
+		summaries[i] = domain.ItemSummary{
+			ID:           item.ID,
+			Name:         item.Name,
+			Price:        item.Price,
+			CategoryID:   item.CategoryID,
+			CategoryName: names[item.CategoryID],
+			UserID:       item.UserID,
+			Status:       item.Status,
+			CreatedAt:    item.CreatedAt,
+			UpdatedAt:    item.UpdatedAt,
+		}
+	}
+	return page(summaries, p)
+}
+
+// filterItems returns copies of the items matching the filter, without their
+// images. The caller holds the lock.
+func (s *Store) filterItems(filter func(*domain.Item) bool) []domain.Item {
+	var items []domain.Item
+	for _, item := range s.items {
+		if filter(item) {
+			items = append(items, *item)
+		}
+	}
+	return items
+}
+
+func updatedLater(a, b domain.Item) bool {
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.After(b.UpdatedAt)
+	}
+	return a.ID > b.ID
+}
+
+func createdLater(a, b domain.Item) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+func (r *ItemRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, cat := range r.categories {
+		if cat.ID == id {
+			return cat, nil
+		}
+	}
+	return domain.Category{}, db.NotFound("category")
+}
+
+func (r *ItemRepository) GetCategories(ctx context.Context, p db.Page) ([]domain.Category, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cats := append([]domain.Category(nil), r.categories...)
+	return page(cats, p)
+}
+
+func (r *ItemRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, ok := r.items[id]
+	if !ok {
+		return db.NotFound("item")
+	}
+	return r.transitionItemStatus(item, status)
+}
+
+// transitionItemStatus moves the item to the given status if the state machine
+// allows it and records the transition. The caller holds the lock.
+func (s *Store) transitionItemStatus(item *domain.Item, to domain.ItemStatus) error {
+	if err := item.Status.ValidateTransition(to); err != nil {
+		return err
+	}
+
+	s.lastHistoryID++
+	s.history = append(s.history, domain.ItemStatusHistory{
+		ID:         s.lastHistoryID,
+		ItemID:     item.ID,
+		FromStatus: item.Status,
+		ToStatus:   to,
+		CreatedAt:  domain.FormatTime(now()),
+	})
+	item.Status = to
+	item.UpdatedAt = now()
+	return nil
+}
+
+func (r *ItemRepository) GetItemStatusHistory(ctx context.Context, id int64) ([]domain.ItemStatusHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var history []domain.ItemStatusHistory
+	for _, h := range r.history {
+		if h.ItemID == id {
+			history = append(history, h)
+		}
+	}
+	return history, nil
+}
+
+func (r *ItemRepository) UpdateItem(ctx context.Context, item domain.Item) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.items[item.ID]; ok {
+		stored.Name = item.Name
+		stored.Price = item.Price
+		stored.Description = item.Description
+		stored.CategoryID = item.CategoryID
+		stored.UserID = item.UserID
+		stored.Status = item.Status
+		stored.UpdatedAt = now()
+	}
+	return nil
+}
+
+func (r *ItemRepository) UpdateItemImage(ctx context.Context, id int64, image domain.ItemImage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setItemImage(id, image)
+	return nil
+}
+
+// setItemImage replaces the primary image of the item, or adds it if the item
+// has no image. The caller holds the lock.
+func (s *Store) setItemImage(id int64, image domain.ItemImage) {
+	s.touchItem(id)
+	images := s.images[id]
+	if len(images) > 0 {
+		images[0].Key, images[0].ContentType = image.Key, image.ContentType
+		return
+	}
+	s.lastImageID++
+	s.images[id] = []domain.ItemImage{{ID: s.lastImageID, Position: 0, Key: image.Key, ContentType: image.ContentType}}
+}
+
+func (r *ItemRepository) GetItemImages(ctx context.Context, itemID int64) ([]domain.ItemImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.images[itemID]) == 0 {
+		return nil, nil
+	}
+	return append([]domain.ItemImage(nil), r.images[itemID]...), nil
+}
+
+func (r *ItemRepository) AddItemImage(ctx context.Context, itemID int64, image domain.ItemImage) (domain.ItemImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := r.images[itemID]
+	if len(images) >= domain.MaxItemImages {
+		return domain.ItemImage{}, db.ErrTooManyItemImages
+	}
+
+	r.lastImageID++
+	image.ID = r.lastImageID
+	image.Position = len(images)
+	r.images[itemID] = append(images, image)
+	r.touchItem(itemID)
+	return image, nil
+}
+
+func (r *ItemRepository) DeleteItemImage(ctx context.Context, itemID int64, imageID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := r.images[itemID]
+	for i, image := range images {
+		if image.ID != imageID {
+			continue
+		}
+		if len(images) == 1 {
+			return db.ErrOnlyItemImage
+		}
+		images = append(images[:i], images[i+1:]...)
+		for j := i; j < len(images); j++ {
+			images[j].Position = j
+		}
+		r.images[itemID] = images
+		r.touchItem(itemID)
+		return nil
+	}
+	return db.NotFound("image")
+}
+
+func (r *ItemRepository) ReorderItemImages(ctx context.Context, itemID int64, imageIDs []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	images := r.images[itemID]
+	if len(images) != len(imageIDs) {
+		return db.ErrInvalidImageOrder
+	}
+	byID := make(map[int64]domain.ItemImage, len(images))
+	for _, image := range images {
+		byID[image.ID] = image
+	}
+
+	reordered := make([]domain.ItemImage, len(imageIDs))
+	for i, id := range imageIDs {
+		image, ok := byID[id]
+		if !ok {
+			return db.ErrInvalidImageOrder
+		}
+		delete(byID, id)
+		image.Position = i
+		reordered[i] = image
+	}
+	r.images[itemID] = reordered
+	r.touchItem(itemID)
+	return nil
+}
+
+// touchItem bumps the updated_at of the item. The caller holds the lock.
+func (s *Store) touchItem(id int64) {
+	if item, ok := s.items[id]; ok {
+		item.UpdatedAt = now()
+	}
+}
+
+func (r *ItemRepository) AddImageVariants(ctx context.Context, variants []domain.ImageVariant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range variants {
+		k := variantKey{imageKey: v.ImageKey, size: v.Size}
+		if _, ok := r.variants[k]; !ok {
+			r.variants[k] = v
+		}
+	}
+	return nil
+}
+
+func (r *ItemRepository) GetImageVariant(ctx context.Context, imageKey string, size domain.ImageSize) (domain.ImageVariant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.variants[variantKey{imageKey: imageKey, size: size}]
+	if !ok {
+		return domain.ImageVariant{}, db.NotFound("image variant")
+	}
+	return v, nil
+}
+
+// SearchItems matches the keyword case-insensitively like the LIKE fallback of
+// the SQL repository. Relevance ranks name matches before description matches.
+func (r *ItemRepository) SearchItems(ctx context.Context, params db.ItemSearchParams) ([]domain.Item, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keyword := strings.ToLower(params.Keyword)
+	statuses := make(map[domain.ItemStatus]bool, len(params.Statuses))
+	for _, s := range params.Statuses {
+		statuses[s] = true
+	}
+	nameMatches := func(item domain.Item) bool {
+		return strings.Contains(strings.ToLower(item.Name), keyword)
+	}
+
+	items := r.filterItems(func(item *domain.Item) bool {
+		switch {
+		case keyword != "" && !nameMatches(*item) && !strings.Contains(strings.ToLower(item.Description), keyword):
+			return false
+		case params.CategoryID != 0 && item.CategoryID != params.CategoryID:
+			return false
+		case params.MinPrice != 0 && item.Price < params.MinPrice:
+			return false
+		case params.MaxPrice != 0 && item.Price > params.MaxPrice:
+			return false
+		case len(statuses) > 0 && !statuses[item.Status]:
+			return false
+		}
+		return true
+	})
+
+	var less func(a, b domain.Item) bool
+	switch params.Sort {
+	case db.ItemSearchSortPriceAsc:
+		less = func(a, b domain.Item) bool {
+			if a.Price != b.Price {
+				return a.Price < b.Price
+			}
+			return a.ID < b.ID
+		}
+	case db.ItemSearchSortPriceDesc:
+		less = func(a, b domain.Item) bool {
+			if a.Price != b.Price {
+				return a.Price > b.Price
+			}
+			return a.ID > b.ID
+		}
+	case db.ItemSearchSortNewest:
+		less = updatedLater
+	default:
+		less = func(a, b domain.Item) bool {
+			if an, bn := nameMatches(a), nameMatches(b); an != bn {
+				return an
+			}
+			return updatedLater(a, b)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+	return page(items, params.Page)
+}
@@ -0,0 +1,423 @@
+// Package memory implements the repositories of package db in memory. It is
+// meant for tests that do not need a real database, and behaves like the SQL
+// repositories as checked by the conformance suite in package dbtest. The
+// rate limiter state is also kept here by a single server process.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// Store holds the data of every repository. Repositories created from the
+// same Store see each other's changes, like repositories sharing a *sql.DB.
+type Store struct {
+	mu sync.Mutex
+
+	users      map[int64]*domain.User
+	lastUserID int64
+
+	categories     []domain.Category
+	lastCategoryID int64
+
+	items         map[int64]*domain.Item
+	lastItemID    int64
+	history       []domain.ItemStatusHistory
+	lastHistoryID int64
+	images        map[int64][]domain.ItemImage
+	lastImageID   int64
+	variants      map[variantKey]domain.ImageVariant
+	holds         map[int64]domain.Hold
+
+	ledger   []domain.LedgerEntry
+	lastTxID int64
+
+	orders []domain.Order
+
+	idempotency map[idempotencyKey]idempotencyRecord
+
+	sessions      map[int64]*domain.Session
+	lastSessionID int64
+
+	rateLimitHits      map[string][]time.Time
+	loginFailures      map[string]domain.Lockout
+	lastRateLimitSweep time.Time
+}
+
+type variantKey struct {
+	imageKey string
+	size     domain.ImageSize
+}
+
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+type idempotencyRecord struct {
+	domain.IdempotencyRecord
+	createdAt   time.Time
+	lockedUntil time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:       make(map[int64]*domain.User),
+		items:       make(map[int64]*domain.Item),
+		images:      make(map[int64][]domain.ItemImage),
+		variants:    make(map[variantKey]domain.ImageVariant),
+		holds:       make(map[int64]domain.Hold),
+		idempotency: make(map[idempotencyKey]idempotencyRecord),
+		sessions:    make(map[int64]*domain.Session),
+
+		rateLimitHits: make(map[string][]time.Time),
+		loginFailures: make(map[string]domain.Lockout),
+	}
+}
+
+// now is the current time with the resolution of the timestamps of the SQL
+// schema.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// page returns the rows of the page, which is selected by an offset, and the
+// cursor of the next page.
+func page[T any](rows []T, p db.Page) ([]T, string, error) {
+	offset := 0
+	if p.Cursor != "" {
+		n, err := strconv.Atoi(p.Cursor)
+		if err != nil || n < 0 {
+			return nil, "", db.ErrInvalidCursor
+		}
+		offset = n
+	}
+	if offset >= len(rows) {
+		return nil, "", nil
+	}
+	rows = rows[offset:]
+	if p.Limit <= 0 || len(rows) <= p.Limit {
+		return rows, "", nil
+	}
+	return rows[:p.Limit], strconv.Itoa(offset + p.Limit), nil
+}
+
+type UserRepository struct {
+	*Store
+}
+
+func NewUserRepository(s *Store) db.UserRepository {
+	return &UserRepository{Store: s}
+}
+
+func (r *UserRepository) AddUser(ctx context.Context, user domain.User) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if user.Email != "" && u.Email == user.Email {
+			return 0, db.ErrEmailTaken
+		}
+	}
+	for _, u := range r.users {
+		if user.LoginName != "" && u.LoginName == user.LoginName {
+			return 0, db.ErrLoginNameTaken
+		}
+	}
+
+	r.lastUserID++
+	user.ID = r.lastUserID
+	r.users[user.ID] = &user
+	return user.ID, nil
+}
+
+func (r *UserRepository) GetUser(ctx context.Context, id int64) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return domain.User{}, db.NotFound("user")
+	}
+	return *user, nil
+}
+
+func (r *UserRepository) GetUserByLoginName(ctx context.Context, loginName string) (domain.User, error) {
+	return r.findUser(func(u *domain.User) bool { return u.LoginName == loginName })
+}
+
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	return r.findUser(func(u *domain.User) bool { return u.Email == email })
+}
+
+func (r *UserRepository) findUser(match func(*domain.User) bool) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if match(u) {
+			return *u, nil
+		}
+	}
+	return domain.User{}, db.NotFound("user")
+}
+
+type LedgerRepository struct {
+	*Store
+}
+
+func NewLedgerRepository(s *Store) db.LedgerRepository {
+	return &LedgerRepository{Store: s}
+}
+
+func (r *LedgerRepository) Deposit(ctx context.Context, userID int64, amount int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return db.NotFound("user")
+	}
+	user.Balance += amount
+	r.addLedgerTransaction(domain.LedgerKindDeposit, 0, domain.ExternalAccountID, userID, amount)
+	return nil
+}
+
+func (r *LedgerRepository) GetEntriesByUserID(ctx context.Context, userID int64) ([]domain.LedgerEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []domain.LedgerEntry
+	for i := len(r.ledger) - 1; i >= 0; i-- {
+		if r.ledger[i].UserID == userID {
+			entries = append(entries, r.ledger[i])
+		}
+	}
+	return entries, nil
+}
+
+func (r *LedgerRepository) GetLedgerBalance(ctx context.Context, userID int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var balance int64
+	for _, entry := range r.ledger {
+		if entry.UserID == userID {
+			balance += entry.Amount
+		}
+	}
+	return balance, nil
+}
+
+// addLedgerTransaction records a debit/credit pair. The caller holds the lock.
+func (s *Store) addLedgerTransaction(kind domain.LedgerKind, itemID int64, from int64, to int64, amount int64) {
+	s.lastTxID++
+	txID := fmt.Sprintf("%032x", s.lastTxID)
+	createdAt := domain.FormatTime(now())
+	for _, e := range []struct {
+		userID int64
+		amount int64
+	}{{from, -amount}, {to, amount}} {
+		s.ledger = append(s.ledger, domain.LedgerEntry{
+			ID:            int64(len(s.ledger) + 1),
+			TransactionID: txID,
+			UserID:        e.userID,
+			ItemID:        itemID,
+			Kind:          kind,
+			Amount:        e.amount,
+			CreatedAt:     createdAt,
+		})
+	}
+}
+
+type PurchaseService struct {
+	*Store
+}
+
+func NewPurchaseService(s *Store) db.PurchaseService {
+	return &PurchaseService{Store: s}
+}
+
+func (s *PurchaseService) Purchase(ctx context.Context, buyerID int64, itemID int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[itemID]
+	if !ok {
+		return db.NotFound("item")
+	}
+	if _, err := s.releaseExpiredHold(item, now); err != nil {
+		return err
+	}
+	if item.UserID == buyerID {
+		return db.ErrPurchaseOwnItem
+	}
+
+	amount := item.Price
+	switch item.Status {
+	case domain.ItemStatusOnSale:
+		buyer, ok := s.users[buyerID]
+		if !ok {
+			return db.NotFound("user")
+		}
+		if buyer.Balance < item.Price {
+			return db.ErrInsufficientBalance
+		}
+		if err := s.transitionItemStatus(item, domain.ItemStatusSoldOut); err != nil {
+			return err
+		}
+		buyer.Balance -= item.Price
+		s.addLedgerTransaction(domain.LedgerKindPurchase, itemID, buyerID, domain.EscrowAccountID, item.Price)
+	case domain.ItemStatusReserved:
+		hold := s.holds[itemID]
+		if hold.BuyerID != buyerID {
+			return db.ErrItemReserved
+		}
+		if err := s.transitionItemStatus(item, domain.ItemStatusSoldOut); err != nil {
+			return err
+		}
+		delete(s.holds, itemID)
+		amount = hold.Amount
+	default:
+		return db.ErrItemNotOnSale
+	}
+
+	s.orders = append(s.orders, domain.Order{
+		ID:        int64(len(s.orders) + 1),
+		ItemID:    itemID,
+		BuyerID:   buyerID,
+		SellerID:  item.UserID,
+		Amount:    amount,
+		Status:    domain.OrderStatusPaid,
+		CreatedAt: now.UTC().Truncate(time.Second),
+	})
+	return nil
+}
+
+func (s *PurchaseService) Reserve(ctx context.Context, buyerID int64, itemID int64, now time.Time, expiresAt time.Time) (domain.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[itemID]
+	if !ok {
+		return domain.Hold{}, db.NotFound("item")
+	}
+	if _, err := s.releaseExpiredHold(item, now); err != nil {
+		return domain.Hold{}, err
+	}
+	switch {
+	case item.Status == domain.ItemStatusReserved:
+		return domain.Hold{}, db.ErrItemReserved
+	case item.Status != domain.ItemStatusOnSale:
+		return domain.Hold{}, db.ErrItemNotOnSale
+	case item.UserID == buyerID:
+		return domain.Hold{}, db.ErrPurchaseOwnItem
+	}
+	buyer, ok := s.users[buyerID]
+	if !ok {
+		return domain.Hold{}, db.NotFound("user")
+	}
+	if buyer.Balance < item.Price {
+		return domain.Hold{}, db.ErrInsufficientBalance
+	}
+
+	if err := s.transitionItemStatus(item, domain.ItemStatusReserved); err != nil {
+		return domain.Hold{}, err
+	}
+	buyer.Balance -= item.Price
+	hold := domain.Hold{ItemID: itemID, BuyerID: buyerID, Amount: item.Price, ExpiresAt: expiresAt.UTC().Truncate(time.Second), CreatedAt: now.UTC().Truncate(time.Second)}
+	s.holds[itemID] = hold
+	s.addLedgerTransaction(domain.LedgerKindHold, itemID, buyerID, domain.EscrowAccountID, item.Price)
+	return hold, nil
+}
+
+func (s *PurchaseService) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	released := 0
+	for itemID := range s.holds {
+		item, ok := s.items[itemID]
+		if !ok {
+			continue
+		}
+		ok, err := s.releaseExpiredHold(item, now)
+		if err != nil {
+			return released, err
+		}
+		if ok {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// releaseExpiredHold puts the item back on sale and refunds the buyer if the
+// hold of the item expired at now. The caller holds the lock.
+func (s *Store) releaseExpiredHold(item *domain.Item, now time.Time) (bool, error) {
+	hold, ok := s.holds[item.ID]
+	if !ok || !hold.Expired(now) {
+		return false, nil
+	}
+	if err := s.transitionItemStatus(item, domain.ItemStatusOnSale); err != nil {
+		return false, err
+	}
+	delete(s.holds, item.ID)
+	if buyer, ok := s.users[hold.BuyerID]; ok {
+		buyer.Balance += hold.Amount
+	}
+	s.addLedgerTransaction(domain.LedgerKindRelease, item.ID, domain.EscrowAccountID, hold.BuyerID, hold.Amount)
+	return true, nil
+}
+
+type IdempotencyRepository struct {
+	*Store
+}
+
+func NewIdempotencyRepository(s *Store) db.IdempotencyRepository {
+	return &IdempotencyRepository{Store: s}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, userID int64, key string, fingerprint string, lockedUntil time.Time) (domain.IdempotencyRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey{userID: userID, key: key}
+	if rec, ok := r.idempotency[k]; ok && time.Since(rec.createdAt) < db.IdempotencyKeyTTL {
+		if rec.Completed() || !rec.lockedUntil.Before(time.Now()) {
+			return rec.IdempotencyRecord, false, nil
+		}
+	}
+
+	rec := domain.IdempotencyRecord{UserID: userID, Key: key, Fingerprint: fingerprint, CreatedAt: domain.FormatTime(now())}
+	r.idempotency[k] = idempotencyRecord{IdempotencyRecord: rec, createdAt: time.Now(), lockedUntil: lockedUntil}
+	return domain.IdempotencyRecord{UserID: userID, Key: key, Fingerprint: fingerprint}, true, nil
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, record domain.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	if rec, ok := r.idempotency[k]; ok {
+		rec.StatusCode = record.StatusCode
+		rec.ContentType = record.ContentType
+		rec.Body = append([]byte(nil), record.Body...)
+		r.idempotency[k] = rec
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, userID int64, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.idempotency, idempotencyKey{userID: userID, key: key})
+	return nil
+}
@@ -0,0 +1,24 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/dbtest"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) dbtest.Repositories {
+		s := memory.NewStore()
+		return dbtest.Repositories{
+			Users:       memory.NewUserRepository(s),
+			Items:       memory.NewItemRepository(s),
+			Ledger:      memory.NewLedgerRepository(s),
+			Purchase:    memory.NewPurchaseService(s),
+			Orders:      memory.NewOrderService(s),
+			Idempotency: memory.NewIdempotencyRepository(s),
+			Sessions:    memory.NewSessionRepository(s),
+			RateLimits:  memory.NewRateLimitRepository(s),
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+type OrderService struct {
+	*Store
+}
+
+func NewOrderService(s *Store) db.OrderService {
+	return &OrderService{Store: s}
+}
+
+func (s *OrderService) GetOrdersByUserID(ctx context.Context, userID int64) ([]domain.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var orders []domain.Order
+	for i := len(s.orders) - 1; i >= 0; i-- {
+		if o := s.orders[i]; o.BuyerID == userID || o.SellerID == userID {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+func (s *OrderService) Ship(ctx context.Context, sellerID int64, itemID int64, trackingNumber string, now time.Time) (domain.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.order(itemID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if order.SellerID != sellerID {
+		return domain.Order{}, db.ErrNotSeller
+	}
+	if order.Status != domain.OrderStatusPaid {
+		return domain.Order{}, db.ErrOrderNotPaid
+	}
+	item, ok := s.items[itemID]
+	if !ok {
+		return domain.Order{}, db.NotFound("item")
+	}
+
+	if err := s.transitionItemStatus(item, domain.ItemStatusShipped); err != nil {
+		return domain.Order{}, err
+	}
+	order.Status, order.TrackingNumber, order.ShippedAt = domain.OrderStatusShipped, trackingNumber, now.UTC().Truncate(time.Second)
+	return *order, nil
+}
+
+func (s *OrderService) Receive(ctx context.Context, buyerID int64, itemID int64, now time.Time) (domain.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.order(itemID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if order.BuyerID != buyerID {
+		return domain.Order{}, db.ErrNotBuyer
+	}
+	if order.Status != domain.OrderStatusShipped {
+		return domain.Order{}, db.ErrOrderNotShipped
+	}
+	if err := s.completeOrder(order, now); err != nil {
+		return domain.Order{}, err
+	}
+	return *order, nil
+}
+
+func (s *OrderService) CompleteShippedOrders(ctx context.Context, now time.Time, shippedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	completed := 0
+	for i := range s.orders {
+		order := &s.orders[i]
+		if order.Status != domain.OrderStatusShipped || order.ShippedAt.After(shippedBefore) {
+			continue
+		}
+		if err := s.completeOrder(order, now); err != nil {
+			return completed, err
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// order returns the order of the item. The caller holds the lock.
+func (s *Store) order(itemID int64) (*domain.Order, error) {
+	for i := range s.orders {
+		if s.orders[i].ItemID == itemID {
+			return &s.orders[i], nil
+		}
+	}
+	return nil, db.NotFound("order")
+}
+
+// completeOrder marks the order as completed at now and pays the seller from
+// escrow. The caller holds the lock.
+func (s *Store) completeOrder(order *domain.Order, now time.Time) error {
+	item, ok := s.items[order.ItemID]
+	if !ok {
+		return db.NotFound("item")
+	}
+	seller, ok := s.users[order.SellerID]
+	if !ok {
+		return errors.Wrapf(db.NotFound("user"), "seller %d", order.SellerID)
+	}
+	if err := s.transitionItemStatus(item, domain.ItemStatusCompleted); err != nil {
+		return err
+	}
+	order.Status, order.CompletedAt = domain.OrderStatusCompleted, now.UTC().Truncate(time.Second)
+	seller.Balance += order.Amount
+	s.addLedgerTransaction(domain.LedgerKindPayout, order.ItemID, domain.EscrowAccountID, seller.ID, order.Amount)
+	return nil
+}
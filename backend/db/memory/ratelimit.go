@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// rateLimitSweepInterval is how often keys without recent hits or failures
+// are dropped, so that a long-running process does not keep every IP.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitRepository keeps the state in the process, which saves the
+// database round trips when a single server process runs.
+type RateLimitRepository struct {
+	*Store
+}
+
+func NewRateLimitRepository(s *Store) db.RateLimitRepository {
+	return &RateLimitRepository{Store: s}
+}
+
+func (r *RateLimitRepository) AddHit(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (time.Duration, error) {
+	if window > db.MaxRateLimitWindow {
+		return 0, errors.Errorf("rate limit window %s is longer than %s", window, db.MaxRateLimitWindow)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweepRateLimits(now)
+
+	// Hits are in time order, so the ones left of the window are a prefix.
+	hits := r.rateLimitHits[key]
+	start := now.Add(-window)
+	i := 0
+	for i < len(hits) && !hits[i].After(start) {
+		i++
+	}
+	hits = hits[i:]
+	if len(hits) >= limit {
+		r.rateLimitHits[key] = hits
+		return hits[0].Add(window).Sub(now), nil
+	}
+	r.rateLimitHits[key] = append(hits, now)
+	return 0, nil
+}
+
+func (r *RateLimitRepository) GetLockout(ctx context.Context, key string, now time.Time) (domain.Lockout, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.loginFailures[key]
+	if !ok || !l.LastFailureAt.After(now.Add(-db.LoginFailureTTL)) {
+		return domain.Lockout{}, nil
+	}
+	return l, nil
+}
+
+func (r *RateLimitRepository) AddFailure(ctx context.Context, key string, now time.Time, policy domain.LockoutPolicy) (domain.Lockout, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweepRateLimits(now)
+
+	l := r.loginFailures[key]
+	if !l.LastFailureAt.After(now.Add(-db.LoginFailureTTL)) {
+		l.Failures = 0
+	}
+	l.Failures++
+	l.LastFailureAt = now
+	if d := policy.LockFor(l.Failures); d > 0 && now.Add(d).After(l.LockedUntil) {
+		l.LockedUntil = now.Add(d)
+	}
+	r.loginFailures[key] = l
+	return l, nil
+}
+
+func (r *RateLimitRepository) ResetFailures(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.loginFailures, key)
+	return nil
+}
+
+// sweepRateLimits drops the expired state. The caller holds the lock.
+func (r *RateLimitRepository) sweepRateLimits(now time.Time) {
+	if now.Sub(r.lastRateLimitSweep) < rateLimitSweepInterval {
+		return
+	}
+	r.lastRateLimitSweep = now
+
+	for key, hits := range r.rateLimitHits {
+		if len(hits) == 0 || !hits[len(hits)-1].After(now.Add(-db.MaxRateLimitWindow)) {
+			delete(r.rateLimitHits, key)
+		}
+	}
+	for key, l := range r.loginFailures {
+		if !l.LastFailureAt.After(now.Add(-db.LoginFailureTTL)) && !l.LockedUntil.After(now) {
+			delete(r.loginFailures, key)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+type SessionRepository struct {
+	*Store
+}
+
+func NewSessionRepository(s *Store) db.SessionRepository {
+	return &SessionRepository{Store: s}
+}
+
+func (r *SessionRepository) AddSession(ctx context.Context, userID int64, refreshTokenHash string, userAgent string) (domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.lastSessionID++
+	s := domain.Session{
+		ID:               r.lastSessionID,
+		UserID:           userID,
+		RefreshTokenHash: refreshTokenHash,
+		UserAgent:        userAgent,
+		CreatedAt:        domain.FormatTime(now),
+		LastUsedAt:       domain.FormatTime(now),
+		ExpiresAt:        domain.FormatTime(now.Add(db.SessionTTL)),
+	}
+	r.sessions[s.ID] = &s
+	return s, nil
+}
+
+func (r *SessionRepository) GetSession(ctx context.Context, id int64) (domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return domain.Session{}, db.NotFound("session")
+	}
+	return *s, nil
+}
+
+func (r *SessionRepository) RotateRefreshToken(ctx context.Context, oldHash string, newHash string) (domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range r.sessions {
+		if s.RefreshTokenHash != oldHash || !s.Active(now) {
+			continue
+		}
+		s.RefreshTokenHash = newHash
+		s.LastUsedAt = domain.FormatTime(now)
+		s.ExpiresAt = domain.FormatTime(now.Add(db.SessionTTL))
+		return *s, nil
+	}
+	return domain.Session{}, db.ErrInvalidRefreshToken
+}
+
+func (r *SessionRepository) GetActiveSessionsByUserID(ctx context.Context, userID int64) ([]domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var sessions []domain.Session
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.Active(now) {
+			sessions = append(sessions, *s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUsedAt != sessions[j].LastUsedAt {
+			return sessions[i].LastUsedAt > sessions[j].LastUsedAt
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return db.NotFound("session")
+	}
+	if s.RevokedAt == "" {
+		s.RevokedAt = domain.FormatTime(now())
+	}
+	return nil
+}
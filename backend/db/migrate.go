@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// Migrations are numbered pairs of files in the directory of each dialect,
+// e.g. migrations/sqlite: NNNN_name.up.sql applies a change to the schema and
+// NNNN_name.down.sql reverts it. Applied versions are recorded in
+// schema_migrations.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    integer primary key,
+    name       varchar(255) NOT NULL,
+    applied_at varchar(32)  NOT NULL
+)`
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration and when it was applied. AppliedAt is empty
+// for pending migrations.
+type MigrationStatus struct {
+	Migration
+	AppliedAt string
+}
+
+// Migrations returns the embedded migrations for the database ordered by
+// version.
+func Migrations(db *sql.DB) ([]Migration, error) {
+	return loadMigrations(dialectOf(db))
+}
+
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := "migrations/" + d.String()
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := migrationFileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// GetMigrationStatus returns every embedded migration and when it was applied.
+func GetMigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		a, ok := applied[m.Version]
+		if ok && a.name != m.Name {
+			// Committed migrations are never renamed or renumbered, so the
+			// database was migrated by a build whose migrations did not
+			// match these.
+			return nil, fmt.Errorf("migration %04d was applied as %s, not %s", m.Version, a.name, m.Name)
+		}
+		status[i] = MigrationStatus{Migration: m, AppliedAt: a.appliedAt}
+	}
+	return status, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own
+// transaction. It returns the applied migrations.
+func MigrateUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	status, err := GetMigrationStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, s := range status {
+		if s.AppliedAt != "" {
+			continue
+		}
+		appliedAt := domain.FormatTime(time.Now())
+		err := runMigration(ctx, db, s.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", s.Version, s.Name, appliedAt)
+		if err != nil {
+			return done, errors.Wrapf(err, "failed to apply migration %04d_%s", s.Version, s.Name)
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the last n applied migrations, newest first. It returns
+// the reverted migrations.
+func MigrateDown(ctx context.Context, db *sql.DB, n int) ([]Migration, error) {
+	status, err := GetMigrationStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(status) - 1; i >= 0 && len(done) < n; i-- {
+		s := status[i]
+		if s.AppliedAt == "" {
+			continue
+		}
+		err := runMigration(ctx, db, s.Down, "DELETE FROM schema_migrations WHERE version = ?", s.Version)
+		if err != nil {
+			return done, errors.Wrapf(err, "failed to revert migration %04d_%s", s.Version, s.Name)
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// runMigration executes the script and updates schema_migrations in one
+// transaction, so that a failing migration leaves the schema unchanged.
+// MySQL commits DDL statements implicitly, so there a failing migration may
+// have to be cleaned up by hand.
+func runMigration(ctx context.Context, db *sql.DB, script string, record string, args ...interface{}) error {
+	tx, err := newConn(db).BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The script is run as is: it may contain ? in string literals.
+	if _, err := tx.Tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type appliedMigration struct {
+	name      string
+	appliedAt string
+}
+
+// appliedMigrations returns the name and time of each applied version.
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int]appliedMigration, error) {
+	if _, err := db.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// Reset reverts every applied migration and applies them again, which leaves
+// the database with an empty schema.
+func Reset(ctx context.Context, db *sql.DB) error {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	if _, err := MigrateDown(ctx, db, len(applied)); err != nil {
+		return err
+	}
+	_, err = MigrateUp(ctx, db)
+	return err
+}
@@ -0,0 +1,93 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestMigrateUpRejectsChangedHistory(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := db.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "migrate.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	if _, err := db.MigrateUp(ctx, sqlDB); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := db.MigrateUp(ctx, sqlDB); err != nil || len(done) != 0 {
+		t.Fatalf("MigrateUp of a migrated database = %v, %v", done, err)
+	}
+
+	// A database migrated when version 2 had another name.
+	if _, err := sqlDB.ExecContext(ctx, "UPDATE schema_migrations SET name = 'renumbered' WHERE version = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MigrateUp(ctx, sqlDB); err == nil || !strings.Contains(err.Error(), "applied as renumbered") {
+		t.Errorf("MigrateUp with a renamed migration: got %v, want an error", err)
+	}
+}
+
+func TestOpeningBalancesMigration(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := db.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "migrate.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	if _, err := db.MigrateUp(ctx, sqlDB); err != nil {
+		t.Fatal(err)
+	}
+	status, err := db.GetMigrationStatus(ctx, sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for i := len(status) - 1; i >= 0 && n == 0; i-- {
+		if status[i].Name == "opening_balances" {
+			n = len(status) - i
+		}
+	}
+	if _, err := db.MigrateDown(ctx, sqlDB, n); err != nil {
+		t.Fatal(err)
+	}
+
+	// Balances from before the ledger, partly topped up since.
+	ledger := db.NewLedgerRepository(sqlDB)
+	want := map[int64]int64{}
+	for _, balance := range []int64{0, 500, 300} {
+		res, err := sqlDB.ExecContext(ctx, "INSERT INTO users (name, password, balance) VALUES ('user', 'hash', ?)", balance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		want[id] = balance
+	}
+	for id := range want {
+		if want[id] == 300 {
+			if err := ledger.Deposit(ctx, id, 100); err != nil {
+				t.Fatal(err)
+			}
+			want[id] += 100
+		}
+	}
+
+	if _, err := db.MigrateUp(ctx, sqlDB); err != nil {
+		t.Fatal(err)
+	}
+	for id, balance := range want {
+		if got, err := ledger.GetLedgerBalance(ctx, id); err != nil || got != balance {
+			t.Errorf("ledger balance of user %d = %d, %v, want %d", id, got, err, balance)
+		}
+	}
+	if got, err := ledger.GetLedgerBalance(ctx, domain.ExternalAccountID); err != nil || got != -900 {
+		t.Errorf("ledger balance of the external account = %d, %v, want -900", got, err)
+	}
+}
@@ -0,0 +1,97 @@
+-- Timestamps are stored as text in the format of the SQLite schema,
+-- 'YYYY-MM-DD HH:MM:SS' in local time, and item IDs are integer. Later
+-- migrations change both: 0005 widens item IDs to bigint and 0006 stores
+-- timestamps in UTC as 'YYYY-MM-DDTHH:MM:SSZ'. Expression defaults need
+-- MySQL 8.0.13.
+CREATE TABLE items
+(
+    id          integer AUTO_INCREMENT primary key,
+    name        varchar(50),
+    price       bigint,
+    description text,
+    category_id bigint,
+    seller_id   bigint,
+    image       longblob, -- legacy, kept for parity with the SQLite schema
+    status      integer,
+    created_at  varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    updated_at  varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    INDEX items_status_updated_at (status, updated_at, id),
+    INDEX items_seller_id_updated_at (seller_id, updated_at, id)
+);
+
+CREATE TABLE users
+(
+    id       bigint AUTO_INCREMENT primary key,
+    name     varchar(50),
+    password varchar(60),
+    balance  bigint default 0
+);
+
+CREATE TABLE category
+(
+    id   bigint AUTO_INCREMENT primary key,
+    name varchar(50)
+);
+
+CREATE TABLE status
+(
+    id   integer primary key,
+    name varchar(50)
+);
+
+CREATE TABLE ledger_entries
+(
+    id             bigint AUTO_INCREMENT primary key,
+    transaction_id varchar(32) NOT NULL,
+    user_id        bigint      NOT NULL,
+    item_id        integer,
+    kind           varchar(16) NOT NULL,
+    amount         bigint      NOT NULL,
+    created_at     varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    INDEX ledger_entries_user_id (user_id)
+);
+
+CREATE TABLE idempotency_keys
+(
+    user_id         bigint       NOT NULL,
+    idempotency_key varchar(255) NOT NULL,
+    fingerprint     varchar(64)  NOT NULL,
+    status_code     integer,
+    content_type    varchar(255),
+    body            longblob,
+    created_at      varchar(32)  NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE TABLE item_status_history
+(
+    id          bigint AUTO_INCREMENT primary key,
+    item_id     integer     NOT NULL,
+    from_status integer     NOT NULL,
+    to_status   integer     NOT NULL,
+    created_at  varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    INDEX item_status_history_item_id (item_id)
+);
+
+-- The images of an item in display order. The first one is the primary image
+-- returned by GET /items/:itemID/image.
+CREATE TABLE item_images
+(
+    id           bigint AUTO_INCREMENT primary key,
+    item_id      integer      NOT NULL,
+    position     integer      NOT NULL,
+    image_key    varchar(64)  NOT NULL,
+    content_type varchar(255) NOT NULL,
+    INDEX item_images_item_id_position (item_id, position)
+);
+
+CREATE TABLE image_variants
+(
+    image_key    varchar(64)  NOT NULL,
+    size         varchar(16)  NOT NULL,
+    variant_key  varchar(64)  NOT NULL,
+    content_type varchar(255) NOT NULL,
+    width        integer      NOT NULL,
+    height       integer      NOT NULL,
+    PRIMARY KEY (image_key, size)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE sessions
+(
+    id                 bigint AUTO_INCREMENT primary key,
+    user_id            bigint       NOT NULL,
+    refresh_token_hash varchar(64)  NOT NULL UNIQUE,
+    user_agent         varchar(255) NOT NULL DEFAULT '',
+    created_at         varchar(32)  NOT NULL,
+    last_used_at       varchar(32)  NOT NULL,
+    expires_at         varchar(32)  NOT NULL,
+    revoked_at         varchar(32)
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
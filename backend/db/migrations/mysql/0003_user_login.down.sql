@@ -0,0 +1,4 @@
+DROP INDEX users_email ON users;
+DROP INDEX users_login_name ON users;
+ALTER TABLE users DROP COLUMN email;
+ALTER TABLE users DROP COLUMN login_name;
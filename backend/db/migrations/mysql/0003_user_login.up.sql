@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN login_name varchar(50);
+ALTER TABLE users ADD COLUMN email varchar(254);
+
+-- Existing users log in with their lowercased name when no other user has the
+-- same name. The others keep logging in with their user ID. MySQL cannot
+-- select from the updated table in a subquery, so the names are joined.
+UPDATE users u
+JOIN (SELECT LOWER(name) AS login_name
+      FROM users
+      WHERE name IS NOT NULL AND name <> '' AND name NOT LIKE '%@%'
+      GROUP BY LOWER(name)
+      HAVING COUNT(*) = 1) unique_names ON LOWER(u.name) = unique_names.login_name
+SET u.login_name = unique_names.login_name;
+
+CREATE UNIQUE INDEX users_login_name ON users (login_name);
+CREATE UNIQUE INDEX users_email ON users (email);
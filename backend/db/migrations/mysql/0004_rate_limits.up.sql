@@ -0,0 +1,18 @@
+-- Times are unix milliseconds, so that sliding windows are exact.
+CREATE TABLE rate_limit_hits
+(
+    id             bigint AUTO_INCREMENT primary key,
+    rate_limit_key varchar(255) NOT NULL,
+    hit_at         bigint       NOT NULL
+);
+
+CREATE INDEX rate_limit_hits_key ON rate_limit_hits (rate_limit_key, hit_at);
+CREATE INDEX rate_limit_hits_hit_at ON rate_limit_hits (hit_at);
+
+CREATE TABLE login_failures
+(
+    rate_limit_key  varchar(255) primary key,
+    failures        integer      NOT NULL,
+    last_failure_at bigint       NOT NULL,
+    locked_until    bigint       NOT NULL DEFAULT 0
+);
@@ -0,0 +1,4 @@
+ALTER TABLE item_images MODIFY item_id integer NOT NULL;
+ALTER TABLE item_status_history MODIFY item_id integer NOT NULL;
+ALTER TABLE ledger_entries MODIFY item_id integer;
+ALTER TABLE items MODIFY id integer AUTO_INCREMENT;
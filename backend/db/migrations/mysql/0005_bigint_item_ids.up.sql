@@ -0,0 +1,5 @@
+-- Item IDs are 64-bit like the other IDs.
+ALTER TABLE items MODIFY id bigint AUTO_INCREMENT;
+ALTER TABLE ledger_entries MODIFY item_id bigint;
+ALTER TABLE item_status_history MODIFY item_id bigint NOT NULL;
+ALTER TABLE item_images MODIFY item_id bigint NOT NULL;
@@ -0,0 +1,36 @@
+DROP TRIGGER item_images_delete_updated_at;
+DROP TRIGGER item_images_update_updated_at;
+DROP TRIGGER item_images_insert_updated_at;
+DROP TRIGGER items_updated_at;
+
+-- Back to timestamps in local time.
+UPDATE items
+SET created_at = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(created_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s'),
+    updated_at = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(updated_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s');
+ALTER TABLE items
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    MODIFY updated_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s'));
+
+UPDATE ledger_entries
+SET created_at = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(created_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s');
+ALTER TABLE ledger_entries
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s'));
+
+UPDATE idempotency_keys
+SET created_at = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(created_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s');
+ALTER TABLE idempotency_keys
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s'));
+
+UPDATE item_status_history
+SET created_at = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(created_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s');
+ALTER TABLE item_status_history
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s'));
+
+UPDATE sessions
+SET created_at   = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(created_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s'),
+    last_used_at = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(last_used_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s'),
+    expires_at   = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(expires_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s'),
+    revoked_at   = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(revoked_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s');
+
+UPDATE schema_migrations
+SET applied_at = DATE_FORMAT(FROM_UNIXTIME(TIMESTAMPDIFF(SECOND, '1970-01-01', STR_TO_DATE(applied_at, '%Y-%m-%dT%H:%i:%sZ'))), '%Y-%m-%d %H:%i:%s');
@@ -0,0 +1,46 @@
+-- Timestamps are stored in UTC as 'YYYY-MM-DDTHH:MM:SSZ' instead of local
+-- time. UNIX_TIMESTAMP reads the old ones in the time zone of the session.
+UPDATE items
+SET created_at = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(created_at) SECOND), '%Y-%m-%dT%H:%i:%sZ'),
+    updated_at = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(updated_at) SECOND), '%Y-%m-%dT%H:%i:%sZ');
+ALTER TABLE items
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ')),
+    MODIFY updated_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ'));
+
+UPDATE ledger_entries
+SET created_at = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(created_at) SECOND), '%Y-%m-%dT%H:%i:%sZ');
+ALTER TABLE ledger_entries
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ'));
+
+UPDATE idempotency_keys
+SET created_at = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(created_at) SECOND), '%Y-%m-%dT%H:%i:%sZ');
+ALTER TABLE idempotency_keys
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ'));
+
+UPDATE item_status_history
+SET created_at = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(created_at) SECOND), '%Y-%m-%dT%H:%i:%sZ');
+ALTER TABLE item_status_history
+    MODIFY created_at varchar(32) NOT NULL DEFAULT (DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ'));
+
+UPDATE sessions
+SET created_at   = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(created_at) SECOND), '%Y-%m-%dT%H:%i:%sZ'),
+    last_used_at = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(last_used_at) SECOND), '%Y-%m-%dT%H:%i:%sZ'),
+    expires_at   = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(expires_at) SECOND), '%Y-%m-%dT%H:%i:%sZ'),
+    revoked_at   = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(revoked_at) SECOND), '%Y-%m-%dT%H:%i:%sZ');
+
+UPDATE schema_migrations
+SET applied_at = DATE_FORMAT(DATE_ADD('1970-01-01', INTERVAL UNIX_TIMESTAMP(applied_at) SECOND), '%Y-%m-%dT%H:%i:%sZ');
+
+-- Every update of an item that does not set updated_at itself, and every
+-- change to its images, bumps its updated_at.
+CREATE TRIGGER items_updated_at BEFORE UPDATE ON items FOR EACH ROW
+    SET NEW.updated_at = IF(NEW.updated_at = OLD.updated_at, DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ'), NEW.updated_at);
+
+CREATE TRIGGER item_images_insert_updated_at AFTER INSERT ON item_images FOR EACH ROW
+    UPDATE items SET updated_at = DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ') WHERE id = NEW.item_id;
+
+CREATE TRIGGER item_images_update_updated_at AFTER UPDATE ON item_images FOR EACH ROW
+    UPDATE items SET updated_at = DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ') WHERE id = NEW.item_id;
+
+CREATE TRIGGER item_images_delete_updated_at AFTER DELETE ON item_images FOR EACH ROW
+    UPDATE items SET updated_at = DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%dT%H:%i:%sZ') WHERE id = OLD.item_id;
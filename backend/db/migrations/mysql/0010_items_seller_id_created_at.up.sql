@@ -0,0 +1,3 @@
+-- The items of a user are listed by created_at.
+DROP INDEX items_seller_id_updated_at ON items;
+CREATE INDEX items_seller_id_created_at ON items (seller_id, created_at, id);
@@ -0,0 +1,9 @@
+DROP TABLE image_variants;
+DROP TABLE item_images;
+DROP TABLE item_status_history;
+DROP TABLE idempotency_keys;
+DROP TABLE ledger_entries;
+DROP TABLE status;
+DROP TABLE category;
+DROP TABLE users;
+DROP TABLE items;
@@ -0,0 +1,100 @@
+-- Timestamps are stored as text in the format of the SQLite schema,
+-- 'YYYY-MM-DD HH:MM:SS' in local time, and item IDs are integer. Later
+-- migrations change both: 0005 widens item IDs to bigint and 0006 stores
+-- timestamps in UTC as 'YYYY-MM-DDTHH:MM:SSZ'.
+CREATE TABLE items
+(
+    id          serial primary key,
+    name        varchar(50),
+    price       bigint,
+    description text,
+    category_id bigint,
+    seller_id   bigint,
+    image       bytea, -- legacy, kept for parity with the SQLite schema
+    status      integer,
+    created_at  text NOT NULL DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS'),
+    updated_at  text NOT NULL DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS')
+);
+
+CREATE INDEX items_status_updated_at ON items (status, updated_at, id);
+CREATE INDEX items_seller_id_updated_at ON items (seller_id, updated_at, id);
+
+CREATE TABLE users
+(
+    id       bigserial primary key,
+    name     varchar(50),
+    password varchar(60),
+    balance  bigint default 0
+);
+
+CREATE TABLE category
+(
+    id   bigserial primary key,
+    name varchar(50)
+);
+
+CREATE TABLE status
+(
+    id   integer primary key,
+    name varchar(50)
+);
+
+CREATE TABLE ledger_entries
+(
+    id             bigserial primary key,
+    transaction_id text   NOT NULL,
+    user_id        bigint NOT NULL,
+    item_id        integer,
+    kind           text   NOT NULL,
+    amount         bigint NOT NULL,
+    created_at     text   NOT NULL DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS')
+);
+
+CREATE INDEX ledger_entries_user_id ON ledger_entries (user_id);
+
+CREATE TABLE idempotency_keys
+(
+    user_id         bigint NOT NULL,
+    idempotency_key text   NOT NULL,
+    fingerprint     text   NOT NULL,
+    status_code     integer,
+    content_type    text,
+    body            bytea,
+    created_at      text   NOT NULL DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS'),
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE TABLE item_status_history
+(
+    id          bigserial primary key,
+    item_id     integer NOT NULL,
+    from_status integer NOT NULL,
+    to_status   integer NOT NULL,
+    created_at  text    NOT NULL DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS')
+);
+
+CREATE INDEX item_status_history_item_id ON item_status_history (item_id);
+
+-- The images of an item in display order. The first one is the primary image
+-- returned by GET /items/:itemID/image.
+CREATE TABLE item_images
+(
+    id           bigserial primary key,
+    item_id      integer NOT NULL,
+    position     integer NOT NULL,
+    image_key    text    NOT NULL,
+    content_type text    NOT NULL
+);
+
+CREATE INDEX item_images_item_id_position ON item_images (item_id, position);
+
+CREATE TABLE image_variants
+(
+    image_key    text    NOT NULL,
+    size         text    NOT NULL,
+    variant_key  text    NOT NULL,
+    content_type text    NOT NULL,
+    width        integer NOT NULL,
+    height       integer NOT NULL,
+    PRIMARY KEY (image_key, size)
+);
@@ -0,0 +1,4 @@
+DROP INDEX users_email;
+DROP INDEX users_login_name;
+ALTER TABLE users DROP COLUMN email;
+ALTER TABLE users DROP COLUMN login_name;
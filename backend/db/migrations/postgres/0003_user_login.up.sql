@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN login_name varchar(50);
+ALTER TABLE users ADD COLUMN email varchar(254);
+
+-- Existing users log in with their lowercased name when no other user has the
+-- same name. The others keep logging in with their user ID.
+UPDATE users
+SET login_name = LOWER(name)
+WHERE name IS NOT NULL
+  AND name <> ''
+  AND name NOT LIKE '%@%'
+  AND LOWER(name) IN (SELECT LOWER(name) FROM users GROUP BY LOWER(name) HAVING COUNT(*) = 1);
+
+CREATE UNIQUE INDEX users_login_name ON users (login_name);
+CREATE UNIQUE INDEX users_email ON users (email);
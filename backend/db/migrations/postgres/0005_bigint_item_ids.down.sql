@@ -0,0 +1,5 @@
+ALTER TABLE item_images ALTER COLUMN item_id TYPE integer;
+ALTER TABLE item_status_history ALTER COLUMN item_id TYPE integer;
+ALTER TABLE ledger_entries ALTER COLUMN item_id TYPE integer;
+ALTER SEQUENCE items_id_seq AS integer;
+ALTER TABLE items ALTER COLUMN id TYPE integer;
@@ -0,0 +1,6 @@
+-- Item IDs are 64-bit like the other IDs.
+ALTER TABLE items ALTER COLUMN id TYPE bigint;
+ALTER SEQUENCE items_id_seq AS bigint;
+ALTER TABLE ledger_entries ALTER COLUMN item_id TYPE bigint;
+ALTER TABLE item_status_history ALTER COLUMN item_id TYPE bigint;
+ALTER TABLE item_images ALTER COLUMN item_id TYPE bigint;
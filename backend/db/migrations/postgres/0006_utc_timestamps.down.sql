@@ -0,0 +1,32 @@
+DROP TRIGGER item_images_updated_at ON item_images;
+DROP FUNCTION item_images_touch_item();
+DROP TRIGGER items_updated_at ON items;
+DROP FUNCTION items_set_updated_at();
+
+-- Back to timestamps in local time.
+UPDATE items
+SET created_at = to_char(created_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS'),
+    updated_at = to_char(updated_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS');
+ALTER TABLE items ALTER COLUMN created_at SET DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS');
+ALTER TABLE items ALTER COLUMN updated_at SET DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS');
+
+UPDATE ledger_entries
+SET created_at = to_char(created_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS');
+ALTER TABLE ledger_entries ALTER COLUMN created_at SET DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS');
+
+UPDATE idempotency_keys
+SET created_at = to_char(created_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS');
+ALTER TABLE idempotency_keys ALTER COLUMN created_at SET DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS');
+
+UPDATE item_status_history
+SET created_at = to_char(created_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS');
+ALTER TABLE item_status_history ALTER COLUMN created_at SET DEFAULT to_char(LOCALTIMESTAMP, 'YYYY-MM-DD HH24:MI:SS');
+
+UPDATE sessions
+SET created_at   = to_char(created_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS'),
+    last_used_at = to_char(last_used_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS'),
+    expires_at   = to_char(expires_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS'),
+    revoked_at   = to_char(revoked_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS');
+
+UPDATE schema_migrations
+SET applied_at = to_char(applied_at::timestamptz AT TIME ZONE current_setting('TimeZone'), 'YYYY-MM-DD HH24:MI:SS');
@@ -0,0 +1,12 @@
+-- The hold of each reserved item. Its price is in escrow until the buyer
+-- purchases the item or the hold expires.
+CREATE TABLE item_holds
+(
+    item_id    bigint primary key,
+    buyer_id   bigint NOT NULL,
+    amount     bigint NOT NULL,
+    expires_at text   NOT NULL,
+    created_at text   NOT NULL
+);
+
+CREATE INDEX item_holds_expires_at ON item_holds (expires_at);
@@ -0,0 +1,20 @@
+-- The order of each purchased item. Its price is in escrow until the buyer
+-- receives the item, or until some days after the seller ships it.
+CREATE TABLE orders
+(
+    id              bigserial primary key,
+    item_id         bigint NOT NULL,
+    buyer_id        bigint NOT NULL,
+    seller_id       bigint NOT NULL,
+    amount          bigint NOT NULL,
+    status          text   NOT NULL,
+    tracking_number text   NOT NULL DEFAULT '',
+    created_at      text   NOT NULL,
+    shipped_at      text,
+    completed_at    text
+);
+
+CREATE UNIQUE INDEX orders_item_id ON orders (item_id);
+CREATE INDEX orders_buyer_id ON orders (buyer_id);
+CREATE INDEX orders_seller_id ON orders (seller_id);
+CREATE INDEX orders_status_shipped_at ON orders (status, shipped_at);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS items_fts;
+DROP TABLE image_variants;
+DROP TABLE item_images;
+DROP TABLE item_status_history;
+DROP TABLE idempotency_keys;
+DROP TABLE ledger_entries;
+DROP TABLE status;
+DROP TABLE category;
+DROP TABLE users;
+DROP TABLE items;
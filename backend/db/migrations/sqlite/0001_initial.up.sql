@@ -0,0 +1,92 @@
+-- The schema before versioned migrations. Tables are created only if missing
+-- so that databases created by the old 01_schema.sql are adopted as they are.
+CREATE TABLE IF NOT EXISTS items
+(
+    id          integer primary key autoincrement,
+    name        varchar(50),
+    price       integer,
+    description text,
+    category_id integer,
+    seller_id   integer,
+    image       blob, -- legacy, moved to the image store on startup (see item_images)
+    status      integer,
+    created_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    updated_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS items_status_updated_at ON items (status, updated_at, id);
+CREATE INDEX IF NOT EXISTS items_seller_id_updated_at ON items (seller_id, updated_at, id);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id       integer primary key autoincrement,
+    name     varchar(50),
+    password binary(60),
+    balance  integer default 0
+);
+
+CREATE TABLE IF NOT EXISTS category
+(
+    id   integer primary key,
+    name varchar(50)
+);
+
+CREATE TABLE IF NOT EXISTS status
+(
+    id   integer primary key,
+    name varchar(50)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries
+(
+    id             integer primary key autoincrement,
+    transaction_id text    NOT NULL,
+    user_id        integer NOT NULL,
+    item_id        integer,
+    kind           text    NOT NULL,
+    amount         integer NOT NULL,
+    created_at     text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_user_id ON ledger_entries (user_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    user_id      integer NOT NULL,
+    key          text    NOT NULL,
+    fingerprint  text    NOT NULL,
+    status_code  integer,
+    content_type text,
+    body         blob,
+    created_at   text    NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS item_status_history
+(
+    id          integer primary key autoincrement,
+    item_id     integer NOT NULL,
+    from_status integer NOT NULL,
+    to_status   integer NOT NULL,
+    created_at  text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX IF NOT EXISTS item_status_history_item_id ON item_status_history (item_id);
+
+CREATE TABLE IF NOT EXISTS item_images
+(
+    item_id      integer primary key,
+    image_key    text NOT NULL,
+    content_type text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS image_variants
+(
+    image_key    text NOT NULL,
+    size         text NOT NULL,
+    variant_key  text NOT NULL,
+    content_type text NOT NULL,
+    width        integer NOT NULL,
+    height       integer NOT NULL,
+    PRIMARY KEY (image_key, size)
+);
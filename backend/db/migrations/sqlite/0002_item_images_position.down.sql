@@ -0,0 +1,16 @@
+-- Keep only the primary image of each item.
+ALTER TABLE item_images RENAME TO item_images_new;
+DROP INDEX item_images_item_id_position;
+
+CREATE TABLE item_images
+(
+    item_id      integer primary key,
+    image_key    text NOT NULL,
+    content_type text NOT NULL
+);
+
+INSERT INTO item_images (item_id, image_key, content_type)
+SELECT item_id, image_key, content_type FROM item_images_new AS i
+WHERE i.id = (SELECT id FROM item_images_new WHERE item_id = i.item_id ORDER BY position, id LIMIT 1);
+
+DROP TABLE item_images_new;
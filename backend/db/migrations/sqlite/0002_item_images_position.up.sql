@@ -0,0 +1,22 @@
+-- Allow several images per item. The existing image of each item becomes its
+-- primary image.
+ALTER TABLE item_images RENAME TO item_images_old;
+DROP INDEX IF EXISTS item_images_item_id_position;
+
+-- The images of an item in display order. The first one is the primary image
+-- returned by GET /items/:itemID/image.
+CREATE TABLE item_images
+(
+    id           integer primary key,
+    item_id      integer NOT NULL,
+    position     integer NOT NULL,
+    image_key    text NOT NULL,
+    content_type text NOT NULL
+);
+
+CREATE INDEX item_images_item_id_position ON item_images (item_id, position);
+
+INSERT INTO item_images (item_id, position, image_key, content_type)
+SELECT item_id, 0, image_key, content_type FROM item_images_old;
+
+DROP TABLE item_images_old;
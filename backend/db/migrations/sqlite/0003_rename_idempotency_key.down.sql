@@ -0,0 +1 @@
+ALTER TABLE idempotency_keys RENAME COLUMN idempotency_key TO key;
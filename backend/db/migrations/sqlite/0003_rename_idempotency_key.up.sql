@@ -0,0 +1,2 @@
+-- KEY is a reserved word in MySQL.
+ALTER TABLE idempotency_keys RENAME COLUMN key TO idempotency_key;
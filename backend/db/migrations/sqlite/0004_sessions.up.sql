@@ -0,0 +1,13 @@
+CREATE TABLE sessions
+(
+    id                 integer primary key autoincrement,
+    user_id            integer NOT NULL,
+    refresh_token_hash text    NOT NULL UNIQUE,
+    user_agent         text    NOT NULL DEFAULT '',
+    created_at         text    NOT NULL,
+    last_used_at       text    NOT NULL,
+    expires_at         text    NOT NULL,
+    revoked_at         text
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
@@ -0,0 +1,18 @@
+-- Times are unix milliseconds, so that sliding windows are exact.
+CREATE TABLE rate_limit_hits
+(
+    id             integer primary key autoincrement,
+    rate_limit_key text    NOT NULL,
+    hit_at         integer NOT NULL
+);
+
+CREATE INDEX rate_limit_hits_key ON rate_limit_hits (rate_limit_key, hit_at);
+CREATE INDEX rate_limit_hits_hit_at ON rate_limit_hits (hit_at);
+
+CREATE TABLE login_failures
+(
+    rate_limit_key  text    primary key,
+    failures        integer NOT NULL,
+    last_failure_at integer NOT NULL,
+    locked_until    integer NOT NULL DEFAULT 0
+);
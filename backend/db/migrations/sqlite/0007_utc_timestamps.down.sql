@@ -0,0 +1,103 @@
+DROP TRIGGER item_images_delete_updated_at;
+DROP TRIGGER item_images_update_updated_at;
+DROP TRIGGER item_images_insert_updated_at;
+DROP TRIGGER items_updated_at;
+
+-- Back to timestamps in local time.
+ALTER TABLE items RENAME TO items_old;
+DROP INDEX items_status_updated_at;
+DROP INDEX items_seller_id_updated_at;
+
+CREATE TABLE items
+(
+    id          integer primary key autoincrement,
+    name        varchar(50),
+    price       integer,
+    description text,
+    category_id integer,
+    seller_id   integer,
+    image       blob, -- legacy, moved to the image store on startup (see item_images)
+    status      integer,
+    created_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    updated_at  text NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX items_status_updated_at ON items (status, updated_at, id);
+CREATE INDEX items_seller_id_updated_at ON items (seller_id, updated_at, id);
+
+INSERT INTO items (id, name, price, description, category_id, seller_id, image, status, created_at, updated_at)
+SELECT id, name, price, description, category_id, seller_id, image, status,
+       DATETIME(created_at, 'localtime'), DATETIME(updated_at, 'localtime')
+FROM items_old;
+
+DROP TABLE items_old;
+
+ALTER TABLE ledger_entries RENAME TO ledger_entries_old;
+DROP INDEX ledger_entries_user_id;
+
+CREATE TABLE ledger_entries
+(
+    id             integer primary key autoincrement,
+    transaction_id text    NOT NULL,
+    user_id        integer NOT NULL,
+    item_id        integer,
+    kind           text    NOT NULL,
+    amount         integer NOT NULL,
+    created_at     text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX ledger_entries_user_id ON ledger_entries (user_id);
+
+INSERT INTO ledger_entries (id, transaction_id, user_id, item_id, kind, amount, created_at)
+SELECT id, transaction_id, user_id, item_id, kind, amount, DATETIME(created_at, 'localtime')
+FROM ledger_entries_old;
+
+DROP TABLE ledger_entries_old;
+
+ALTER TABLE idempotency_keys RENAME TO idempotency_keys_old;
+
+CREATE TABLE idempotency_keys
+(
+    user_id         integer NOT NULL,
+    idempotency_key text    NOT NULL,
+    fingerprint     text    NOT NULL,
+    status_code     integer,
+    content_type    text,
+    body            blob,
+    created_at      text    NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, status_code, content_type, body, created_at)
+SELECT user_id, idempotency_key, fingerprint, status_code, content_type, body, DATETIME(created_at, 'localtime')
+FROM idempotency_keys_old;
+
+DROP TABLE idempotency_keys_old;
+
+ALTER TABLE item_status_history RENAME TO item_status_history_old;
+DROP INDEX item_status_history_item_id;
+
+CREATE TABLE item_status_history
+(
+    id          integer primary key autoincrement,
+    item_id     integer NOT NULL,
+    from_status integer NOT NULL,
+    to_status   integer NOT NULL,
+    created_at  text    NOT NULL DEFAULT (DATETIME('now', 'localtime'))
+);
+
+CREATE INDEX item_status_history_item_id ON item_status_history (item_id);
+
+INSERT INTO item_status_history (id, item_id, from_status, to_status, created_at)
+SELECT id, item_id, from_status, to_status, DATETIME(created_at, 'localtime')
+FROM item_status_history_old;
+
+DROP TABLE item_status_history_old;
+
+UPDATE sessions
+SET created_at   = DATETIME(created_at, 'localtime'),
+    last_used_at = DATETIME(last_used_at, 'localtime'),
+    expires_at   = DATETIME(expires_at, 'localtime'),
+    revoked_at   = DATETIME(revoked_at, 'localtime');
+
+UPDATE schema_migrations SET applied_at = DATETIME(applied_at, 'localtime');
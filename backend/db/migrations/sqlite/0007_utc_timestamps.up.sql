@@ -0,0 +1,123 @@
+-- Timestamps are stored in UTC as 'YYYY-MM-DDTHH:MM:SSZ' instead of local
+-- time. SQLite cannot change the default of a column, so the tables with
+-- timestamp defaults are recreated.
+ALTER TABLE items RENAME TO items_old;
+DROP INDEX items_status_updated_at;
+DROP INDEX items_seller_id_updated_at;
+
+CREATE TABLE items
+(
+    id          integer primary key autoincrement,
+    name        varchar(50),
+    price       integer,
+    description text,
+    category_id integer,
+    seller_id   integer,
+    image       blob, -- legacy, moved to the image store on startup (see item_images)
+    status      integer,
+    created_at  text NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+    updated_at  text NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX items_status_updated_at ON items (status, updated_at, id);
+CREATE INDEX items_seller_id_updated_at ON items (seller_id, updated_at, id);
+
+INSERT INTO items (id, name, price, description, category_id, seller_id, image, status, created_at, updated_at)
+SELECT id, name, price, description, category_id, seller_id, image, status,
+       strftime('%Y-%m-%dT%H:%M:%SZ', created_at, 'utc'), strftime('%Y-%m-%dT%H:%M:%SZ', updated_at, 'utc')
+FROM items_old;
+
+DROP TABLE items_old;
+
+ALTER TABLE ledger_entries RENAME TO ledger_entries_old;
+DROP INDEX ledger_entries_user_id;
+
+CREATE TABLE ledger_entries
+(
+    id             integer primary key autoincrement,
+    transaction_id text    NOT NULL,
+    user_id        integer NOT NULL,
+    item_id        integer,
+    kind           text    NOT NULL,
+    amount         integer NOT NULL,
+    created_at     text    NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX ledger_entries_user_id ON ledger_entries (user_id);
+
+INSERT INTO ledger_entries (id, transaction_id, user_id, item_id, kind, amount, created_at)
+SELECT id, transaction_id, user_id, item_id, kind, amount, strftime('%Y-%m-%dT%H:%M:%SZ', created_at, 'utc')
+FROM ledger_entries_old;
+
+DROP TABLE ledger_entries_old;
+
+ALTER TABLE idempotency_keys RENAME TO idempotency_keys_old;
+
+CREATE TABLE idempotency_keys
+(
+    user_id         integer NOT NULL,
+    idempotency_key text    NOT NULL,
+    fingerprint     text    NOT NULL,
+    status_code     integer,
+    content_type    text,
+    body            blob,
+    created_at      text    NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, status_code, content_type, body, created_at)
+SELECT user_id, idempotency_key, fingerprint, status_code, content_type, body, strftime('%Y-%m-%dT%H:%M:%SZ', created_at, 'utc')
+FROM idempotency_keys_old;
+
+DROP TABLE idempotency_keys_old;
+
+ALTER TABLE item_status_history RENAME TO item_status_history_old;
+DROP INDEX item_status_history_item_id;
+
+CREATE TABLE item_status_history
+(
+    id          integer primary key autoincrement,
+    item_id     integer NOT NULL,
+    from_status integer NOT NULL,
+    to_status   integer NOT NULL,
+    created_at  text    NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX item_status_history_item_id ON item_status_history (item_id);
+
+INSERT INTO item_status_history (id, item_id, from_status, to_status, created_at)
+SELECT id, item_id, from_status, to_status, strftime('%Y-%m-%dT%H:%M:%SZ', created_at, 'utc')
+FROM item_status_history_old;
+
+DROP TABLE item_status_history_old;
+
+UPDATE sessions
+SET created_at   = strftime('%Y-%m-%dT%H:%M:%SZ', created_at, 'utc'),
+    last_used_at = strftime('%Y-%m-%dT%H:%M:%SZ', last_used_at, 'utc'),
+    expires_at   = strftime('%Y-%m-%dT%H:%M:%SZ', expires_at, 'utc'),
+    revoked_at   = strftime('%Y-%m-%dT%H:%M:%SZ', revoked_at, 'utc');
+
+UPDATE schema_migrations SET applied_at = strftime('%Y-%m-%dT%H:%M:%SZ', applied_at, 'utc');
+
+-- Every update of an item that does not set updated_at itself, and every
+-- change to its images, bumps its updated_at.
+CREATE TRIGGER items_updated_at AFTER UPDATE ON items
+    WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE items SET updated_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now') WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER item_images_insert_updated_at AFTER INSERT ON item_images
+BEGIN
+    UPDATE items SET updated_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now') WHERE id = NEW.item_id;
+END;
+
+CREATE TRIGGER item_images_update_updated_at AFTER UPDATE ON item_images
+BEGIN
+    UPDATE items SET updated_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now') WHERE id = NEW.item_id;
+END;
+
+CREATE TRIGGER item_images_delete_updated_at AFTER DELETE ON item_images
+BEGIN
+    UPDATE items SET updated_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now') WHERE id = OLD.item_id;
+END;
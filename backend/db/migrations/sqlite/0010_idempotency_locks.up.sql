@@ -0,0 +1,3 @@
+-- The time until which a request in flight holds its key. A key still in
+-- flight after that is taken over by the next request with it.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until text;
@@ -0,0 +1,2 @@
+DROP INDEX items_seller_id_created_at;
+CREATE INDEX items_seller_id_updated_at ON items (seller_id, updated_at, id);
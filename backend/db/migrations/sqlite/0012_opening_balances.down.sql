@@ -0,0 +1 @@
+DELETE FROM ledger_entries WHERE kind = 'opening';
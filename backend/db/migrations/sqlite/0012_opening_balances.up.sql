@@ -0,0 +1,12 @@
+-- Balances that are not in the ledger, e.g. held before it existed, become an
+-- opening deposit from the external account, so that the ledger of every user
+-- sums to users.balance.
+INSERT INTO ledger_entries (transaction_id, user_id, kind, amount)
+SELECT 'opening-' || id, 0, 'opening', -amount
+FROM (SELECT id, COALESCE(balance, 0) - COALESCE((SELECT SUM(amount) FROM ledger_entries WHERE user_id = users.id), 0) AS amount FROM users) AS opening
+WHERE amount <> 0;
+
+INSERT INTO ledger_entries (transaction_id, user_id, kind, amount)
+SELECT 'opening-' || id, id, 'opening', amount
+FROM (SELECT id, COALESCE(balance, 0) - COALESCE((SELECT SUM(amount) FROM ledger_entries WHERE user_id = users.id), 0) AS amount FROM users) AS opening
+WHERE amount <> 0;
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+var (
+	ErrNotSeller       = newError(ErrPreconditionFailed, "only the seller can ship the item")
+	ErrNotBuyer        = newError(ErrPreconditionFailed, "only the buyer can receive the item")
+	ErrOrderNotPaid    = newError(ErrPreconditionFailed, "order is already shipped")
+	ErrOrderNotShipped = newError(ErrPreconditionFailed, "order is not shipped or already received")
+)
+
+type OrderService interface {
+	// GetOrdersByUserID returns the orders the user bought or sold, newest
+	// first.
+	GetOrdersByUserID(ctx context.Context, userID int64) ([]domain.Order, error)
+	// Ship marks the paid order of the item as shipped by its seller at now.
+	Ship(ctx context.Context, sellerID int64, itemID int64, trackingNumber string, now time.Time) (domain.Order, error)
+	// Receive completes the shipped order of the item for its buyer at now
+	// and pays the seller from escrow.
+	Receive(ctx context.Context, buyerID int64, itemID int64, now time.Time) (domain.Order, error)
+	// CompleteShippedOrders completes at now the orders shipped at or before
+	// shippedBefore as if their buyers received them. It returns the number
+	// of completed orders.
+	CompleteShippedOrders(ctx context.Context, now time.Time, shippedBefore time.Time) (int, error)
+}
+
+type OrderDBService struct {
+	*dbConn
+}
+
+func NewOrderService(db *sql.DB) OrderService {
+	return &OrderDBService{dbConn: newConn(db)}
+}
+
+const orderColumns = "id, item_id, buyer_id, seller_id, amount, status, tracking_number, created_at, shipped_at, completed_at"
+
+func scanOrder(row rowScanner, o *domain.Order) error {
+	return row.Scan(&o.ID, &o.ItemID, &o.BuyerID, &o.SellerID, &o.Amount, &o.Status, &o.TrackingNumber,
+		timestamp{&o.CreatedAt}, timestamp{&o.ShippedAt}, timestamp{&o.CompletedAt})
+}
+
+func (s *OrderDBService) GetOrdersByUserID(ctx context.Context, userID int64) ([]domain.Order, error) {
+	rows, err := s.QueryContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE buyer_id = ? OR seller_id = ? ORDER BY id DESC", userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []domain.Order
+	for rows.Next() {
+		var o domain.Order
+		if err := scanOrder(rows, &o); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func (s *OrderDBService) Ship(ctx context.Context, sellerID int64, itemID int64, trackingNumber string, now time.Time) (domain.Order, error) {
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	defer tx.Rollback()
+
+	order, err := lockOrder(ctx, tx, itemID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if order.SellerID != sellerID {
+		return domain.Order{}, ErrNotSeller
+	}
+	if order.Status != domain.OrderStatusPaid {
+		return domain.Order{}, ErrOrderNotPaid
+	}
+
+	order.Status, order.TrackingNumber, order.ShippedAt = domain.OrderStatusShipped, trackingNumber, now.UTC().Truncate(time.Second)
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = ?, tracking_number = ?, shipped_at = ? WHERE id = ?",
+		order.Status, order.TrackingNumber, domain.FormatTime(order.ShippedAt), order.ID); err != nil {
+		return domain.Order{}, err
+	}
+	if err := transitionItemStatus(ctx, tx, itemID, domain.ItemStatusShipped); err != nil {
+		return domain.Order{}, err
+	}
+
+	return order, tx.Commit()
+}
+
+func (s *OrderDBService) Receive(ctx context.Context, buyerID int64, itemID int64, now time.Time) (domain.Order, error) {
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	defer tx.Rollback()
+
+	order, err := lockOrder(ctx, tx, itemID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if order.BuyerID != buyerID {
+		return domain.Order{}, ErrNotBuyer
+	}
+	if order.Status != domain.OrderStatusShipped {
+		return domain.Order{}, ErrOrderNotShipped
+	}
+	if err := completeOrder(ctx, tx, &order, now); err != nil {
+		return domain.Order{}, err
+	}
+
+	return order, tx.Commit()
+}
+
+// CompleteShippedOrders completes every order in its own transaction, so that
+// a failure leaves the orders completed so far.
+func (s *OrderDBService) CompleteShippedOrders(ctx context.Context, now time.Time, shippedBefore time.Time) (int, error) {
+	rows, err := s.QueryContext(ctx, "SELECT item_id FROM orders WHERE status = ? AND shipped_at <= ?", domain.OrderStatusShipped, domain.FormatTime(shippedBefore))
+	if err != nil {
+		return 0, err
+	}
+	var itemIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		itemIDs = append(itemIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	completed := 0
+	for _, id := range itemIDs {
+		ok, err := s.completeShippedOrder(ctx, id, now, shippedBefore)
+		if err != nil {
+			return completed, err
+		}
+		if ok {
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+// completeShippedOrder completes the order of the item unless it was received
+// concurrently.
+func (s *OrderDBService) completeShippedOrder(ctx context.Context, itemID int64, now time.Time, shippedBefore time.Time) (bool, error) {
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	order, err := lockOrder(ctx, tx, itemID)
+	if err != nil {
+		return false, err
+	}
+	if order.Status != domain.OrderStatusShipped || order.ShippedAt.After(shippedBefore) {
+		return false, nil
+	}
+	if err := completeOrder(ctx, tx, &order, now); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// lockOrder locks the order of the item for the rest of the transaction.
+func lockOrder(ctx context.Context, tx *dbTx, itemID int64) (domain.Order, error) {
+	var order domain.Order
+	row := tx.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE item_id = ?"+tx.dialect.forUpdate(), itemID)
+	if err := scanOrder(row, &order); err != nil {
+		return domain.Order{}, notFound(err, "order")
+	}
+	return order, nil
+}
+
+// completeOrder marks the order as completed at now and pays the seller from
+// escrow.
+func completeOrder(ctx context.Context, tx *dbTx, order *domain.Order, now time.Time) error {
+	order.Status, order.CompletedAt = domain.OrderStatusCompleted, now.UTC().Truncate(time.Second)
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = ?, completed_at = ? WHERE id = ?",
+		order.Status, domain.FormatTime(order.CompletedAt), order.ID); err != nil {
+		return err
+	}
+	if err := transitionItemStatus(ctx, tx, order.ItemID, domain.ItemStatusCompleted); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET balance = balance + ? WHERE id = ?", order.Amount, order.SellerID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.Wrapf(NotFound("user"), "seller %d", order.SellerID)
+	}
+	return insertLedgerTransaction(ctx, tx, domain.LedgerKindPayout, order.ItemID, domain.EscrowAccountID, order.SellerID, order.Amount)
+}
+
+// insertOrder records the purchase of the item at now, whose price is in
+// escrow.
+func insertOrder(ctx context.Context, tx *dbTx, itemID int64, buyerID int64, sellerID int64, amount int64, now time.Time) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO orders (item_id, buyer_id, seller_id, amount, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		itemID, buyerID, sellerID, amount, domain.OrderStatusPaid, domain.FormatTime(now))
+	return err
+}
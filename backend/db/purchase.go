@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+var (
+	ErrItemNotOnSale       = newError(ErrPreconditionFailed, "item is not on sale")
+	ErrPurchaseOwnItem     = newError(ErrPreconditionFailed, "cannot purchase own item")
+	ErrInsufficientBalance = newError(ErrPreconditionFailed, "insufficient balance")
+	ErrItemReserved        = newError(ErrPreconditionFailed, "item is reserved by another buyer")
+)
+
+type PurchaseService interface {
+	// Purchase buys the item for the buyer and records its order. A reserved
+	// item can only be purchased by the buyer holding it, with the money
+	// already in escrow; an on sale item is reserved and bought at once. A
+	// hold that expired at now no longer reserves the item.
+	Purchase(ctx context.Context, buyerID int64, itemID int64, now time.Time) error
+	// Reserve holds the on sale item for the buyer from now until expiresAt,
+	// moving its price from the buyer to escrow.
+	Reserve(ctx context.Context, buyerID int64, itemID int64, now time.Time, expiresAt time.Time) (domain.Hold, error)
+	// ReleaseExpiredHolds puts the items whose hold expired at now back on
+	// sale and refunds their buyers. It returns the number of released holds.
+	ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error)
+}
+
+type PurchaseDBService struct {
+	*dbConn
+}
+
+func NewPurchaseService(db *sql.DB) PurchaseService {
+	return &PurchaseDBService{dbConn: newConn(db)}
+}
+
+// Purchase marks the item as sold out and records its order in a single
+// transaction, so either everything is applied or nothing is. The price is
+// moved from the buyer to escrow, unless the buyer reserved the item and it is
+// there already, and is paid to the seller once the order is completed.
+func (s *PurchaseDBService) Purchase(ctx context.Context, buyerID int64, itemID int64, now time.Time) error {
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	item, err := lockItemForSale(ctx, tx, itemID, now)
+	if err != nil {
+		return err
+	}
+	if item.UserID == buyerID {
+		return ErrPurchaseOwnItem
+	}
+
+	amount := item.Price
+	switch item.Status {
+	case domain.ItemStatusOnSale:
+		if err := withdraw(ctx, tx, buyerID, item.Price); err != nil {
+			return err
+		}
+		if err := insertLedgerTransaction(ctx, tx, domain.LedgerKindPurchase, itemID, buyerID, domain.EscrowAccountID, item.Price); err != nil {
+			return err
+		}
+	case domain.ItemStatusReserved:
+		if item.hold.BuyerID != buyerID {
+			return ErrItemReserved
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM item_holds WHERE item_id = ?", itemID); err != nil {
+			return err
+		}
+		amount = item.hold.Amount
+	default:
+		return ErrItemNotOnSale
+	}
+
+	if err := transitionItemStatus(ctx, tx, itemID, domain.ItemStatusSoldOut); err != nil {
+		return err
+	}
+	if err := insertOrder(ctx, tx, itemID, buyerID, item.UserID, amount, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PurchaseDBService) Reserve(ctx context.Context, buyerID int64, itemID int64, now time.Time, expiresAt time.Time) (domain.Hold, error) {
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+	defer tx.Rollback()
+
+	item, err := lockItemForSale(ctx, tx, itemID, now)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+	switch {
+	case item.Status == domain.ItemStatusReserved:
+		return domain.Hold{}, ErrItemReserved
+	case item.Status != domain.ItemStatusOnSale:
+		return domain.Hold{}, ErrItemNotOnSale
+	case item.UserID == buyerID:
+		return domain.Hold{}, ErrPurchaseOwnItem
+	}
+
+	if err := withdraw(ctx, tx, buyerID, item.Price); err != nil {
+		return domain.Hold{}, err
+	}
+	if err := transitionItemStatus(ctx, tx, itemID, domain.ItemStatusReserved); err != nil {
+		return domain.Hold{}, err
+	}
+	hold := domain.Hold{ItemID: itemID, BuyerID: buyerID, Amount: item.Price, ExpiresAt: expiresAt.UTC().Truncate(time.Second), CreatedAt: now.UTC().Truncate(time.Second)}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO item_holds (item_id, buyer_id, amount, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		hold.ItemID, hold.BuyerID, hold.Amount, domain.FormatTime(hold.ExpiresAt), domain.FormatTime(hold.CreatedAt)); err != nil {
+		return domain.Hold{}, err
+	}
+	if err := insertLedgerTransaction(ctx, tx, domain.LedgerKindHold, itemID, buyerID, domain.EscrowAccountID, item.Price); err != nil {
+		return domain.Hold{}, err
+	}
+
+	return hold, tx.Commit()
+}
+
+// ReleaseExpiredHolds releases every hold in its own transaction, so that a
+// failure leaves the holds released so far.
+func (s *PurchaseDBService) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.QueryContext(ctx, "SELECT item_id FROM item_holds WHERE expires_at <= ?", domain.FormatTime(now))
+	if err != nil {
+		return 0, err
+	}
+	var itemIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		itemIDs = append(itemIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, id := range itemIDs {
+		ok, err := s.releaseExpiredHold(ctx, id, now)
+		if err != nil {
+			return released, err
+		}
+		if ok {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// releaseExpiredHold releases the hold of the item unless it was purchased or
+// released concurrently.
+func (s *PurchaseDBService) releaseExpiredHold(ctx context.Context, itemID int64, now time.Time) (bool, error) {
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	item, err := lockItemForSale(ctx, tx, itemID, now)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return item.released, tx.Commit()
+}
+
+// itemForSale is an item locked by lockItemForSale.
+type itemForSale struct {
+	UserID int64
+	Price  int64
+	Status domain.ItemStatus
+	// hold is set if the item is reserved.
+	hold domain.Hold
+	// released is set if an expired hold was released.
+	released bool
+}
+
+// lockItemForSale locks the item for the rest of the transaction. If the hold
+// of a reserved item expired at now, it releases the hold first, so that the
+// item is on sale again.
+func lockItemForSale(ctx context.Context, tx *dbTx, itemID int64, now time.Time) (itemForSale, error) {
+	var item itemForSale
+	row := tx.QueryRowContext(ctx, "SELECT seller_id, price, status FROM items WHERE id = ?"+tx.dialect.forUpdate(), itemID)
+	if err := row.Scan(&item.UserID, &item.Price, &item.Status); err != nil {
+		return itemForSale{}, notFound(err, "item")
+	}
+	if item.Status != domain.ItemStatusReserved {
+		return item, nil
+	}
+
+	row = tx.QueryRowContext(ctx, "SELECT item_id, buyer_id, amount, expires_at, created_at FROM item_holds WHERE item_id = ?", itemID)
+	if err := row.Scan(&item.hold.ItemID, &item.hold.BuyerID, &item.hold.Amount, timestamp{&item.hold.ExpiresAt}, timestamp{&item.hold.CreatedAt}); err != nil {
+		return itemForSale{}, errors.Wrapf(err, "hold of reserved item %d", itemID)
+	}
+	if !item.hold.Expired(now) {
+		return item, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM item_holds WHERE item_id = ?", itemID); err != nil {
+		return itemForSale{}, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET balance = balance + ? WHERE id = ?", item.hold.Amount, item.hold.BuyerID); err != nil {
+		return itemForSale{}, err
+	}
+	if err := insertLedgerTransaction(ctx, tx, domain.LedgerKindRelease, itemID, domain.EscrowAccountID, item.hold.BuyerID, item.hold.Amount); err != nil {
+		return itemForSale{}, err
+	}
+	if err := transitionItemStatus(ctx, tx, itemID, domain.ItemStatusOnSale); err != nil {
+		return itemForSale{}, err
+	}
+	item.Status, item.hold, item.released = domain.ItemStatusOnSale, domain.Hold{}, true
+	return item, nil
+}
+
+// withdraw takes amount from the balance of the user, unless it is too low.
+func withdraw(ctx context.Context, tx *dbTx, userID int64, amount int64) error {
+	var balance int64
+	row := tx.QueryRowContext(ctx, "SELECT balance FROM users WHERE id = ?"+tx.dialect.forUpdate(), userID)
+	if err := row.Scan(&balance); err != nil {
+		return notFound(err, "user")
+	}
+	if balance < amount {
+		return ErrInsufficientBalance
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE users SET balance = balance - ? WHERE id = ?", amount, userID)
+	return err
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	// MaxRateLimitWindow is the longest window of a rate limit. Older hits
+	// are deleted.
+	MaxRateLimitWindow = 24 * time.Hour
+	// LoginFailureTTL is how long a failed login counts toward a lockout.
+	LoginFailureTTL = 24 * time.Hour
+)
+
+// RateLimitRepository keeps the state of the rate limits and the lockouts of
+// the authentication endpoints. Keys are chosen by the caller, e.g. per IP or
+// per account.
+type RateLimitRepository interface {
+	// AddHit records a hit on key at now if fewer than limit hits were
+	// recorded within window before now, and returns 0. Otherwise nothing is
+	// recorded and it returns how long until the oldest of them leaves the
+	// window.
+	AddHit(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (time.Duration, error)
+	// GetLockout returns the failures of key within LoginFailureTTL before
+	// now. It is zero if there are none.
+	GetLockout(ctx context.Context, key string, now time.Time) (domain.Lockout, error)
+	// AddFailure counts a failed login on key at now, and locks key as long
+	// as the policy says for the new number of failures.
+	AddFailure(ctx context.Context, key string, now time.Time, policy domain.LockoutPolicy) (domain.Lockout, error)
+	// ResetFailures forgets the failures of key after a successful login.
+	ResetFailures(ctx context.Context, key string) error
+}
+
+type RateLimitDBRepository struct {
+	*dbConn
+}
+
+func NewRateLimitRepository(db *sql.DB) RateLimitRepository {
+	return &RateLimitDBRepository{dbConn: newConn(db)}
+}
+
+// AddHit counts and inserts in one transaction. SQLite runs it alone, while
+// concurrent hits on PostgreSQL and MySQL may exceed the limit slightly.
+func (r *RateLimitDBRepository) AddHit(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (time.Duration, error) {
+	if window > MaxRateLimitWindow {
+		return 0, errors.Errorf("rate limit window %s is longer than %s", window, MaxRateLimitWindow)
+	}
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM rate_limit_hits WHERE hit_at <= ?", now.Add(-MaxRateLimitWindow).UnixMilli()); err != nil {
+		return 0, err
+	}
+
+	var count int
+	var oldest sql.NullInt64
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(*), MIN(hit_at) FROM rate_limit_hits WHERE rate_limit_key = ? AND hit_at > ?", key, now.Add(-window).UnixMilli())
+	if err := row.Scan(&count, &oldest); err != nil {
+		return 0, err
+	}
+	if count >= limit {
+		return time.UnixMilli(oldest.Int64).Add(window).Sub(now), nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO rate_limit_hits (rate_limit_key, hit_at) VALUES (?, ?)", key, now.UnixMilli()); err != nil {
+		return 0, err
+	}
+	return 0, tx.Commit()
+}
+
+func (r *RateLimitDBRepository) GetLockout(ctx context.Context, key string, now time.Time) (domain.Lockout, error) {
+	row := r.QueryRowContext(ctx, "SELECT failures, last_failure_at, locked_until FROM login_failures WHERE rate_limit_key = ? AND last_failure_at > ?", key, now.Add(-LoginFailureTTL).UnixMilli())
+	l, err := scanLockout(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Lockout{}, nil
+	}
+	return l, err
+}
+
+func (r *RateLimitDBRepository) AddFailure(ctx context.Context, key string, now time.Time, policy domain.LockoutPolicy) (domain.Lockout, error) {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Lockout{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM login_failures WHERE last_failure_at <= ? AND locked_until <= ?", now.Add(-LoginFailureTTL).UnixMilli(), now.UnixMilli()); err != nil {
+		return domain.Lockout{}, err
+	}
+	// The row is created first so that concurrent failures lock it.
+	if _, err := tx.ExecContext(ctx, tx.dialect.insertOrIgnore("INSERT INTO login_failures (rate_limit_key, failures, last_failure_at) VALUES (?, 0, 0)"), key); err != nil {
+		return domain.Lockout{}, err
+	}
+	l, err := scanLockout(tx.QueryRowContext(ctx, "SELECT failures, last_failure_at, locked_until FROM login_failures WHERE rate_limit_key = ?"+tx.dialect.forUpdate(), key))
+	if err != nil {
+		return domain.Lockout{}, err
+	}
+	if l.LastFailureAt.Before(now.Add(-LoginFailureTTL)) {
+		l.Failures = 0
+	}
+
+	l.Failures++
+	l.LastFailureAt = now
+	if d := policy.LockFor(l.Failures); d > 0 && now.Add(d).After(l.LockedUntil) {
+		l.LockedUntil = now.Add(d)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE login_failures SET failures = ?, last_failure_at = ?, locked_until = ? WHERE rate_limit_key = ?",
+		l.Failures, l.LastFailureAt.UnixMilli(), unixMilli(l.LockedUntil), key); err != nil {
+		return domain.Lockout{}, err
+	}
+	return l, tx.Commit()
+}
+
+func (r *RateLimitDBRepository) ResetFailures(ctx context.Context, key string) error {
+	_, err := r.ExecContext(ctx, "DELETE FROM login_failures WHERE rate_limit_key = ?", key)
+	return err
+}
+
+func scanLockout(row *sql.Row) (domain.Lockout, error) {
+	var failures int
+	var lastFailureAt, lockedUntil int64
+	if err := row.Scan(&failures, &lastFailureAt, &lockedUntil); err != nil {
+		return domain.Lockout{}, err
+	}
+	l := domain.Lockout{Failures: failures, LastFailureAt: time.UnixMilli(lastFailureAt)}
+	if lockedUntil != 0 {
+		l.LockedUntil = time.UnixMilli(lockedUntil)
+	}
+	return l, nil
+}
+
+// unixMilli stores the zero time as 0.
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
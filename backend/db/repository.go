@@ -3,222 +3,461 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
 )
 
+var (
+	ErrLoginNameTaken = newError(ErrConflict, "login name is already taken")
+	ErrEmailTaken     = newError(ErrConflict, "email is already registered")
+)
+
 type UserRepository interface {
+	// AddUser returns ErrLoginNameTaken or ErrEmailTaken if another user
+	// already has the login name or the email of the user.
 	AddUser(ctx context.Context, user domain.User) (int64, error)
 	GetUser(ctx context.Context, id int64) (domain.User, error)
-	UpdateBalance(ctx context.Context, id int64, balance int64) error
+	GetUserByLoginName(ctx context.Context, loginName string) (domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (domain.User, error)
 }
 
 type UserDBRepository struct {
-	*sql.DB
+	*dbConn
 }
 
 func NewUserRepository(db *sql.DB) UserRepository {
-	return &UserDBRepository{DB: db}
+	return &UserDBRepository{dbConn: newConn(db)}
 }
 
 func (r *UserDBRepository) AddUser(ctx context.Context, user domain.User) (int64, error) {
-	if _, err := r.ExecContext(ctx, "INSERT INTO users (name, password) VALUES (?, ?)", user.Name, user.Password); err != nil {
-		return 0, err
+	id, err := r.insert(ctx, "INSERT INTO users (name, password, login_name, email) VALUES (?, ?, ?, ?)", user.Name, user.Password, nullIfEmpty(user.LoginName), nullIfEmpty(user.Email))
+	if err == nil || !isUniqueViolation(err) {
+		return id, err
 	}
-	// TODO: if other insert query is executed at the same time, it might return wrong id
-	// http.StatusConflict(409) 既に同じIDがあった場合
-	row := r.QueryRowContext(ctx, "SELECT id FROM users WHERE rowid = LAST_INSERT_ROWID()")
 
-	var id int64
-	return id, row.Scan(&id)
+	// Find out which of the unique columns conflicts.
+	if user.Email != "" {
+		var n int
+		if err := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", user.Email).Scan(&n); err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			return 0, ErrEmailTaken
+		}
+	}
+	return 0, ErrLoginNameTaken
 }
 
+const userColumns = "id, name, password, balance, login_name, email"
+
 func (r *UserDBRepository) GetUser(ctx context.Context, id int64) (domain.User, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM users WHERE id = ?", id)
+	return scanUser(r.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (r *UserDBRepository) GetUserByLoginName(ctx context.Context, loginName string) (domain.User, error) {
+	return scanUser(r.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE login_name = ?", loginName))
+}
+
+func (r *UserDBRepository) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	return scanUser(r.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
 
+func scanUser(row *sql.Row) (domain.User, error) {
 	var user domain.User
-	return user, row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance)
+	var loginName, email sql.NullString
+	if err := row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance, &loginName, &email); err != nil {
+		return domain.User{}, notFound(err, "user")
+	}
+	user.LoginName, user.Email = loginName.String, email.String
+	return user, nil
 }
 
-func (r *UserDBRepository) UpdateBalance(ctx context.Context, id int64, balance int64) error {
-	if _, err := r.ExecContext(ctx, "UPDATE users SET balance = ? WHERE id = ?", balance, id); err != nil {
-		return err
+// nullIfEmpty stores an empty string as NULL, e.g. in columns whose non-empty
+// values are unique.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
 	}
-	return nil
+	return s
 }
 
 type ItemRepository interface {
 	AddItem(ctx context.Context, item domain.Item) (domain.Item, error)
 	AddCategory(ctx context.Context, categoryName domain.Category) (domain.Category, error)
-	GetItem(ctx context.Context, id int32) (domain.Item, error)
-	GetItemImage(ctx context.Context, id int32) ([]byte, error)
-	GetOnSaleItems(ctx context.Context) ([]domain.Item, error)
-	GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error)
+	GetItem(ctx context.Context, id int64) (domain.Item, error)
+	GetItemImage(ctx context.Context, id int64) (domain.ItemImage, error)
+	// List methods return the page of rows and the cursor of the next page,
+	// which is empty on the last page. Item lists are newest first.
+	GetOnSaleItems(ctx context.Context, page Page) ([]domain.ItemSummary, string, error)
+	GetItemsByUserID(ctx context.Context, userID int64, page Page) ([]domain.ItemSummary, string, error)
 	GetCategory(ctx context.Context, id int64) (domain.Category, error)
-	GetCategories(ctx context.Context) ([]domain.Category, error)
-	UpdateItemStatus(ctx context.Context, id int32, status domain.ItemStatus) error
+	GetCategories(ctx context.Context, page Page) ([]domain.Category, string, error)
+	UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error
+	GetItemStatusHistory(ctx context.Context, id int64) ([]domain.ItemStatusHistory, error)
 	UpdateItem(ctx context.Context, item domain.Item) error
-	UpdateItemImage(ctx context.Context, id int32, image []byte) error
-	SearchItems(ctx context.Context, name string) ([]domain.Item, error)
+	UpdateItemImage(ctx context.Context, id int64, image domain.ItemImage) error
+	// Images of an item are ordered by position; the first is its primary
+	// image.
+	GetItemImages(ctx context.Context, itemID int64) ([]domain.ItemImage, error)
+	AddItemImage(ctx context.Context, itemID int64, image domain.ItemImage) (domain.ItemImage, error)
+	DeleteItemImage(ctx context.Context, itemID int64, imageID int64) error
+	ReorderItemImages(ctx context.Context, itemID int64, imageIDs []int64) error
+	AddImageVariants(ctx context.Context, variants []domain.ImageVariant) error
+	GetImageVariant(ctx context.Context, imageKey string, size domain.ImageSize) (domain.ImageVariant, error)
+	SearchItems(ctx context.Context, params ItemSearchParams) ([]domain.Item, string, error)
 }
 
 type ItemDBRepository struct {
-	*sql.DB
+	*dbConn
+
+	// fts is whether SearchItems uses the FTS5 index.
+	fts bool
 }
 
 func NewItemRepository(db *sql.DB) ItemRepository {
-	return &ItemDBRepository{DB: db}
+	return &ItemDBRepository{dbConn: newConn(db), fts: searchIndexEnabled(db)}
+}
+
+// itemColumns are the columns scanned by scanItem. The legacy items.image
+// column is never selected; images live in the image store.
+const itemColumns = "items.id, items.name, items.price, items.description, items.category_id, items.seller_id, items.status, items.created_at, items.updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanItem(row rowScanner, item *domain.Item, extra ...interface{}) error {
+	dest := []interface{}{&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Status, timestamp{&item.CreatedAt}, timestamp{&item.UpdatedAt}}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// timestamp scans a timestamp column, stored as text in domain.TimeLayout.
+// NULL scans as the zero time.
+type timestamp struct {
+	t *time.Time
+}
+
+func (ts timestamp) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*ts.t = time.Time{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("unsupported timestamp type %T", src)
+	}
+	t, err := domain.ParseTime(s)
+	if err != nil {
+		return err
+	}
+	*ts.t = t
+	return nil
 }
 
 func (r *ItemDBRepository) AddItem(ctx context.Context, item domain.Item) (domain.Item, error) {
-	if _, err := r.ExecContext(ctx, "INSERT INTO items (name, price, description, category_id, seller_id, image, status) VALUES (?, ?, ?, ?, ?, ?, ?)", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Image, item.Status); err != nil {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Item{}, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.insert(ctx, "INSERT INTO items (name, price, description, category_id, seller_id, status) VALUES (?, ?, ?, ?, ?, ?)", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Status)
+	if err != nil {
 		return domain.Item{}, err
 	}
-	// TODO: if other insert query is executed at the same time, it might return wrong id
-	// http.StatusConflict(409) 既に同じIDがあった場合
-	row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE rowid = LAST_INSERT_ROWID()")
 
-	var res domain.Item
-	return res, row.Scan(&res.ID, &res.Name, &res.Price, &res.Description, &res.CategoryID, &res.UserID, &res.Image, &res.Status, &res.CreatedAt, &res.UpdatedAt)
+	if item.Image.Key != "" {
+		if err := setItemImage(ctx, tx, id, item.Image); err != nil {
+			return domain.Item{}, err
+		}
+	}
+
+	var added domain.Item
+	row := tx.QueryRowContext(ctx, "SELECT "+itemColumns+" FROM items WHERE id = ?", id)
+	if err := scanItem(row, &added); err != nil {
+		return domain.Item{}, err
+	}
+	added.Image = item.Image
+	return added, tx.Commit()
 }
 
 func (r *ItemDBRepository) AddCategory(ctx context.Context, categoryName domain.Category) (domain.Category, error) {
 	// Insert the new category into the database
-	if _, err := r.ExecContext(ctx, "INSERT INTO category (name) VALUES (?)", categoryName.Name); err != nil {
+	id, err := r.insert(ctx, "INSERT INTO category (name) VALUES (?)", categoryName.Name)
+	if err != nil {
 		return domain.Category{}, err
 	}
 
-	row := r.QueryRowContext(ctx, "SELECT * FROM category WHERE rowid = LAST_INSERT_ROWID()")
-
-	var res domain.Category
-	return res, row.Scan(&res.ID, &res.Name)
+	return domain.Category{ID: id, Name: categoryName.Name}, nil
 }
 
-func (r *ItemDBRepository) GetItem(ctx context.Context, id int32) (domain.Item, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE id = ?", id)
+func (r *ItemDBRepository) GetItem(ctx context.Context, id int64) (domain.Item, error) {
+	row := r.QueryRowContext(ctx, "SELECT "+itemColumns+", item_images.id, item_images.position, item_images.image_key, item_images.content_type FROM items LEFT JOIN item_images ON item_images.id = ("+primaryImageID+") WHERE items.id = ?", id)
 
 	var item domain.Item
-	return item, row.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt)
+	var imageID, position sql.NullInt64
+	var key, contentType sql.NullString
+	if err := scanItem(row, &item, &imageID, &position, &key, &contentType); err != nil {
+		return domain.Item{}, notFound(err, "item")
+	}
+	item.Image = domain.ItemImage{ID: imageID.Int64, Position: int(position.Int64), Key: key.String, ContentType: contentType.String}
+	return item, nil
+}
+
+// primaryImageID selects the id of the first image of the item in the outer
+// query.
+const primaryImageID = "SELECT id FROM item_images WHERE item_id = items.id ORDER BY position, id LIMIT 1"
+
+// GetItemImage returns the primary image of the item.
+func (r *ItemDBRepository) GetItemImage(ctx context.Context, id int64) (domain.ItemImage, error) {
+	row := r.QueryRowContext(ctx, "SELECT "+itemImageColumns+" FROM item_images WHERE item_id = ? ORDER BY position, id LIMIT 1", id)
+
+	var image domain.ItemImage
+	return image, notFound(scanItemImage(row, &image), "image")
+}
+
+func (r *ItemDBRepository) GetOnSaleItems(ctx context.Context, page Page) ([]domain.ItemSummary, string, error) {
+	return r.listItems(ctx, "items.status = ?", domain.ItemStatusOnSale, byUpdatedAt, page)
 }
 
-func (r *ItemDBRepository) GetItemImage(ctx context.Context, id int32) ([]byte, error) {
-	row := r.QueryRowContext(ctx, "SELECT image FROM items WHERE id = ?", id)
-	var image []byte
-	return image, row.Scan(&image)
+func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64, page Page) ([]domain.ItemSummary, string, error) {
+	return r.listItems(ctx, "items.seller_id = ?", userID, byCreatedAt, page)
 }
 
-func (r *ItemDBRepository) GetOnSaleItems(ctx context.Context) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE status = ? ORDER BY updated_at desc", domain.ItemStatusOnSale)
+// itemSummaryColumns are the columns scanned into a domain.ItemSummary, from
+// items joined with their category.
+const itemSummaryColumns = "items.id, items.name, items.price, items.category_id, category.name, items.seller_id, items.status, items.created_at, items.updated_at"
+
+// itemListOrder is the timestamp an item list is sorted by.
+type itemListOrder struct {
+	column string
+	time   func(domain.ItemSummary) time.Time
+}
+
+var (
+	byUpdatedAt = itemListOrder{"items.updated_at", func(item domain.ItemSummary) time.Time { return item.UpdatedAt }}
+	byCreatedAt = itemListOrder{"items.created_at", func(item domain.ItemSummary) time.Time { return item.CreatedAt }}
+)
+
+// listItems returns the page of the items matching the condition on arg,
+// newest first by the order, in a single query.
+func (r *ItemDBRepository) listItems(ctx context.Context, cond string, arg interface{}, order itemListOrder, page Page) ([]domain.ItemSummary, string, error) {
+	cur, err := decodeCursor(page.Cursor)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	query := "SELECT " + itemSummaryColumns + " FROM items LEFT JOIN category ON category.id = items.category_id WHERE " + cond
+	args := []interface{}{arg}
+	if cur != nil {
+		query += " AND (" + order.column + ", items.id) < (?, ?)"
+		args = append(args, cur.Time, cur.ID)
+	}
+	query += " ORDER BY " + order.column + " DESC, items.id DESC LIMIT ?"
+	args = append(args, page.limitArg())
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var items []domain.Item
+	var items []domain.ItemSummary
 	for rows.Next() {
-		var item domain.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
-			return nil, err
+		var item domain.ItemSummary
+		var categoryName sql.NullString
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.CategoryID, &categoryName, &item.UserID, &item.Status, timestamp{&item.CreatedAt}, timestamp{&item.UpdatedAt}); err != nil {
+			return nil, "", err
 		}
+		item.CategoryName = categoryName.String
 		items = append(items, item)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return items, nil
+	items, next := paginate(items, page, func(item domain.ItemSummary) pageCursor {
+		return pageCursor{Time: domain.FormatTime(order.time(item)), ID: item.ID}
+	})
+	return items, next, nil
+}
+
+func itemUpdatedAtCursor(item domain.Item) pageCursor {
+	return pageCursor{Time: domain.FormatTime(item.UpdatedAt), ID: item.ID}
 }
 
-func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE seller_id = ?", userID)
+func (r *ItemDBRepository) UpdateItemStatus(ctx context.Context, id int64, status domain.ItemStatus) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := transitionItemStatus(ctx, tx, id, status); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// transitionItemStatus moves the item to the given status if the state machine
+// allows it and records the transition in item_status_history.
+func transitionItemStatus(ctx context.Context, tx *dbTx, id int64, to domain.ItemStatus) error {
+	var from domain.ItemStatus
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM items WHERE id = ?", id).Scan(&from); err != nil {
+		return notFound(err, "item")
+	}
+	if err := from.ValidateTransition(to); err != nil {
+		return err
+	}
+
+	// The status condition guards against a concurrent transition of the same item.
+	res, err := tx.ExecContext(ctx, "UPDATE items SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.Wrapf(domain.ErrInvalidStatusTransition, "item %d was modified concurrently", id)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO item_status_history (item_id, from_status, to_status) VALUES (?, ?, ?)", id, from, to)
+	return err
+}
+
+func (r *ItemDBRepository) GetItemStatusHistory(ctx context.Context, id int64) ([]domain.ItemStatusHistory, error) {
+	rows, err := r.QueryContext(ctx, "SELECT id, item_id, from_status, to_status, created_at FROM item_status_history WHERE item_id = ? ORDER BY id", id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var items []domain.Item
+	var history []domain.ItemStatusHistory
 	for rows.Next() {
-		var item domain.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
+		var h domain.ItemStatusHistory
+		if err := rows.Scan(&h.ID, &h.ItemID, &h.FromStatus, &h.ToStatus, &h.CreatedAt); err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		history = append(history, h)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return items, nil
+	return history, nil
 }
 
-func (r *ItemDBRepository) UpdateItemStatus(ctx context.Context, id int32, status domain.ItemStatus) error {
-	if _, err := r.ExecContext(ctx, "UPDATE items SET status = ? WHERE id = ?", status, id); err != nil {
+
+func (r *ItemDBRepository) UpdateItem(ctx context.Context, item domain.Item) error {
+	_, err := r.ExecContext(ctx, "UPDATE items SET name=?, price=?, description=?, category_id=?, seller_id=?, status=? WHERE id=?", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Status, item.ID)
+	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (r *ItemDBRepository) UpdateItemImage(ctx context.Context, id int64, image domain.ItemImage) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-func (r *ItemDBRepository) UpdateItem(ctx context.Context, item domain.Item) error {
-	_, err := r.ExecContext(ctx, "UPDATE items SET name=?, price=?, description=?, category_id=?, seller_id=?, status=? WHERE id=?", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Status, item.ID)
+	if err := setItemImage(ctx, tx, id, image); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setItemImage replaces the primary image of the item, or adds it if the item
+// has no image, and clears the legacy blob.
+func setItemImage(ctx context.Context, tx *dbTx, id int64, image domain.ItemImage) error {
+	var imageID int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM item_images WHERE item_id = ? ORDER BY position, id LIMIT 1", id).Scan(&imageID)
+	switch err {
+	case nil:
+		_, err = tx.ExecContext(ctx, "UPDATE item_images SET image_key = ?, content_type = ? WHERE id = ?", image.Key, image.ContentType, imageID)
+	case sql.ErrNoRows:
+		_, err = tx.ExecContext(ctx, "INSERT INTO item_images (item_id, position, image_key, content_type) VALUES (?, 0, ?, ?)", id, image.Key, image.ContentType)
+	}
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = tx.ExecContext(ctx, "UPDATE items SET image = NULL WHERE id = ?", id)
+	return err
 }
 
-func (r *ItemDBRepository) UpdateItemImage(ctx context.Context, id int32, image []byte) error {
-	_, err := r.ExecContext(ctx, "UPDATE items SET image=? WHERE id=?", image, id)
+// AddImageVariants records the resized variants of an image. Images are
+// content addressed, so the variants of a key never change and existing rows
+// are kept.
+func (r *ItemDBRepository) AddImageVariants(ctx context.Context, variants []domain.ImageVariant) error {
+	tx, err := r.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	for _, v := range variants {
+		if _, err := tx.ExecContext(ctx, tx.dialect.insertOrIgnore("INSERT INTO image_variants (image_key, size, variant_key, content_type, width, height) VALUES (?, ?, ?, ?, ?, ?)"), v.ImageKey, v.Size, v.Key, v.ContentType, v.Width, v.Height); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *ItemDBRepository) GetImageVariant(ctx context.Context, imageKey string, size domain.ImageSize) (domain.ImageVariant, error) {
+	row := r.QueryRowContext(ctx, "SELECT image_key, size, variant_key, content_type, width, height FROM image_variants WHERE image_key = ? AND size = ?", imageKey, size)
+
+	var v domain.ImageVariant
+	return v, notFound(row.Scan(&v.ImageKey, &v.Size, &v.Key, &v.ContentType, &v.Width, &v.Height), "image variant")
 }
 
 func (r *ItemDBRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
 	row := r.QueryRowContext(ctx, "SELECT * FROM category WHERE id = ?", id)
 
 	var cat domain.Category
-	return cat, row.Scan(&cat.ID, &cat.Name)
+	return cat, notFound(row.Scan(&cat.ID, &cat.Name), "category")
 }
 
-func (r *ItemDBRepository) GetCategories(ctx context.Context) ([]domain.Category, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM category")
+func (r *ItemDBRepository) GetCategories(ctx context.Context, page Page) ([]domain.Category, string, error) {
+	cur, err := decodeCursor(page.Cursor)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	defer rows.Close()
 
-	var cats []domain.Category
-	for rows.Next() {
-		var cat domain.Category
-		if err := rows.Scan(&cat.ID, &cat.Name); err != nil {
-			return nil, err
-		}
-		cats = append(cats, cat)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	query := "SELECT * FROM category"
+	var args []interface{}
+	if cur != nil {
+		query += " WHERE id > ?"
+		args = append(args, cur.ID)
 	}
-	return cats, nil
-}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, page.limitArg())
 
-func (r *ItemDBRepository) SearchItems(ctx context.Context, name string) ([]domain.Item, error) {
-	query := "SELECT * FROM items WHERE name LIKE ?"
-	rows, err := r.QueryContext(ctx, query, "%"+name+"%")
+	rows, err := r.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var items []domain.Item
+	var cats []domain.Category
 	for rows.Next() {
-		var item domain.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
-			return nil, err
+		var cat domain.Category
+		if err := rows.Scan(&cat.ID, &cat.Name); err != nil {
+			return nil, "", err
 		}
-		items = append(items, item)
+		cats = append(cats, cat)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return items, nil
+	cats, next := paginate(cats, page, func(cat domain.Category) pageCursor {
+		return pageCursor{ID: cat.ID}
+	})
+	return cats, next, nil
 }
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+type ItemSearchSort string
+
+const (
+	ItemSearchSortRelevance ItemSearchSort = "relevance"
+	ItemSearchSortNewest    ItemSearchSort = "newest"
+	ItemSearchSortPriceAsc  ItemSearchSort = "price_asc"
+	ItemSearchSortPriceDesc ItemSearchSort = "price_desc"
+)
+
+// minFTSKeywordLen is the shortest keyword the trigram tokenizer can match.
+const minFTSKeywordLen = 3
+
+// ItemSearchParams filters SearchItems. Zero values mean no filter, except
+// Statuses which must not be empty.
+type ItemSearchParams struct {
+	Keyword    string
+	CategoryID int64
+	MinPrice   int64
+	MaxPrice   int64
+	Statuses   []domain.ItemStatus
+	Sort       ItemSearchSort
+	Page       Page
+}
+
+// SearchItems finds items whose name or description contains the keyword.
+// With FTS5 the results are ranked by bm25, weighting name matches higher than
+// description matches; otherwise they fall back to a LIKE scan.
+// Pages of price and newest orderings use keyset pagination; relevance ranks
+// are not comparable across queries, so its cursor holds an offset instead.
+func (r *ItemDBRepository) SearchItems(ctx context.Context, params ItemSearchParams) ([]domain.Item, string, error) {
+	cur, err := decodeCursor(params.Page.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if cur == nil {
+		cur = &pageCursor{}
+	}
+	first := params.Page.Cursor == ""
+
+	var (
+		from   = "items"
+		where  []string
+		args   []interface{}
+		order  string
+		offset int
+		key    func(domain.Item) pageCursor
+	)
+
+	useFTS := r.fts && utf8.RuneCountInString(params.Keyword) >= minFTSKeywordLen
+	switch {
+	case useFTS:
+		from = "items_fts JOIN items ON items.id = items_fts.rowid"
+		where = append(where, "items_fts MATCH ?")
+		args = append(args, ftsPhrase(params.Keyword))
+	case params.Keyword != "":
+		like := r.dialect.like()
+		where = append(where, "(items.name "+like+" ? ESCAPE '!' OR items.description "+like+" ? ESCAPE '!')")
+		pattern := "%" + escapeLike(params.Keyword) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	if params.CategoryID != 0 {
+		where = append(where, "items.category_id = ?")
+		args = append(args, params.CategoryID)
+	}
+	if params.MinPrice != 0 {
+		where = append(where, "items.price >= ?")
+		args = append(args, params.MinPrice)
+	}
+	if params.MaxPrice != 0 {
+		where = append(where, "items.price <= ?")
+		args = append(args, params.MaxPrice)
+	}
+	if len(params.Statuses) > 0 {
+		where = append(where, "items.status IN (?"+strings.Repeat(", ?", len(params.Statuses)-1)+")")
+		for _, status := range params.Statuses {
+			args = append(args, status)
+		}
+	}
+
+	priceCursor := func(item domain.Item) pageCursor {
+		return pageCursor{Price: item.Price, ID: item.ID}
+	}
+	switch params.Sort {
+	case ItemSearchSortPriceAsc:
+		if !first {
+			where = append(where, "(items.price, items.id) > (?, ?)")
+			args = append(args, cur.Price, cur.ID)
+		}
+		order = "items.price ASC, items.id ASC"
+		key = priceCursor
+	case ItemSearchSortPriceDesc:
+		if !first {
+			where = append(where, "(items.price, items.id) < (?, ?)")
+			args = append(args, cur.Price, cur.ID)
+		}
+		order = "items.price DESC, items.id DESC"
+		key = priceCursor
+	case ItemSearchSortNewest:
+		if !first {
+			where = append(where, "(items.updated_at, items.id) < (?, ?)")
+			args = append(args, cur.Time, cur.ID)
+		}
+		order = "items.updated_at DESC, items.id DESC"
+		key = itemUpdatedAtCursor
+	default:
+		offset = cur.Offset
+		key = func(domain.Item) pageCursor {
+			return pageCursor{Offset: offset + params.Page.Limit}
+		}
+		if useFTS {
+			order = "bm25(items_fts, 10.0, 1.0) ASC, items.id DESC"
+		} else {
+			order = "items.name " + r.dialect.like() + " ? ESCAPE '!' DESC, items.updated_at DESC, items.id DESC"
+			args = append(args, "%"+escapeLike(params.Keyword)+"%")
+		}
+	}
+
+	query := "SELECT " + itemColumns + " FROM " + from
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + order + " LIMIT ? OFFSET ?"
+	args = append(args, params.Page.limitArg(), offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var items []domain.Item
+	for rows.Next() {
+		var item domain.Item
+		if err := scanItem(rows, &item); err != nil {
+			return nil, "", err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	items, next := paginate(items, params.Page, key)
+	return items, next, nil
+}
+
+// ftsPhrase quotes the keyword as a single FTS5 phrase so that operators in
+// user input are matched literally.
+func ftsPhrase(keyword string) string {
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(keyword, `"`, `""`))
+}
+
+// escapeLike escapes the wildcards of s for LIKE ... ESCAPE '!'. A backslash
+// would itself need escaping in MySQL string literals.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SeedPassword is the password of every seeded user.
+const SeedPassword = "password"
+
+// SeedConfig sizes the data generated by Seed. The same config always
+// generates the same data.
+type SeedConfig struct {
+	Users int
+	Items int
+	// RandSeed seeds the choice of sellers, prices and statuses.
+	RandSeed int64
+}
+
+var DefaultSeedConfig = SeedConfig{Users: 10, Items: 20, RandSeed: 1}
+
+// SeedConfigFromEnv returns DefaultSeedConfig with the counts overridden by
+// SEED_USERS and SEED_ITEMS.
+func SeedConfigFromEnv() (SeedConfig, error) {
+	config := DefaultSeedConfig
+	for name, n := range map[string]*int{"SEED_USERS": &config.Users, "SEED_ITEMS": &config.Items} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return SeedConfig{}, fmt.Errorf("%s must be a non-negative integer: %q", name, v)
+		}
+		*n = i
+	}
+	if config.Items > 0 && config.Users == 0 {
+		return SeedConfig{}, errors.New("SEED_ITEMS requires at least one user")
+	}
+	return config, nil
+}
+
+var seedCategories = []string{"food", "fashion", "furniture"}
+
+var seedUserNames = []string{"Alice", "Bob", "Charlie", "David", "Eve", "Frank", "Grace", "Henry", "Isabella", "Jack"}
+
+type seedItem struct {
+	Name        string
+	Price       int64
+	Description string
+	CategoryID  int64
+	Color       color.RGBA
+}
+
+// seedItems are the templates of the generated items. Items after the first
+// len(seedItems) reuse them with a number appended to the name.
+var seedItems = []seedItem{
+	{"Broccoli", 150, "A fresh and flavorful broccoli with tender stems.", 1, color.RGBA{0x3a, 0x7d, 0x2c, 0xff}},
+	{"Cabbage", 100, "A sweet and tender cabbage that is delicious both raw and cooked.", 1, color.RGBA{0xa8, 0xd5, 0x8f, 0xff}},
+	{"Cucumber", 80, "A refreshing cucumber with a crisp texture, perfect for salads or smoothies.", 1, color.RGBA{0x4f, 0x8a, 0x3b, 0xff}},
+	{"Carrot", 120, "A sweet and crunchy carrot that is great for salads and stews.", 1, color.RGBA{0xed, 0x91, 0x21, 0xff}},
+	{"Lettuce", 80, "A crisp and juicy lettuce that is perfect for salads or stir-fry dishes.", 1, color.RGBA{0x9b, 0xcf, 0x53, 0xff}},
+	{"Onion", 70, "A sweet and mild onion with low levels of spiciness, great for soups and stir-fries.", 1, color.RGBA{0xd9, 0xb3, 0x8c, 0xff}},
+	{"Tomato", 200, "A juicy tomato with a well-balanced combination of sweet and sour flavors, perfect for salads and pastas.", 1, color.RGBA{0xe0, 0x32, 0x1f, 0xff}},
+	{"Sweet potato", 150, "A sweet and moist sweet potato that is delicious both baked and boiled.", 1, color.RGBA{0x8e, 0x3b, 0x5f, 0xff}},
+	{"Turnip", 120, "A mild and refreshing turnip with a clean, crisp texture that is great for salads and stews.", 1, color.RGBA{0xf2, 0xe6, 0xf0, 0xff}},
+	{"Bell pepper", 80, "A juicy bell pepper with a refreshing taste that is perfect for stir-fries and meat dishes.", 1, color.RGBA{0xf4, 0xc4, 0x30, 0xff}},
+	{"T-shirt", 1500, "A soft cotton T-shirt that is comfortable for everyday wear.", 2, color.RGBA{0xf5, 0xf5, 0xf5, 0xff}},
+	{"Jeans", 4000, "Classic straight jeans made of durable denim.", 2, color.RGBA{0x2b, 0x4c, 0x7e, 0xff}},
+	{"Sneakers", 6000, "Lightweight sneakers with cushioned soles for walking all day.", 2, color.RGBA{0xcc, 0x33, 0x33, 0xff}},
+	{"Jacket", 9000, "A warm and water-resistant jacket for cold and rainy days.", 2, color.RGBA{0x33, 0x33, 0x33, 0xff}},
+	{"Cap", 1200, "A casual cap with an adjustable strap.", 2, color.RGBA{0x1f, 0x6f, 0x8b, 0xff}},
+	{"Sofa", 16000, "A comfortable and stylish sofa that is perfect for relaxing in the living room.", 3, color.RGBA{0x8b, 0x5a, 0x2b, 0xff}},
+	{"Bed", 24000, "A sturdy and comfortable bed with a supportive mattress that is perfect for a good night's sleep.", 3, color.RGBA{0xc8, 0xb0, 0x90, 0xff}},
+	{"Chair", 4000, "A lightweight and durable chair that can be used in any room of the house.", 3, color.RGBA{0xa0, 0x6b, 0x3c, 0xff}},
+	{"Table", 10000, "A versatile and practical table that is perfect for meals, work, or entertainment.", 3, color.RGBA{0x7a, 0x4e, 0x2d, 0xff}},
+	{"Desk", 14000, "A spacious and stylish desk that is perfect for a home office or workspace.", 3, color.RGBA{0x5c, 0x40, 0x33, 0xff}},
+	{"Bookshelf", 6000, "A sturdy and practical bookshelf that can hold all your favorite books and decorative items.", 3, color.RGBA{0x96, 0x6f, 0x51, 0xff}},
+	{"Dresser", 18000, "A stylish and spacious dresser with ample storage space for clothes and accessories.", 3, color.RGBA{0xb5, 0x8b, 0x63, 0xff}},
+	{"Cabinet", 12000, "A versatile and practical cabinet that can be used to store and display various items.", 3, color.RGBA{0x6e, 0x55, 0x44, 0xff}},
+	{"Coffee Table", 8000, "A stylish and practical coffee table that is perfect for the living room or entertainment area.", 3, color.RGBA{0x4a, 0x37, 0x28, 0xff}},
+	{"TV Stand", 7000, "A sturdy and practical TV stand that can hold your television and other entertainment devices.", 3, color.RGBA{0x20, 0x20, 0x20, 0xff}},
+}
+
+// seedTime is the creation time of the first seeded row. Each following item
+// is created one second later so that lists have a stable order.
+var seedTime = time.Date(2023, 5, 16, 19, 57, 29, 0, time.UTC)
+
+// Seed fills the empty tables with users, categories and items. Item images
+// are stored with put.
+func Seed(ctx context.Context, db *sql.DB, config SeedConfig, put PutImageFunc) error {
+	password, err := bcrypt.GenerateFromPassword([]byte(SeedPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	// Images are processed once per template, outside of the transaction.
+	images := make([]domain.ItemImage, len(seedItems))
+	for i := 0; i < len(seedItems) && i < config.Items; i++ {
+		data, err := seedImage(seedItems[i])
+		if err != nil {
+			return err
+		}
+		if images[i], err = put(ctx, data); err != nil {
+			return errors.Wrapf(err, "failed to store image of %s", seedItems[i].Name)
+		}
+	}
+
+	tx, err := newConn(db).BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for s := domain.ItemStatusInitial; s <= domain.ItemStatusCancelled; s++ {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO status (id, name) VALUES (?, ?)", s, s.String()); err != nil {
+			return err
+		}
+	}
+	// The ids are generated by the database, so that its sequences continue
+	// after them.
+	categoryIDs := make(map[int64]int64, len(seedCategories))
+	for i, name := range seedCategories {
+		id, err := tx.insert(ctx, "INSERT INTO category (name) VALUES (?)", name)
+		if err != nil {
+			return err
+		}
+		categoryIDs[int64(i+1)] = id
+	}
+
+	for i := 0; i < config.Users; i++ {
+		name := fmt.Sprintf("User%d", i+1)
+		if i < len(seedUserNames) {
+			name = seedUserNames[i]
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO users (name, password, login_name) VALUES (?, ?, ?)", name, password, strings.ToLower(name)); err != nil {
+			return err
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(config.RandSeed))
+	for i := 0; i < config.Items; i++ {
+		tmpl := seedItems[i%len(seedItems)]
+		name, price := tmpl.Name, tmpl.Price
+		if n := i / len(seedItems); n > 0 {
+			name = fmt.Sprintf("%s %d", tmpl.Name, n+1)
+			// Vary the price by up to ±20%.
+			price += price * int64(rnd.Intn(41)-20) / 100
+		}
+		createdAt := domain.FormatTime(seedTime.Add(time.Duration(i) * time.Second))
+
+		id, err := tx.insert(ctx, "INSERT INTO items (name, price, description, category_id, seller_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			name, price, tmpl.Description, categoryIDs[tmpl.CategoryID], rnd.Intn(config.Users)+1, seedStatus(rnd), createdAt, createdAt)
+		if err != nil {
+			return err
+		}
+		image := images[i%len(seedItems)]
+		if _, err := tx.ExecContext(ctx, "INSERT INTO item_images (item_id, position, image_key, content_type) VALUES (?, 0, ?, ?)", id, image.Key, image.ContentType); err != nil {
+			return err
+		}
+	}
+	// Adding the images bumped updated_at.
+	if _, err := tx.ExecContext(ctx, "UPDATE items SET updated_at = created_at"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// seedStatus picks the status of an item: mostly on sale, the rest drafts or
+// sold out.
+func seedStatus(rnd *rand.Rand) domain.ItemStatus {
+	switch n := rnd.Intn(10); {
+	case n < 7:
+		return domain.ItemStatusOnSale
+	case n < 9:
+		return domain.ItemStatusInitial
+	default:
+		return domain.ItemStatusSoldOut
+	}
+}
+
+// seedImage draws a placeholder image of the item: a disc of its color on a
+// tinted background.
+func seedImage(item seedItem) ([]byte, error) {
+	const size = 240
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	bg := color.RGBA{
+		R: uint8(0xff - (0xff-int(item.Color.R))/4),
+		G: uint8(0xff - (0xff-int(item.Color.G))/4),
+		B: uint8(0xff - (0xff-int(item.Color.B))/4),
+		A: 0xff,
+	}
+	const c, r = size / 2, size * 3 / 8
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if (x-c)*(x-c)+(y-c)*(y-c) <= r*r {
+				img.SetRGBA(x, y, item.Color)
+			} else {
+				img.SetRGBA(x, y, bg)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// SessionTTL is how long a session lasts without being refreshed.
+const SessionTTL = 30 * 24 * time.Hour
+
+var ErrInvalidRefreshToken = newError(ErrUnauthenticated, "invalid refresh token")
+
+type SessionRepository interface {
+	// AddSession starts a session whose refresh token has the given hash.
+	AddSession(ctx context.Context, userID int64, refreshTokenHash string, userAgent string) (domain.Session, error)
+	GetSession(ctx context.Context, id int64) (domain.Session, error)
+	// RotateRefreshToken replaces the refresh token of the active session
+	// holding oldHash and extends the session. It returns
+	// ErrInvalidRefreshToken if no active session holds oldHash, so a refresh
+	// token is accepted only once.
+	RotateRefreshToken(ctx context.Context, oldHash string, newHash string) (domain.Session, error)
+	// GetActiveSessionsByUserID returns the active sessions of the user, most
+	// recently used first.
+	GetActiveSessionsByUserID(ctx context.Context, userID int64) ([]domain.Session, error)
+	// RevokeSession ends the session. Revoking it again is a no-op.
+	RevokeSession(ctx context.Context, id int64) error
+}
+
+type SessionDBRepository struct {
+	*dbConn
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &SessionDBRepository{dbConn: newConn(db)}
+}
+
+const sessionColumns = "id, user_id, refresh_token_hash, user_agent, created_at, last_used_at, expires_at, revoked_at"
+
+func (r *SessionDBRepository) AddSession(ctx context.Context, userID int64, refreshTokenHash string, userAgent string) (domain.Session, error) {
+	now := time.Now()
+	s := domain.Session{
+		UserID:           userID,
+		RefreshTokenHash: refreshTokenHash,
+		UserAgent:        userAgent,
+		CreatedAt:        domain.FormatTime(now),
+		LastUsedAt:       domain.FormatTime(now),
+		ExpiresAt:        domain.FormatTime(now.Add(SessionTTL)),
+	}
+	id, err := r.insert(ctx, "INSERT INTO sessions (user_id, refresh_token_hash, user_agent, created_at, last_used_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		s.UserID, s.RefreshTokenHash, s.UserAgent, s.CreatedAt, s.LastUsedAt, s.ExpiresAt)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	s.ID = id
+	return s, nil
+}
+
+func (r *SessionDBRepository) GetSession(ctx context.Context, id int64) (domain.Session, error) {
+	row := r.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id)
+	s, err := scanSession(row)
+	return s, notFound(err, "session")
+}
+
+func (r *SessionDBRepository) RotateRefreshToken(ctx context.Context, oldHash string, newHash string) (domain.Session, error) {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, "UPDATE sessions SET refresh_token_hash = ?, last_used_at = ?, expires_at = ? WHERE refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ?",
+		newHash, domain.FormatTime(now), domain.FormatTime(now.Add(SessionTTL)), oldHash, domain.FormatTime(now))
+	if err != nil {
+		return domain.Session{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return domain.Session{}, err
+	} else if n == 0 {
+		return domain.Session{}, ErrInvalidRefreshToken
+	}
+
+	s, err := scanSession(tx.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE refresh_token_hash = ?", newHash))
+	if err != nil {
+		return domain.Session{}, err
+	}
+	return s, tx.Commit()
+}
+
+func (r *SessionDBRepository) GetActiveSessionsByUserID(ctx context.Context, userID int64) ([]domain.Session, error) {
+	rows, err := r.QueryContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_used_at DESC, id DESC",
+		userID, domain.FormatTime(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionDBRepository) RevokeSession(ctx context.Context, id int64) error {
+	res, err := r.ExecContext(ctx, "UPDATE sessions SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?", domain.FormatTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return NotFound("session")
+	}
+	return nil
+}
+
+func scanSession(row interface{ Scan(...interface{}) error }) (domain.Session, error) {
+	var s domain.Session
+	var revokedAt sql.NullString
+	if err := row.Scan(&s.ID, &s.UserID, &s.RefreshTokenHash, &s.UserAgent, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &revokedAt); err != nil {
+		return domain.Session{}, err
+	}
+	s.RevokedAt = revokedAt.String
+	return s, nil
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// Hold reserves an on sale item for a buyer until ExpiresAt. Amount, the
+// price of the item when it was reserved, is kept in escrow meanwhile.
+type Hold struct {
+	ItemID    int64
+	BuyerID   int64
+	Amount    int64
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Expired reports whether the hold has expired at now.
+func (h Hold) Expired(now time.Time) bool {
+	return !now.Before(h.ExpiresAt)
+}
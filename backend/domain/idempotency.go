@@ -0,0 +1,17 @@
+package domain
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header. A record without a status code is still in flight.
+type IdempotencyRecord struct {
+	UserID      int64
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   string
+}
+
+func (r IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
@@ -1,27 +1,151 @@
 package domain
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 type ItemStatus int
 
 const (
 	ItemStatusInitial ItemStatus = iota
 	ItemStatusOnSale
 	ItemStatusSoldOut
+	ItemStatusReserved
+	ItemStatusShipped
+	ItemStatusCompleted
+	ItemStatusWithdrawn
+	ItemStatusCancelled
 )
 
+var ErrInvalidStatusTransition = errors.New("invalid item status transition")
+
+var itemStatusNames = map[ItemStatus]string{
+	ItemStatusInitial:   "initial",
+	ItemStatusOnSale:    "on_sale",
+	ItemStatusSoldOut:   "sold_out",
+	ItemStatusReserved:  "reserved",
+	ItemStatusShipped:   "shipped",
+	ItemStatusCompleted: "completed",
+	ItemStatusWithdrawn: "withdrawn",
+	ItemStatusCancelled: "cancelled",
+}
+
+// itemStatusTransitions lists the statuses an item may move to from each
+// status. The happy path is initial (draft) -> on sale -> reserved -> sold out
+// -> shipped -> completed; an on sale item may also be sold out directly.
+var itemStatusTransitions = map[ItemStatus][]ItemStatus{
+	ItemStatusInitial:   {ItemStatusOnSale, ItemStatusWithdrawn},
+	ItemStatusOnSale:    {ItemStatusReserved, ItemStatusSoldOut, ItemStatusWithdrawn},
+	ItemStatusReserved:  {ItemStatusSoldOut, ItemStatusOnSale, ItemStatusCancelled},
+	ItemStatusSoldOut:   {ItemStatusShipped, ItemStatusCancelled},
+	ItemStatusShipped:   {ItemStatusCompleted},
+	ItemStatusWithdrawn: {ItemStatusOnSale},
+}
+
+func (s ItemStatus) String() string {
+	if name, ok := itemStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("ItemStatus(%d)", int(s))
+}
+
+// ParseItemStatus returns the status with the given name, e.g. "on_sale".
+func ParseItemStatus(name string) (ItemStatus, error) {
+	for status, n := range itemStatusNames {
+		if n == name {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown item status: %q", name)
+}
+
+func (s ItemStatus) CanTransitionTo(next ItemStatus) bool {
+	for _, to := range itemStatusTransitions[s] {
+		if to == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns ErrInvalidStatusTransition if the item may not
+// move from s to next.
+func (s ItemStatus) ValidateTransition(next ItemStatus) error {
+	if !s.CanTransitionTo(next) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, s, next)
+	}
+	return nil
+}
+
 type Item struct {
-	ID          int32
+	ID          int64
 	Name        string
 	Price       int64
 	Description string
 	CategoryID  int64
 	UserID      int64
-	Image       []byte
+	Image       ItemImage
 	Status      ItemStatus
-	CreatedAt   string
-	UpdatedAt   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ItemSummary is an item as lists show it, with the name of its category.
+// CategoryName is empty if the category does not exist.
+type ItemSummary struct {
+	ID           int64
+	Name         string
+	Price        int64
+	CategoryID   int64
+	CategoryName string
+	UserID       int64
+	Status       ItemStatus
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// MaxItemImages is the largest number of images an item can have.
+const MaxItemImages = 10
+
+// ItemImage refers to an image in the image store. Position orders the
+// images of an item, starting from 0 for the primary image.
+type ItemImage struct {
+	ID          int64
+	Position    int
+	Key         string
+	ContentType string
+}
+
+// ImageSize selects the full size image or one of its resized variants.
+type ImageSize string
+
+const (
+	ImageSizeThumb  ImageSize = "thumb"
+	ImageSizeMedium ImageSize = "medium"
+	ImageSizeFull   ImageSize = "full"
+)
+
+// ImageVariant is a resized copy of the image with key ImageKey.
+type ImageVariant struct {
+	ImageKey    string
+	Size        ImageSize
+	Key         string
+	ContentType string
+	Width       int
+	Height      int
 }
 
 type Category struct {
 	ID   int64
 	Name string
 }
+
+type ItemStatusHistory struct {
+	ID         int64
+	ItemID     int64
+	FromStatus ItemStatus
+	ToStatus   ItemStatus
+	CreatedAt  string
+}
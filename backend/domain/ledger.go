@@ -0,0 +1,38 @@
+package domain
+
+// ExternalAccountID is the counterparty used for money entering or leaving
+// the system, e.g. balance deposits.
+const ExternalAccountID int64 = 0
+
+// EscrowAccountID holds the money of buyers while their items are reserved
+// and until they receive them.
+const EscrowAccountID int64 = -1
+
+type LedgerKind string
+
+const (
+	LedgerKindDeposit  LedgerKind = "deposit"
+	LedgerKindPurchase LedgerKind = "purchase"
+	// LedgerKindHold moves the price of a reserved item from the buyer to
+	// escrow, and LedgerKindRelease returns it when the hold expires.
+	LedgerKindHold    LedgerKind = "hold"
+	LedgerKindRelease LedgerKind = "release"
+	// LedgerKindPayout moves the price of a purchased item from escrow to
+	// the seller once the order is completed.
+	LedgerKindPayout LedgerKind = "payout"
+	// LedgerKindOpening records a balance held before the ledger existed.
+	LedgerKindOpening LedgerKind = "opening"
+)
+
+// LedgerEntry is one side of a balance movement. Every transaction consists of
+// entries whose amounts sum to zero, so the balance of a user is the sum of
+// the amounts of their entries.
+type LedgerEntry struct {
+	ID            int64
+	TransactionID string
+	UserID        int64
+	ItemID        int64
+	Kind          LedgerKind
+	Amount        int64
+	CreatedAt     string
+}
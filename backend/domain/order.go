@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+type OrderStatus string
+
+// An order is paid when the item is purchased, shipped when the seller sends
+// it and completed when the buyer receives it, which pays the seller.
+const (
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusCompleted OrderStatus = "completed"
+)
+
+// Order records the purchase of an item. Amount, the price paid by the buyer,
+// is kept in escrow until the order is completed.
+type Order struct {
+	ID             int64
+	ItemID         int64
+	BuyerID        int64
+	SellerID       int64
+	Amount         int64
+	Status         OrderStatus
+	TrackingNumber string
+	CreatedAt      time.Time
+	// ShippedAt and CompletedAt are zero until the order gets there.
+	ShippedAt   time.Time
+	CompletedAt time.Time
+}
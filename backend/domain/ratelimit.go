@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// Lockout counts the consecutive failed logins of an account. The account is
+// locked until LockedUntil, which is zero if it was never locked.
+type Lockout struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// RetryAfter returns how long the account is still locked after now, or 0.
+func (l Lockout) RetryAfter(now time.Time) time.Duration {
+	if d := l.LockedUntil.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// LockoutPolicy locks an account once it has Threshold consecutive failed
+// logins, for Base at first and twice as long on every further failure, up to
+// Max.
+type LockoutPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+// LockFor returns how long an account is locked after the given number of
+// consecutive failures, or 0 if it is not locked.
+func (p LockoutPolicy) LockFor(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	d := p.Base
+	for i := p.Threshold; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	return d
+}
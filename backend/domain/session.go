@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Session is one login of a user. It holds the hash of the current refresh
+// token, which is replaced every time the session is refreshed, and access
+// tokens are accepted only while their session is active.
+type Session struct {
+	ID               int64
+	UserID           int64
+	RefreshTokenHash string
+	UserAgent        string
+	CreatedAt        string
+	LastUsedAt       string
+	ExpiresAt        string
+	// RevokedAt is empty unless the session was logged out.
+	RevokedAt string
+}
+
+// Active reports whether the session is neither revoked nor expired at now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == "" && s.ExpiresAt > FormatTime(now)
+}
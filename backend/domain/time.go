@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// TimeLayout is the format of the timestamps stored as text: ISO-8601 in UTC
+// with second resolution. Timestamps in this format sort in time order as
+// strings.
+const TimeLayout = "2006-01-02T15:04:05Z"
+
+// FormatTime formats t as a stored timestamp.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// ParseTime parses a stored timestamp.
+func ParseTime(s string) (time.Time, error) {
+	return time.Parse(TimeLayout, s)
+}
@@ -5,4 +5,8 @@ type User struct {
 	Password string
 	Name     string
 	Balance  int64
+	// LoginName and Email identify the user at login, stored lowercased.
+	// They are unique, and empty if not set.
+	LoginName string
+	Email     string
 }
@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxCachedResponseSize is the largest body the ResponseCache keeps.
+	maxCachedResponseSize = 1 << 20
+	// maxResponseCacheSize bounds the bodies kept by the ResponseCache.
+	maxResponseCacheSize = 64 << 20
+)
+
+// cachedHeaders are the response headers replayed from the ResponseCache.
+var cachedHeaders = []string{echo.HeaderContentType, "ETag", echo.HeaderLastModified, "Cache-Control"}
+
+// ResponseCache keeps the responses of public GET endpoints in memory for a
+// while. It is shared by all users, so it must only be used for endpoints
+// whose responses do not depend on the user.
+type ResponseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+	size    int
+	// generation counts the invalidations, so that a response racing with
+	// one is not cached.
+	generation uint64
+}
+
+type cachedResponse struct {
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func NewResponseCache(ttl time.Duration) *ResponseCache {
+	return &ResponseCache{ttl: ttl, entries: map[string]cachedResponse{}}
+}
+
+// Invalidate drops every cached response.
+func (c *ResponseCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries, c.size = map[string]cachedResponse{}, 0
+	c.generation++
+}
+
+func (c *ResponseCache) get(key string) (cachedResponse, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		c.remove(key)
+		ok = false
+	}
+	return entry, c.generation, ok
+}
+
+// put caches the response unless the cache was invalidated since generation
+// or is full.
+func (c *ResponseCache) put(key string, generation uint64, header http.Header, body []byte) {
+	if len(body) > maxCachedResponseSize {
+		return
+	}
+	kept := http.Header{}
+	for _, name := range cachedHeaders {
+		if v := header.Get(name); v != "" {
+			kept.Set(name, v)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	if c.size+len(body) > maxResponseCacheSize {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				c.remove(k)
+			}
+		}
+		if c.size+len(body) > maxResponseCacheSize {
+			return
+		}
+	}
+	c.remove(key)
+	c.entries[key] = cachedResponse{header: kept, body: body, expires: time.Now().Add(c.ttl)}
+	c.size += len(body)
+}
+
+// remove drops the entry of key. The caller holds the lock.
+func (c *ResponseCache) remove(key string) {
+	if entry, ok := c.entries[key]; ok {
+		c.size -= len(entry.body)
+		delete(c.entries, key)
+	}
+}
+
+// conditionalGET gives successful responses an ETag, unless the handler set
+// one, and answers 304 Not Modified when the client already has them. The
+// responses are served from h.ResponseCache if it is set.
+func (h *Handler) conditionalGET(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cache := h.ResponseCache
+		key := c.Request().URL.RequestURI()
+		var generation uint64
+		if cache != nil {
+			entry, gen, ok := cache.get(key)
+			if ok {
+				for name, values := range entry.header {
+					c.Response().Header()[name] = values
+				}
+				return writeConditional(c, http.StatusOK, entry.body)
+			}
+			generation = gen
+		}
+
+		res := c.Response()
+		w := res.Writer
+		buf := &bufferingResponseWriter{ResponseWriter: w}
+		res.Writer = buf
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		res.Writer = w
+		switch buf.status {
+		case 0:
+			return nil
+		case http.StatusOK:
+		default:
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return nil
+		}
+
+		body := buf.body.Bytes()
+		if res.Header().Get("ETag") == "" {
+			sum := sha256.Sum256(body)
+			res.Header().Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:])+`"`)
+		}
+		if res.Header().Get("Cache-Control") == "" {
+			res.Header().Set("Cache-Control", "no-cache")
+		}
+		if cache != nil {
+			cache.put(key, generation, res.Header(), body)
+		}
+		return writeConditional(c, http.StatusOK, body)
+	}
+}
+
+// invalidateResponses drops the cached responses after successful writes.
+func (h *Handler) invalidateResponses(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if h.ResponseCache != nil && err == nil && c.Response().Status < http.StatusBadRequest {
+			h.ResponseCache.Invalidate()
+		}
+		return err
+	}
+}
+
+// setLastModified sets the Last-Modified header, unless t is unknown.
+func setLastModified(c echo.Context, t time.Time) {
+	if !t.IsZero() {
+		c.Response().Header().Set(echo.HeaderLastModified, t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// writeConditional writes the response, or 304 Not Modified if the validators
+// of the request match its headers.
+func writeConditional(c echo.Context, status int, body []byte) error {
+	res := c.Response()
+	if notModified(c.Request(), res.Header()) {
+		res.Header().Del(echo.HeaderContentType)
+		res.Header().Del(echo.HeaderContentLength)
+		res.Status = http.StatusNotModified
+		res.Writer.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	res.Status = status
+	res.Writer.WriteHeader(status)
+	_, err := res.Writer.Write(body)
+	return err
+}
+
+// notModified reports whether the client's copy is current. If-Modified-Since
+// is only used without If-None-Match, as RFC 9110 requires.
+func notModified(req *http.Request, header http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, header.Get("ETag"))
+	}
+	ims, err := http.ParseTime(req.Header.Get(echo.HeaderIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get(echo.HeaderLastModified))
+	return err == nil && !lastModified.After(ims)
+}
+
+// etagMatches reports whether the If-None-Match header matches etag. The
+// comparison is weak: W/ prefixes are ignored.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferingResponseWriter holds back the response, so that its headers can be
+// changed after the handler returned.
+type bufferingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
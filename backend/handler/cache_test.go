@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestConditionalGET(t *testing.T) {
+	s := newMemoryServer(t)
+	_, token := s.addUser("alice")
+	category := s.addCategory(token, "food")
+	item := s.addItem(token, category, "Tomato", 200)
+	target := fmt.Sprint("/items/", item)
+
+	rec := s.expect(request{method: http.MethodGet, target: target}, http.StatusOK)
+	etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("GET %s: ETag %q, Last-Modified %q", target, etag, lastModified)
+	}
+	for _, header := range []map[string]string{
+		{"If-None-Match": etag},
+		{"If-None-Match": `"other", W/` + etag},
+		{"If-None-Match": "*"},
+		{"If-Modified-Since": lastModified},
+	} {
+		if rec := s.expect(request{method: http.MethodGet, target: target, header: header}, http.StatusNotModified); rec.Body.Len() != 0 {
+			t.Errorf("304 with %v has a body: %s", header, rec.Body)
+		}
+	}
+	s.expect(request{method: http.MethodGet, target: target, header: map[string]string{"If-None-Match": `"other"`}}, http.StatusOK)
+
+	// Updating the item changes its ETag.
+	time.Sleep(time.Second)
+	s.expect(request{method: http.MethodPut, target: "/items/", token: token, json: putItemRequest{ItemID: item, Name: "Potato", CategoryID: category, Price: 200}}, http.StatusOK)
+	rec = s.expect(request{method: http.MethodGet, target: target, header: map[string]string{"If-None-Match": etag}}, http.StatusOK)
+	if rec.Header().Get("ETag") == etag || rec.Header().Get("Last-Modified") == lastModified {
+		t.Errorf("GET %s after an update kept its validators", target)
+	}
+	if res := decode[getItemResponse](t, rec); res.CreatedAt.IsZero() || !res.UpdatedAt.After(res.CreatedAt) {
+		t.Errorf("GET %s after an update = %+v, want updated_at after created_at", target, res)
+	}
+	s.expect(request{method: http.MethodGet, target: target, header: map[string]string{"If-Modified-Since": lastModified}}, http.StatusOK)
+
+	for _, target := range []string{"/items", "/items/categories", target + "/image", target + "/images", target + "/images/0", target + "/history"} {
+		etag := s.expect(request{method: http.MethodGet, target: target}, http.StatusOK).Header().Get("ETag")
+		if etag == "" {
+			t.Errorf("GET %s has no ETag", target)
+			continue
+		}
+		s.expect(request{method: http.MethodGet, target: target, header: map[string]string{"If-None-Match": etag}}, http.StatusNotModified)
+	}
+
+	if rec := s.expect(request{method: http.MethodGet, target: "/items/100"}, http.StatusNotFound); rec.Header().Get("ETag") != "" {
+		t.Errorf("GET /items/100 has an ETag")
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	store := memory.NewStore()
+	itemRepo := memory.NewItemRepository(store)
+	s := newTestServer(t, &Handler{
+		UserRepo:        memory.NewUserRepository(store),
+		ItemRepo:        db.NewCachedItemRepository(itemRepo),
+		LedgerRepo:      memory.NewLedgerRepository(store),
+		PurchaseService: memory.NewPurchaseService(store),
+		OrderService:    memory.NewOrderService(store),
+		SessionRepo:     memory.NewSessionRepository(store),
+		ResponseCache:   NewResponseCache(time.Minute),
+	}, memory.NewIdempotencyRepository(store))
+	userID, token := s.addUser("alice")
+	category := s.addCategory(token, "food")
+	item := s.addItem(token, category, "Tomato", 200)
+
+	onSale := func() int {
+		rec := s.expect(request{method: http.MethodGet, target: "/items"}, http.StatusOK)
+		return len(decode[[]getOnSaleItemsResponse](t, rec))
+	}
+	if n := onSale(); n != 0 {
+		t.Fatalf("%d items on sale, want 0", n)
+	}
+
+	// Items written around the handlers, e.g. by another process, are not
+	// seen until the cache is invalidated.
+	if _, err := itemRepo.AddItem(context.Background(), domain.Item{Name: "Potato", Price: 100, CategoryID: category, UserID: userID, Status: domain.ItemStatusOnSale}); err != nil {
+		t.Fatal(err)
+	}
+	if n := onSale(); n != 0 {
+		t.Errorf("%d items on sale from the cache, want 0", n)
+	}
+	s.expect(request{method: http.MethodPost, target: "/sell", token: token, json: sellRequest{ItemID: item}}, http.StatusOK)
+	if n := onSale(); n != 2 {
+		t.Errorf("%d items on sale after selling, want 2", n)
+	}
+
+	// Cached responses are conditional too.
+	etag := s.expect(request{method: http.MethodGet, target: "/items"}, http.StatusOK).Header().Get("ETag")
+	s.expect(request{method: http.MethodGet, target: "/items", header: map[string]string{"If-None-Match": etag}}, http.StatusNotModified)
+}
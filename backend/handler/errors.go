@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/validation"
+)
+
+// CodeValidationFailed is the code of a request whose fields break the rules
+// of their validate tags. The fields are listed in the details.
+const CodeValidationFailed = "validation_failed"
+
+// errorResponse is the body of every error response. Code is machine
+// readable, e.g. not_found for 404, while Message is for people.
+type errorResponse struct {
+	Code    string                  `json:"code"`
+	Message string                  `json:"message"`
+	Details []validation.FieldError `json:"details,omitempty"`
+}
+
+// errorStatuses are the statuses of the kinds of errors that handlers return
+// as is, most of them from the repositories.
+var errorStatuses = []struct {
+	kind   error
+	status int
+}{
+	{db.ErrInvalidArgument, http.StatusBadRequest},
+	{db.ErrUnauthenticated, http.StatusUnauthorized},
+	{db.ErrNotFound, http.StatusNotFound},
+	{db.ErrConflict, http.StatusConflict},
+	{db.ErrPreconditionFailed, http.StatusPreconditionFailed},
+	{domain.ErrInvalidStatusTransition, http.StatusPreconditionFailed},
+}
+
+// HTTPErrorHandler is the error handler of the Echo instance. Errors of the
+// kinds in errorStatuses are answered with their status and message. Server
+// errors are answered with the status text only, so that SQL errors and the
+// like do not leak; the access log records the cause.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, res := http.StatusInternalServerError, errorResponse{}
+	var verr *validation.Error
+	var herr *echo.HTTPError
+	switch {
+	case errors.As(err, &verr):
+		status = http.StatusBadRequest
+		res = errorResponse{Code: CodeValidationFailed, Message: verr.Error(), Details: verr.Fields}
+	case errors.As(err, &herr):
+		status = herr.Code
+		res.Message = httpErrorMessage(herr)
+	default:
+		for _, s := range errorStatuses {
+			if errors.Is(err, s.kind) {
+				status, res.Message = s.status, err.Error()
+				break
+			}
+		}
+	}
+	if res.Code == "" {
+		res.Code = statusCode(status)
+	}
+	if status >= http.StatusInternalServerError {
+		res.Message = http.StatusText(status)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, res)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// httpErrorMessage returns the message of the error, unwrapping the errors of
+// Echo that handlers return as the message of their own.
+func httpErrorMessage(herr *echo.HTTPError) string {
+	switch m := herr.Message.(type) {
+	case *echo.HTTPError:
+		return httpErrorMessage(m)
+	case string:
+		return m
+	case error:
+		return m.Error()
+	default:
+		return fmt.Sprint(m)
+	}
+}
+
+// statusCode is the code of an error response with the status, e.g.
+// precondition_failed for 412.
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.ReplaceAll(text, " ", "_"))
+}
+
+// bind binds the request into req and validates it.
+func bind(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	return c.Validate(req)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/validation"
+)
+
+// brokenUserRepository fails like a database that went away.
+type brokenUserRepository struct {
+	db.UserRepository
+}
+
+func (brokenUserRepository) AddUser(ctx context.Context, user domain.User) (int64, error) {
+	return 0, errors.New("sql: database is locked (table users)")
+}
+
+func TestErrorResponses(t *testing.T) {
+	s := newMemoryServer(t)
+	_, token := s.addUser("alice")
+	item := s.addItem(token, s.addCategory(token, "food"), "Tomato", 200)
+	s.expect(request{method: http.MethodPost, target: "/sell", token: token, json: sellRequest{ItemID: item}}, http.StatusOK)
+
+	res := decode[errorResponse](t, s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: strings.Repeat("a", 51), Password: ""}}, http.StatusBadRequest))
+	want := errorResponse{
+		Code:    CodeValidationFailed,
+		Message: "name must be at most 50; password is required",
+		Details: []validation.FieldError{
+			{Field: "name", Rule: "max", Message: "name must be at most 50"},
+			{Field: "password", Rule: "required", Message: "password is required"},
+		},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("POST /register with invalid fields = %+v, want %+v", res, want)
+	}
+
+	for _, tt := range []struct {
+		req    request
+		status int
+		code   string
+	}{
+		{request{method: http.MethodPost, target: "/balance", token: token, json: addBalanceRequest{Balance: -1}}, http.StatusBadRequest, CodeValidationFailed},
+		{request{method: http.MethodPost, target: "/items/new_category", token: token, form: map[string]string{"name": " "}}, http.StatusBadRequest, CodeValidationFailed},
+		{request{method: http.MethodGet, target: "/items/100/history"}, http.StatusNotFound, "not_found"},
+		{request{method: http.MethodGet, target: "/balance"}, http.StatusUnauthorized, "unauthorized"},
+		{request{method: http.MethodPost, target: "/token/refresh", json: refreshTokenRequest{RefreshToken: "invalid"}}, http.StatusUnauthorized, "unauthorized"},
+		{request{method: http.MethodPost, target: "/sell", token: token, json: sellRequest{ItemID: 100}}, http.StatusNotFound, "not_found"},
+		{request{method: http.MethodGet, target: "/items/100"}, http.StatusNotFound, "not_found"},
+		{request{method: http.MethodGet, target: "/items/abc"}, http.StatusBadRequest, "bad_request"},
+		{request{method: http.MethodGet, target: "/items/0"}, http.StatusBadRequest, "bad_request"},
+		{request{method: http.MethodGet, target: "/items/99999999999999999999/image"}, http.StatusBadRequest, "bad_request"},
+		{request{method: http.MethodGet, target: fmt.Sprint("/items/", 1<<32+item)}, http.StatusNotFound, "not_found"},
+		{request{method: http.MethodPost, target: "/purchase/-1", token: token}, http.StatusBadRequest, "bad_request"},
+		{request{method: http.MethodGet, target: "/search?name=x&cursor=invalid"}, http.StatusBadRequest, "bad_request"},
+		{request{method: http.MethodGet, target: "/items/100/image"}, http.StatusNotFound, "not_found"},
+		{request{method: http.MethodDelete, target: "/sessions/100", token: token}, http.StatusNotFound, "not_found"},
+		{request{method: http.MethodPost, target: "/register", json: registerRequest{Name: "Alice", Password: "pw", LoginName: "alice"}}, http.StatusConflict, "conflict"},
+		{request{method: http.MethodPost, target: "/sell", token: token, json: sellRequest{ItemID: item}}, http.StatusPreconditionFailed, "precondition_failed"},
+		{request{method: http.MethodPost, target: "/purchase/" + fmt.Sprint(item), token: token}, http.StatusPreconditionFailed, "precondition_failed"},
+	} {
+		if res := decode[errorResponse](t, s.expect(tt.req, tt.status)); res.Code != tt.code || res.Message == "" {
+			t.Errorf("%s %s = %+v, want code %s", tt.req.method, tt.req.target, res, tt.code)
+		}
+	}
+
+	// Repository errors keep their message.
+	if res := decode[errorResponse](t, s.expect(request{method: http.MethodGet, target: "/items/100"}, http.StatusNotFound)); res.Message != "item not found" {
+		t.Errorf("GET /items/100 = %+v, want item not found", res)
+	}
+	if res := decode[errorResponse](t, s.expect(request{method: http.MethodGet, target: "/items?cursor=invalid"}, http.StatusBadRequest)); res.Message != "invalid cursor" {
+		t.Errorf("GET /items?cursor=invalid = %+v, want invalid cursor", res)
+	}
+	if res := decode[errorResponse](t, s.expect(request{method: http.MethodPost, target: "/token/refresh", json: refreshTokenRequest{RefreshToken: "invalid"}}, http.StatusUnauthorized)); res.Message != "invalid refresh token" {
+		t.Errorf("POST /token/refresh with an invalid token = %+v, want invalid refresh token", res)
+	}
+
+	// Server errors do not leak their cause.
+	store := memory.NewStore()
+	broken := newTestServer(t, &Handler{UserRepo: brokenUserRepository{memory.NewUserRepository(store)}}, memory.NewIdempotencyRepository(store))
+	rec := broken.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: "bob", Password: "pw"}}, http.StatusInternalServerError)
+	if res := decode[errorResponse](t, rec); res.Code != "internal_server_error" || res.Message != "Internal Server Error" {
+		t.Errorf("POST /register with a broken database = %s", rec.Body)
+	}
+}
@@ -2,20 +2,24 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
-	"time"
 	"strings"
 	"path/filepath"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/auth"
 	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
 	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/imageproc"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/storage"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 
@@ -28,7 +32,8 @@ var (
 )
 
 type JwtCustomClaims struct {
-	UserID int64 `json:"user_id"`
+	UserID    int64 `json:"user_id"`
+	SessionID int64 `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -37,31 +42,42 @@ type InitializeResponse struct {
 }
 
 type registerRequest struct {
-	Name     string `json:"name"`
-	Password string `json:"password"`
+	Name string `json:"name" validate:"required,max=50"`
+	// Password is hashed with bcrypt, which takes up to 72 bytes.
+	Password string `json:"password" validate:"required,maxbytes=72"`
+	// LoginName defaults to the lowercased name without @, with a random
+	// number appended if it is taken.
+	LoginName string `json:"login_name" validate:"max=50,excludes=@"`
+	Email     string `json:"email" validate:"omitempty,max=254,email"`
 }
 
 type registerResponse struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	LoginName string `json:"login_name"`
+	Email     string `json:"email,omitempty"`
 }
 
 type getUserItemsResponse struct {
-	ID           int32  `json:"id"`
-	Name         string `json:"name"`
-	Price        int64  `json:"price"`
-	CategoryName string `json:"category_name"`
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Price        int64     `json:"price"`
+	CategoryName string    `json:"category_name"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type getOnSaleItemsResponse struct {
-	ID           int32  `json:"id"`
-	Name         string `json:"name"`
-	Price        int64  `json:"price"`
-	CategoryName string `json:"category_name"`
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Price        int64     `json:"price"`
+	CategoryName string    `json:"category_name"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type getItemResponse struct {
-	ID           int32             `json:"id"`
+	ID           int64             `json:"id"`
 	Name         string            `json:"name"`
 	CategoryID   int64             `json:"category_id"`
 	CategoryName string            `json:"category_name"`
@@ -69,6 +85,16 @@ type getItemResponse struct {
 	Price        int64             `json:"price"`
 	Description  string            `json:"description"`
 	Status       domain.ItemStatus `json:"status"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+type getItemHistoryResponse struct {
+	FromStatus     domain.ItemStatus `json:"from_status"`
+	FromStatusName string            `json:"from_status_name"`
+	ToStatus       domain.ItemStatus `json:"to_status"`
+	ToStatusName   string            `json:"to_status_name"`
+	CreatedAt      string            `json:"created_at"`
 }
 
 type getCategoriesResponse struct {
@@ -77,13 +103,13 @@ type getCategoriesResponse struct {
 }
 
 type sellRequest struct {
-	ItemID int32 `json:"item_id"`
+	ItemID int64 `json:"item_id" validate:"min=1"`
 }
 
 type addItemRequest struct {
-	Name        string `form:"name"`
-	CategoryID  int64  `form:"category_id"`
-	Price       int64  `form:"price"`
+	Name        string `form:"name" validate:"required,max=50"`
+	CategoryID  int64  `form:"category_id" validate:"min=1"`
+	Price       int64  `form:"price" validate:"min=1"`
 	Description string `form:"description"`
 }
 
@@ -92,7 +118,7 @@ type addItemResponse struct {
 }
 
 type addCategoryRequest struct {
-	Name string `form:"name"`
+	Name string `form:"name" validate:"required,max=50"`
 }
 
 type addCategoryResponse struct {
@@ -100,54 +126,123 @@ type addCategoryResponse struct {
 }
 
 type addBalanceRequest struct {
-	Balance int64 `json:"balance"`
+	Balance int64 `json:"balance" validate:"min=1"`
 }
 
 type getBalanceResponse struct {
 	Balance int64 `json:"balance"`
 }
 
+type ledgerEntryResponse struct {
+	ID            int64             `json:"id"`
+	TransactionID string            `json:"transaction_id"`
+	ItemID        int64             `json:"item_id,omitempty"`
+	Kind          domain.LedgerKind `json:"kind"`
+	Amount        int64             `json:"amount"`
+	CreatedAt     string            `json:"created_at"`
+}
+
+type getBalanceHistoryResponse struct {
+	Balance int64                 `json:"balance"`
+	Entries []ledgerEntryResponse `json:"entries"`
+}
+
+// loginRequest identifies the user by Login, which is a login name or an
+// email, or by UserID.
 type loginRequest struct {
-	UserID   int64  `json:"user_id"`
-	Password string `json:"password"`
+	UserID   int64  `json:"user_id" validate:"min=0"`
+	Login    string `json:"login" validate:"max=254"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
 }
 
 type loginResponse struct {
 	ID    int64  `json:"id"`
 	Name  string `json:"name"`
 	Token string `json:"token"`
+	// RefreshToken gets a new token once it expires in ExpiresIn seconds.
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 
 type putItemRequest struct {
-	ItemID      int32  `json:"item_id"`
-	Name        string `json:"name"`
-	CategoryID  int64  `json:"category_id"`
-	Price       int64  `json:"price"`
+	ItemID      int64  `json:"item_id" validate:"min=1"`
+	Name        string `json:"name" validate:"required,max=50"`
+	CategoryID  int64  `json:"category_id" validate:"min=1"`
+	Price       int64  `json:"price" validate:"min=1"`
 	Description string `json:"description"`
 }
 
 
 type SearchResult struct {
-	ID          int32             `json:"id"`
-	Name        string            `json:"name"`
-	UserID      int64             `json:"user_id"`
-	Price       int64             `json:"price"`
-	Description string            `json:"description"`
-	Status      domain.ItemStatus `json:"status"`
+	ID           int64             `json:"id"`
+	Name         string            `json:"name"`
+	CategoryID   int64             `json:"category_id"`
+	CategoryName string            `json:"category_name"`
+	UserID       int64             `json:"user_id"`
+	Price        int64             `json:"price"`
+	Description  string            `json:"description"`
+	Status       domain.ItemStatus `json:"status"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
 }
 
-type Handler struct {
-	DB       *sql.DB
-	UserRepo db.UserRepository
-	ItemRepo db.ItemRepository
+// pageResponse is returned by list endpoints when limit or cursor is given.
+// Without them they return the plain array of every item.
+type pageResponse[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
 }
 
-func GetSecret() string {
-	if secret := os.Getenv("SECRET"); secret != "" {
-		return secret
+func newPageResponse[T any](items []T, next string) pageResponse[T] {
+	if items == nil {
+		items = []T{}
 	}
-	return "secret-key"
+	return pageResponse[T]{Items: items, NextCursor: next}
+}
+
+const (
+	defaultPageLimit   = 50
+	maxPageLimit       = 100
+	defaultSearchLimit = 100
+)
+
+type Handler struct {
+	DB              *sql.DB
+	UserRepo        db.UserRepository
+	ItemRepo        db.ItemRepository
+	LedgerRepo      db.LedgerRepository
+	PurchaseService db.PurchaseService
+	OrderService    db.OrderService
+	SessionRepo     db.SessionRepository
+	// RateLimitRepo keeps the state of AuthLimits. Nothing is limited if
+	// it is nil.
+	RateLimitRepo db.RateLimitRepository
+	AuthLimits    AuthLimits
+	// Keys sign the access tokens and verify them in ParseAccessToken.
+	Keys            *auth.KeySet
+	ImageStore      storage.ImageStore
+	// SeedConfig sizes the data created by POST /initialize.
+	SeedConfig db.SeedConfig
+	// ResponseCache keeps the responses of the public item reads. Nothing is
+	// cached if it is nil.
+	ResponseCache *ResponseCache
+	// HoldDuration is how long POST /items/:itemID/reserve holds an item,
+	// DefaultHoldDuration if it is zero.
+	HoldDuration time.Duration
+	// EscrowRelease is how long after shipping an order is completed if the
+	// buyer does not confirm the receipt, DefaultEscrowRelease if it is zero.
+	EscrowRelease time.Duration
+	// Now is the clock of the purchases, the holds and the background jobs,
+	// time.Now if it is nil.
+	Now func() time.Time
+}
+
+
+// categoryCache is implemented by item repositories that cache categories,
+// e.g. db.CachedItemRepository.
+type categoryCache interface {
+	InvalidateCategories()
 }
 
 func (h *Handler) Initialize(c echo.Context) error {
@@ -156,10 +251,14 @@ func (h *Handler) Initialize(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to truncate access log"))
 	}
 
-	err = db.Initialize(c.Request().Context(), h.DB)
+	err = db.Initialize(c.Request().Context(), h.DB, h.SeedConfig, h.storeImage)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to initialize"))
 	}
+	// The categories were recreated.
+	if cache, ok := h.ItemRepo.(categoryCache); ok {
+		cache.InvalidateCategories()
+	}
 
 	return c.JSON(http.StatusOK, InitializeResponse{Message: "Success"})
 }
@@ -169,77 +268,85 @@ func (h *Handler) AccessLog(c echo.Context) error {
 }
 
 func (h *Handler) Register(c echo.Context) error {
-	// TODO: validation
-	// http.StatusBadRequest(400)
 	req := new(registerRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bind(c, req); err != nil {
+		return err
 	}
 
+	loginName := normalizeLogin(req.LoginName)
+	email := normalizeLogin(req.Email)
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	userID, err := h.UserRepo.AddUser(c.Request().Context(), domain.User{Name: req.Name, Password: string(hash)})
+	user := domain.User{Name: req.Name, Password: string(hash), LoginName: loginName, Email: email}
+	var userID int64
+	if loginName == "" {
+		userID, loginName, err = h.addUserWithDefaultLoginName(c.Request().Context(), user)
+	} else {
+		userID, err = h.UserRepo.AddUser(c.Request().Context(), user)
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
-	return c.JSON(http.StatusOK, registerResponse{ID: userID, Name: req.Name})
+	return c.JSON(http.StatusOK, registerResponse{ID: userID, Name: req.Name, LoginName: loginName, Email: email})
 }
 
 func (h *Handler) Login(c echo.Context) error {
 	ctx := c.Request().Context()
-	// TODO: validation
-	// http.StatusBadRequest(400)
 	req := new(loginRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bind(c, req); err != nil {
+		return err
+	}
+
+	account := loginAccount(req)
+	if account == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, errNoLoginIdentifier.Error())
+	}
+	if err := h.rateLimit(c, "login:account:"+account, h.AuthLimits.LoginPerAccount); err != nil {
+		return err
 	}
 
-	user, err := h.UserRepo.GetUser(ctx, req.UserID)
+	user, err := h.getLoginUser(ctx, req)
 	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "unknown user")
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
+	if err := h.checkLockout(c, user.ID); err != nil {
+		return err
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
 		if err == bcrypt.ErrMismatchedHashAndPassword {
+			if err := h.recordLogin(c, user.ID, false); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
 			return echo.NewHTTPError(http.StatusUnauthorized, err)
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
-
-	// Set custom claims
-	claims := &JwtCustomClaims{
-		req.UserID,
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)),
-		},
+	if err := h.recordLogin(c, user.ID, true); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// Generate encoded token and send it as response.
-	encodedToken, err := token.SignedString([]byte(GetSecret()))
+
+	res, err := h.startSession(c, user)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
-
-	return c.JSON(http.StatusOK, loginResponse{
-		ID:    user.ID,
-		Name:  user.Name,
-		Token: encodedToken,
-	})
+	return c.JSON(http.StatusOK, res)
 }
 
 func (h *Handler) AddItem(c echo.Context) error {
-	// TODO: validation
-	// http.StatusBadRequest(400)
 	ctx := c.Request().Context()
 
 	req := new(addItemRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bind(c, req); err != nil {
+		return err
 	}
 
 	userID, err := getUserID(c)
@@ -292,49 +399,60 @@ func (h *Handler) AddItem(c echo.Context) error {
 
 	_, err = h.ItemRepo.GetCategory(ctx, req.CategoryID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, db.ErrNotFound) {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid categoryID")
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	image, err := h.storeImage(ctx, blob.Bytes())
+	if err != nil {
+		if isInvalidImage(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
 	item, err := h.ItemRepo.AddItem(c.Request().Context(), domain.Item{
 		Name:        req.Name,
 		CategoryID:  req.CategoryID,
 		UserID:      userID,
 		Price:       req.Price,
 		Description: req.Description,
-		Image:       blob.Bytes(),
+		Image:       image,
 		Status:      domain.ItemStatusInitial,
 	})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	return c.JSON(http.StatusOK, addItemResponse{ID: int64(item.ID)})
+	return c.JSON(http.StatusOK, addItemResponse{ID: item.ID})
 }
 
 func (h *Handler) Sell(c echo.Context) error {
 	ctx := c.Request().Context()
 	req := new(sellRequest)
 
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	if err := bind(c, req); err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
 	item, err := h.ItemRepo.GetItem(ctx, req.ItemID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
+	}
+
+	if item.UserID != userID {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "user ID mismatch")
 	}
 
-	// TODO: check req.UserID and item.UserID
-	// http.StatusPreconditionFailed(412)
-	// TODO: only update when status is initial
-	// http.StatusPreconditionFailed(412)
 	if err := h.ItemRepo.UpdateItemStatus(ctx, item.ID, domain.ItemStatusOnSale); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
 	return c.JSON(http.StatusOK, "successful")
@@ -344,12 +462,8 @@ func (h *Handler) AddCategory(c echo.Context) error {
 
 	req := new(addCategoryRequest)
 
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
-	}
-
-	if req.Name == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Category cannot be empty")
+	if err := bind(c, req); err != nil {
+		return err
 	}
 
 	category, err := h.ItemRepo.AddCategory(c.Request().Context(), domain.Category{Name: req.Name})
@@ -364,48 +478,47 @@ func (h *Handler) AddCategory(c echo.Context) error {
 func (h *Handler) GetOnSaleItems(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	items, err := h.ItemRepo.GetOnSaleItems(ctx)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	page, paginated, err := parsePage(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	items, next, err := h.ItemRepo.GetOnSaleItems(ctx, page)
+	if err != nil {
+		return err
 	}
 
 	var res []getOnSaleItemsResponse
 	for _, item := range items {
-		cats, err := h.ItemRepo.GetCategories(ctx)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err)
-		}
-		for _, cat := range cats {
-			if cat.ID == item.CategoryID {
-				res = append(res, getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: cat.Name})
-			}
-		}
+		res = append(res, getOnSaleItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: item.CategoryName, CreatedAt: item.CreatedAt, UpdatedAt: item.UpdatedAt})
 	}
 
+	if paginated {
+		return c.JSON(http.StatusOK, newPageResponse(res, next))
+	}
 	return c.JSON(http.StatusOK, res)
 }
 
 func (h *Handler) GetItem(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	itemID, err := strconv.Atoi(c.Param("itemID"))
+	itemID, err := paramID(c, "itemID")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
-	item, err := h.ItemRepo.GetItem(ctx, int32(itemID))
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	item, err := h.ItemRepo.GetItem(ctx, itemID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
+	// An item whose category is gone has an empty category name, as in the
+	// item lists.
 	category, err := h.ItemRepo.GetCategory(ctx, item.CategoryID)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
 	}
+	setLastModified(c, item.UpdatedAt)
 	return c.JSON(http.StatusOK, getItemResponse{
 		ID:           item.ID,
 		Name:         item.Name,
@@ -415,48 +528,82 @@ func (h *Handler) GetItem(c echo.Context) error {
 		Price:        item.Price,
 		Description:  item.Description,
 		Status:       item.Status,
+		CreatedAt:    item.CreatedAt,
+		UpdatedAt:    item.UpdatedAt,
 	})
 }
 
-func (h *Handler) GetUserItems(c echo.Context) error {
+func (h *Handler) GetItemHistory(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	itemID, err := paramID(c, "itemID")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid userID type")
+		return err
 	}
 
-	items, err := h.ItemRepo.GetItemsByUserID(ctx, userID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	if _, err := h.ItemRepo.GetItem(ctx, itemID); err != nil {
+		return err
+	}
+
+	history, err := h.ItemRepo.GetItemStatusHistory(ctx, itemID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	res := make([]getItemHistoryResponse, len(history))
+	for i, entry := range history {
+		res[i] = getItemHistoryResponse{
+			FromStatus:     entry.FromStatus,
+			FromStatusName: entry.FromStatus.String(),
+			ToStatus:       entry.ToStatus,
+			ToStatusName:   entry.ToStatus.String(),
+			CreatedAt:      entry.CreatedAt,
+		}
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetUserItems(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := paramID(c, "userID")
+	if err != nil {
+		return err
+	}
+
+	page, paginated, err := parsePage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	items, next, err := h.ItemRepo.GetItemsByUserID(ctx, userID, page)
+	if err != nil {
+		return err
+	}
+
 	var res []getUserItemsResponse
 	for _, item := range items {
-		cats, err := h.ItemRepo.GetCategories(ctx)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err)
-		}
-		for _, cat := range cats {
-			if cat.ID == item.CategoryID {
-				res = append(res, getUserItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: cat.Name})
-			}
-		}
+		res = append(res, getUserItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: item.CategoryName, CreatedAt: item.CreatedAt, UpdatedAt: item.UpdatedAt})
 	}
 
+	if paginated {
+		return c.JSON(http.StatusOK, newPageResponse(res, next))
+	}
 	return c.JSON(http.StatusOK, res)
 }
 
 func (h *Handler) GetCategories(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	cats, err := h.ItemRepo.GetCategories(ctx)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	page, paginated, err := parsePage(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	cats, next, err := h.ItemRepo.GetCategories(ctx, page)
+	if err != nil {
+		return err
 	}
 
 	res := make([]getCategoriesResponse, len(cats))
@@ -464,78 +611,154 @@ func (h *Handler) GetCategories(c echo.Context) error {
 		res[i] = getCategoriesResponse{ID: cat.ID, Name: cat.Name}
 	}
 
+	if paginated {
+		return c.JSON(http.StatusOK, newPageResponse(res, next))
+	}
 	return c.JSON(http.StatusOK, res)
 }
 
 func (h *Handler) GetImage(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	// TODO: overflow
-	itemID, err := strconv.Atoi(c.Param("itemID"))
+	itemID, err := paramID(c, "itemID")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid itemID type")
+		return err
 	}
 
-	// オーバーフローしていると。ここのint32(itemID)がバグって正常に処理ができないはず
-	data, err := h.ItemRepo.GetItemImage(ctx, int32(itemID))
+	image, err := h.ItemRepo.GetItemImage(ctx, itemID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
-	return c.Blob(http.StatusOK, "image/jpeg", data)
+	return h.serveImage(c, image)
 }
 
-func (h *Handler) AddBalance(c echo.Context) error {
+// serveImage responds with the image, or its variant selected by the size
+// query parameter.
+func (h *Handler) serveImage(c echo.Context, image domain.ItemImage) error {
 	ctx := c.Request().Context()
 
-	req := new(addBalanceRequest)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+	size := domain.ImageSize(c.QueryParam("size"))
+	switch size {
+	case "":
+		size = domain.ImageSizeFull
+	case domain.ImageSizeFull, domain.ImageSizeMedium, domain.ImageSizeThumb:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "size must be thumb, medium or full")
 	}
 
-	// バリデーション: balanceがマイナスの場合はエラーとする
-	if req.Balance < 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "Balance must be a positive value")
+	// Images stored before variants were generated only have the full size.
+	key, contentType := image.Key, image.ContentType
+	if size != domain.ImageSizeFull {
+		variant, err := h.ItemRepo.GetImageVariant(ctx, image.Key, size)
+		if err == nil {
+			key, contentType = variant.Key, variant.ContentType
+		} else if !errors.Is(err, db.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
 	}
 
-	userID, err := getUserID(c)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	// Keys are content hashes, so they make strong ETags. The image of an item
+	// can be replaced, so clients have to revalidate before using their copy.
+	etag := `"` + key + `"`
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", "public, no-cache")
+	if etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
-	user, err := h.UserRepo.GetUser(ctx, userID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	data, err := h.ImageStore.Get(ctx, key)
 	if err != nil {
+		if err == storage.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "image not found")
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	if err := h.UserRepo.UpdateBalance(ctx, userID, user.Balance+req.Balance); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	return c.Blob(http.StatusOK, contentType, data)
+}
+
+// storeImage validates the uploaded image and puts it and its resized variants
+// into the image store.
+func (h *Handler) storeImage(ctx context.Context, data []byte) (domain.ItemImage, error) {
+	res, err := imageproc.Process(data)
+	if err != nil {
+		return domain.ItemImage{}, err
 	}
 
-	return c.JSON(http.StatusOK, "successful")
+	image := domain.ItemImage{ContentType: res.Full.ContentType}
+	if image.Key, err = h.ImageStore.Put(ctx, res.Full.Data, res.Full.ContentType); err != nil {
+		return domain.ItemImage{}, err
+	}
+
+	variants := make([]domain.ImageVariant, 0, len(res.Variants))
+	for size, v := range res.Variants {
+		key, err := h.ImageStore.Put(ctx, v.Data, v.ContentType)
+		if err != nil {
+			return domain.ItemImage{}, err
+		}
+		variants = append(variants, domain.ImageVariant{
+			ImageKey:    image.Key,
+			Size:        size,
+			Key:         key,
+			ContentType: v.ContentType,
+			Width:       v.Width,
+			Height:      v.Height,
+		})
+	}
+	if err := h.ItemRepo.AddImageVariants(ctx, variants); err != nil {
+		return domain.ItemImage{}, err
+	}
+	return image, nil
 }
 
-func (h *Handler) GetBalance(c echo.Context) error {
+// storeLegacyImage is storeImage for images uploaded before they were
+// validated. Images that cannot be processed are stored as they are, without
+// variants, rather than being lost.
+func (h *Handler) storeLegacyImage(ctx context.Context, data []byte) (domain.ItemImage, error) {
+	image, err := h.storeImage(ctx, data)
+	if err == nil || !isInvalidImage(err) {
+		return image, err
+	}
+
+	image = domain.ItemImage{ContentType: http.DetectContentType(data)}
+	if image.Key, err = h.ImageStore.Put(ctx, data, image.ContentType); err != nil {
+		return domain.ItemImage{}, err
+	}
+	return image, nil
+}
+
+// MoveImagesToStore moves the images still stored in the items table into the
+// image store.
+func (h *Handler) MoveImagesToStore(ctx context.Context) (int, error) {
+	return db.MoveImagesToStore(ctx, h.DB, h.storeLegacyImage)
+}
+
+func isInvalidImage(err error) bool {
+	return errors.Is(err, imageproc.ErrUnsupportedFormat) || errors.Is(err, imageproc.ErrTooLarge)
+}
+
+func (h *Handler) AddBalance(c echo.Context) error {
 	ctx := c.Request().Context()
 
+	req := new(addBalanceRequest)
+	if err := bind(c, req); err != nil {
+		return err
+	}
+
 	userID, err := getUserID(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	user, err := h.UserRepo.GetUser(ctx, userID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if err := h.LedgerRepo.Deposit(ctx, userID, req.Balance); err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusOK, getBalanceResponse{Balance: user.Balance})
+	return c.JSON(http.StatusOK, "successful")
 }
 
-func (h *Handler) Purchase(c echo.Context) error {
+func (h *Handler) GetBalance(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	userID, err := getUserID(c)
@@ -543,52 +766,62 @@ func (h *Handler) Purchase(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	// TODO: overflow
-	itemID, err := strconv.Atoi(c.Param("itemID"))
+	user, err := h.UserRepo.GetUser(ctx, userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 
-	// TODO: update only when item status is on sale
-	// http.StatusPreconditionFailed(412)
+	return c.JSON(http.StatusOK, getBalanceResponse{Balance: user.Balance})
+}
 
-	// オーバーフローしていると。ここのint32(itemID)がバグって正常に処理ができないはず
-	if err := h.ItemRepo.UpdateItemStatus(ctx, int32(itemID), domain.ItemStatusSoldOut); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+func (h *Handler) GetBalanceHistory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	user, err := h.UserRepo.GetUser(ctx, userID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	balance, err := h.LedgerRepo.GetLedgerBalance(ctx, userID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	item, err := h.ItemRepo.GetItem(ctx, int32(itemID))
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	entries, err := h.LedgerRepo.GetEntriesByUserID(ctx, userID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	// TODO: if it is fail here, item status is still sold
-	// TODO: balance consistency
-	// TODO: not to buy own items. 自身の商品を買おうとしていたら、http.StatusPreconditionFailed(412)
-	if err := h.UserRepo.UpdateBalance(ctx, userID, user.Balance-item.Price); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	res := getBalanceHistoryResponse{Balance: balance, Entries: make([]ledgerEntryResponse, len(entries))}
+	for i, entry := range entries {
+		res.Entries[i] = ledgerEntryResponse{
+			ID:            entry.ID,
+			TransactionID: entry.TransactionID,
+			ItemID:        entry.ItemID,
+			Kind:          entry.Kind,
+			Amount:        entry.Amount,
+			CreatedAt:     entry.CreatedAt,
+		}
 	}
 
-	sellerID := item.UserID
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) Purchase(c echo.Context) error {
+	ctx := c.Request().Context()
 
-	seller, err := h.UserRepo.GetUser(ctx, sellerID)
-	// TODO: not found handling
-	// http.StatusNotFound(404)
+	userID, err := getUserID(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
 	}
 
-	if err := h.UserRepo.UpdateBalance(ctx, sellerID, seller.Balance+item.Price); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	itemID, err := paramID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	if err := h.PurchaseService.Purchase(ctx, userID, itemID, h.now()); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, "successful")
@@ -620,8 +853,8 @@ func (h *Handler) PutItem(c echo.Context) error {
     ctx := c.Request().Context()
 
     req := new(putItemRequest)
-    if err := c.Bind(req); err != nil {
-        return echo.NewHTTPError(http.StatusBadRequest, err)
+    if err := bind(c, req); err != nil {
+        return err
     }
 
     userID, err := getUserID(c)
@@ -631,8 +864,7 @@ func (h *Handler) PutItem(c echo.Context) error {
 
     item, err := h.ItemRepo.GetItem(ctx, req.ItemID)
     if err != nil {
-        // TODO: Not found handling
-        return echo.NewHTTPError(http.StatusNotFound, err)
+        return err
     }
 
     if item.UserID != userID {
@@ -674,9 +906,15 @@ func (h *Handler) PutItem(c echo.Context) error {
         }
 
         // Update the item's image
-        updatedItem.Image = blob.Bytes()
+        image, err := h.storeImage(ctx, blob.Bytes())
+        if err != nil {
+            if isInvalidImage(err) {
+                return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+            }
+            return echo.NewHTTPError(http.StatusInternalServerError, err)
+        }
 
-        if err := h.ItemRepo.UpdateItemImage(ctx, updatedItem.ID, updatedItem.Image); err != nil {
+        if err := h.ItemRepo.UpdateItemImage(ctx, updatedItem.ID, image); err != nil {
             return echo.NewHTTPError(http.StatusInternalServerError, err)
         }
     }
@@ -685,30 +923,142 @@ func (h *Handler) PutItem(c echo.Context) error {
 }
 
 func (h *Handler) SearchItems(c echo.Context) error {
-	itemName := c.QueryParam("name")
-	println("hi")
-	// 検索処理の実装
-	items, err := h.ItemRepo.SearchItems(c.Request().Context(), itemName)
+	ctx := c.Request().Context()
+
+	params, paginated, err := parseSearchParams(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-		
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	items, next, err := h.ItemRepo.SearchItems(ctx, params)
+	if err != nil {
+		return err
+	}
 
-	// レスポンスデータの作成
-	var searchResults []SearchResult
-	for _, item := range items {
-		searchResult := SearchResult{
+	cats, _, err := h.ItemRepo.GetCategories(ctx, db.Page{})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	catNames := make(map[int64]string, len(cats))
+	for _, cat := range cats {
+		catNames[cat.ID] = cat.Name
+	}
+
+	searchResults := make([]SearchResult, len(items))
+	for i, item := range items {
+		searchResults[i] = SearchResult{
 			ID:           item.ID,
 			Name:         item.Name,
+			CategoryID:   item.CategoryID,
+			CategoryName: catNames[item.CategoryID],
 			UserID:       item.UserID,
 			Price:        item.Price,
 			Description:  item.Description,
 			Status:       item.Status,
+			CreatedAt:    item.CreatedAt,
+			UpdatedAt:    item.UpdatedAt,
 		}
-		searchResults = append(searchResults, searchResult)
 	}
 
-	// レスポンスの返却
+	if paginated {
+		return c.JSON(http.StatusOK, newPageResponse(searchResults, next))
+	}
 	return c.JSON(http.StatusOK, searchResults)
-}
\ No newline at end of file
+}
+
+// parseSearchParams reads the query parameters of GET /search. Only on sale
+// items are searched unless status is given, either as "all" or as a comma
+// separated list of status names.
+func parseSearchParams(c echo.Context) (db.ItemSearchParams, bool, error) {
+	params := db.ItemSearchParams{
+		Keyword:  c.QueryParam("name"),
+		Statuses: []domain.ItemStatus{domain.ItemStatusOnSale},
+		Sort:     db.ItemSearchSortRelevance,
+	}
+
+	page, paginated, err := parsePage(c)
+	if err != nil {
+		return params, false, err
+	}
+	if !paginated {
+		page.Limit = defaultSearchLimit
+	}
+	params.Page = page
+
+	ints := []struct {
+		name string
+		dest *int64
+	}{
+		{"category_id", &params.CategoryID},
+		{"min_price", &params.MinPrice},
+		{"max_price", &params.MaxPrice},
+	}
+	for _, p := range ints {
+		v := c.QueryParam(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return params, false, fmt.Errorf("invalid %s", p.name)
+		}
+		*p.dest = n
+	}
+	if params.MaxPrice != 0 && params.MinPrice > params.MaxPrice {
+		return params, false, fmt.Errorf("min_price must not exceed max_price")
+	}
+
+	switch status := c.QueryParam("status"); status {
+	case "":
+	case "all":
+		params.Statuses = nil
+	default:
+		params.Statuses = nil
+		for _, name := range strings.Split(status, ",") {
+			s, err := domain.ParseItemStatus(strings.TrimSpace(name))
+			if err != nil {
+				return params, false, err
+			}
+			params.Statuses = append(params.Statuses, s)
+		}
+	}
+
+	switch sort := db.ItemSearchSort(c.QueryParam("sort")); sort {
+	case "":
+	case db.ItemSearchSortRelevance, db.ItemSearchSortNewest, db.ItemSearchSortPriceAsc, db.ItemSearchSortPriceDesc:
+		params.Sort = sort
+	default:
+		return params, false, fmt.Errorf("invalid sort: %q", sort)
+	}
+
+	return params, paginated, nil
+}
+
+// parsePage reads the limit and cursor query parameters. It reports whether
+// either was given, i.e. whether the client asked for a paginated response.
+// Without them the page is still limited to defaultPageLimit rows, so that no
+// list returns a whole table.
+func parsePage(c echo.Context) (db.Page, bool, error) {
+	page := db.Page{Limit: defaultPageLimit, Cursor: c.QueryParam("cursor")}
+
+	limit := c.QueryParam("limit")
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			return page, false, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		page.Limit = n
+	}
+
+	return page, limit != "" || page.Cursor != "", nil
+}
+
+// paramID reads the ID in the path parameter. Malformed, out of range and
+// non-positive IDs are answered with 400.
+func paramID(c echo.Context, name string) (int64, error) {
+	var id int64
+	if err := echo.PathParamsBinder(c).MustInt64(name, &id).BindError(); err != nil || id <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid "+name)
+	}
+	return id, nil
+}
@@ -0,0 +1,659 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/auth"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/storage"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/validation"
+)
+
+// testedRoutes records the routes requested by the tests, so that TestMain can
+// check that every route registered by RegisterRoutes is tested.
+var testedRoutes = struct {
+	sync.Mutex
+	m map[string]bool
+}{m: make(map[string]bool)}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	// Only a full run is expected to request every route.
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		if untested := untestedRoutes(); len(untested) > 0 {
+			fmt.Fprintf(os.Stderr, "FAIL: routes without tests: %s\n", strings.Join(untested, ", "))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func untestedRoutes() []string {
+	e := echo.New()
+	new(Handler).RegisterRoutes(e)
+
+	testedRoutes.Lock()
+	defer testedRoutes.Unlock()
+	var untested []string
+	for _, r := range e.Routes() {
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		if route := r.Method + " " + r.Path; !testedRoutes.m[route] {
+			untested = append(untested, route)
+		}
+	}
+	sort.Strings(untested)
+	return untested
+}
+
+func recordRoute(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		testedRoutes.Lock()
+		testedRoutes.m[c.Request().Method+" "+c.Path()] = true
+		testedRoutes.Unlock()
+		return next(c)
+	}
+}
+
+// testProxy is the proxy trusted by the test servers, which is the remote
+// address of the requests of httptest.
+var testProxy = &net.IPNet{IP: net.IPv4(192, 0, 2, 1), Mask: net.CIDRMask(32, 32)}
+
+type testServer struct {
+	t *testing.T
+	e *echo.Echo
+	h *Handler
+}
+
+// newTestServer serves h with the middlewares of main.
+func newTestServer(t *testing.T, h *Handler, idempotencyRepo db.IdempotencyRepository) *testServer {
+	t.Helper()
+	if h.ImageStore == nil {
+		imageStore, err := storage.NewLocalImageStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ImageStore = imageStore
+	}
+	if h.Keys == nil {
+		h.Keys = auth.NewHMACKeySet("test-secret")
+	}
+
+	e := echo.New()
+	e.IPExtractor = IPExtractor([]*net.IPNet{testProxy})
+	e.Validator = validation.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.Use(recordRoute)
+	h.RegisterRoutes(e,
+		echojwt.WithConfig(echojwt.Config{ParseTokenFunc: h.ParseAccessToken}),
+		Idempotency(idempotencyRepo),
+	)
+	return &testServer{t: t, e: e, h: h}
+}
+
+// newMemoryServer serves a Handler backed by the in-memory repositories, after
+// applying the options to it.
+func newMemoryServer(t *testing.T, options ...func(h *Handler)) *testServer {
+	store := memory.NewStore()
+	h := &Handler{
+		UserRepo:        memory.NewUserRepository(store),
+		ItemRepo:        db.NewCachedItemRepository(memory.NewItemRepository(store)),
+		LedgerRepo:      memory.NewLedgerRepository(store),
+		PurchaseService: memory.NewPurchaseService(store),
+		OrderService:    memory.NewOrderService(store),
+		SessionRepo:     memory.NewSessionRepository(store),
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return newTestServer(t, h, memory.NewIdempotencyRepository(store))
+}
+
+// testClock is a Handler.Now that only moves when it is advanced.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now().UTC().Truncate(time.Second)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type request struct {
+	method string
+	target string
+	token  string
+	header map[string]string
+	// json is encoded as the JSON body.
+	json interface{}
+	// form and image are sent as a multipart form.
+	form  map[string]string
+	image []byte
+}
+
+func (s *testServer) do(r request) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var body io.Reader
+	contentType := ""
+	switch {
+	case r.json != nil:
+		b, err := json.Marshal(r.json)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		body, contentType = bytes.NewReader(b), echo.MIMEApplicationJSON
+	case r.form != nil || r.image != nil:
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for k, v := range r.form {
+			w.WriteField(k, v)
+		}
+		if r.image != nil {
+			fw, err := w.CreateFormFile("image", "image.png")
+			if err != nil {
+				s.t.Fatal(err)
+			}
+			fw.Write(r.image)
+		}
+		w.Close()
+		body, contentType = &buf, w.FormDataContentType()
+	}
+
+	req := httptest.NewRequest(r.method, r.target, body)
+	if contentType != "" {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+	if r.token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+r.token)
+	}
+	for k, v := range r.header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect does the request and checks the status code of the response.
+func (s *testServer) expect(r request, status int) *httptest.ResponseRecorder {
+	s.t.Helper()
+	rec := s.do(r)
+	if rec.Code != status {
+		s.t.Fatalf("%s %s: got status %d, want %d: %s", r.method, r.target, rec.Code, status, rec.Body)
+	}
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to decode %q: %v", rec.Body, err)
+	}
+	return v
+}
+
+// addUser registers a user and returns its ID and login token.
+func (s *testServer) addUser(name string) (int64, string) {
+	s.t.Helper()
+	password := "pw" + name
+	user := decode[registerResponse](s.t, s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: name, Password: password}}, http.StatusOK))
+	login := decode[loginResponse](s.t, s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{UserID: user.ID, Password: password}}, http.StatusOK))
+	return user.ID, login.Token
+}
+
+// addItem lists a new item of the user in the category and returns its ID.
+func (s *testServer) addItem(token string, categoryID int64, name string, price int64) int64 {
+	s.t.Helper()
+	rec := s.expect(request{method: http.MethodPost, target: "/items", token: token, form: map[string]string{
+		"name":        name,
+		"category_id": fmt.Sprint(categoryID),
+		"price":       fmt.Sprint(price),
+		"description": "description of " + name,
+	}, image: testPNG(s.t, color.RGBA{R: 0xff, A: 0xff})}, http.StatusOK)
+	return decode[addItemResponse](s.t, rec).ID
+}
+
+func (s *testServer) addCategory(token string, name string) int64 {
+	s.t.Helper()
+	rec := s.expect(request{method: http.MethodPost, target: "/items/new_category", token: token, form: map[string]string{"name": name}}, http.StatusOK)
+	return decode[addCategoryResponse](s.t, rec).ID
+}
+
+// addItemsOnSale lists items of the user in a new category and puts them on
+// sale.
+func (s *testServer) addItemsOnSale(token string, price int64, names ...string) []int64 {
+	s.t.Helper()
+	category := s.addCategory(token, "food")
+	var items []int64
+	for _, name := range names {
+		item := s.addItem(token, category, name, price)
+		s.expect(request{method: http.MethodPost, target: "/sell", token: token, json: sellRequest{ItemID: item}}, http.StatusOK)
+		items = append(items, item)
+	}
+	return items
+}
+
+func (s *testServer) deposit(token string, amount int64) {
+	s.t.Helper()
+	s.expect(request{method: http.MethodPost, target: "/balance", token: token, json: addBalanceRequest{Balance: amount}}, http.StatusOK)
+}
+
+func (s *testServer) balance(token string) int64 {
+	s.t.Helper()
+	return decode[getBalanceResponse](s.t, s.expect(request{method: http.MethodGet, target: "/balance", token: token}, http.StatusOK)).Balance
+}
+
+// purchase buys the item for the user and expects the status.
+func (s *testServer) purchase(item int64, token string, status int) {
+	s.t.Helper()
+	s.expect(request{method: http.MethodPost, target: fmt.Sprintf("/purchase/%d", item), token: token}, status)
+}
+
+func testPNG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInitialize(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := db.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "mercari.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	if _, err := db.MigrateUp(ctx, sqlDB); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := logFile
+	logFile = filepath.Join(t.TempDir(), "access.log")
+	defer func() { logFile = prev }()
+	if err := os.WriteFile(logFile, []byte("GET /items\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, &Handler{
+		DB:              sqlDB,
+		UserRepo:        db.NewUserRepository(sqlDB),
+		ItemRepo:        db.NewCachedItemRepository(db.NewItemRepository(sqlDB)),
+		LedgerRepo:      db.NewLedgerRepository(sqlDB),
+		PurchaseService: db.NewPurchaseService(sqlDB),
+		SessionRepo:     db.NewSessionRepository(sqlDB),
+		SeedConfig:      db.SeedConfig{Users: 2, Items: 3, RandSeed: 1},
+	}, db.NewIdempotencyRepository(sqlDB))
+
+	if rec := s.expect(request{method: http.MethodGet, target: "/log"}, http.StatusOK); rec.Body.String() != "GET /items\n" {
+		t.Errorf("GET /log = %q", rec.Body)
+	}
+
+	// Cache the categories before they are recreated.
+	if cats := decode[[]getCategoriesResponse](t, s.expect(request{method: http.MethodGet, target: "/items/categories"}, http.StatusOK)); len(cats) != 0 {
+		t.Errorf("GET /items/categories before initialize = %+v", cats)
+	}
+	s.expect(request{method: http.MethodPost, target: "/initialize"}, http.StatusOK)
+
+	if rec := s.expect(request{method: http.MethodGet, target: "/log"}, http.StatusOK); rec.Body.Len() != 0 {
+		t.Errorf("GET /log after initialize = %q, want the truncated log", rec.Body)
+	}
+	s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{UserID: 1, Password: db.SeedPassword}}, http.StatusOK)
+	s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{Login: "bob", Password: db.SeedPassword}}, http.StatusOK)
+	if cats := decode[[]getCategoriesResponse](t, s.expect(request{method: http.MethodGet, target: "/items/categories"}, http.StatusOK)); len(cats) != 3 {
+		t.Errorf("GET /items/categories after initialize = %+v", cats)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newMemoryServer(t)
+
+	id, token := s.addUser("alice")
+	if id != 1 || token == "" {
+		t.Errorf("addUser = %d, %q", id, token)
+	}
+
+	s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{UserID: id, Password: "wrong"}}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{Password: "pwalice"}}, http.StatusBadRequest)
+	s.expect(request{method: http.MethodGet, target: "/balance"}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodGet, target: "/balance", token: "invalid"}, http.StatusUnauthorized)
+}
+
+func TestLoginNameAndEmail(t *testing.T) {
+	s := newMemoryServer(t)
+
+	user := decode[registerResponse](t, s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{
+		Name: "Alice Liddell", Password: "pw", LoginName: "Alice", Email: "Alice@Example.com",
+	}}, http.StatusOK))
+	if user.LoginName != "alice" || user.Email != "alice@example.com" {
+		t.Errorf("POST /register = %+v", user)
+	}
+	// The login name defaults to the name.
+	if bob := decode[registerResponse](t, s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: "Bob", Password: "pw"}}, http.StatusOK)); bob.LoginName != "bob" || bob.Email != "" {
+		t.Errorf("POST /register without login_name = %+v", bob)
+	}
+
+	// A default login name that is taken gets a random number.
+	numbered := regexp.MustCompile(`^alice[0-9]{6}$`)
+	seen := map[string]bool{"alice": true}
+	for i := 0; i < 3; i++ {
+		res := decode[registerResponse](t, s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: "ALICE", Password: "pw"}}, http.StatusOK))
+		if !numbered.MatchString(res.LoginName) || seen[res.LoginName] {
+			t.Errorf("login name of another ALICE = %q", res.LoginName)
+		}
+		seen[res.LoginName] = true
+	}
+	long := strings.Repeat("d", 50)
+	s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: long, Password: "pw"}}, http.StatusOK)
+	if res := decode[registerResponse](t, s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: long, Password: "pw"}}, http.StatusOK)); len(res.LoginName) != 50 || res.LoginName[:44] != long[:44] {
+		t.Errorf("numbered login name of a long name = %q", res.LoginName)
+	}
+	if res := decode[registerResponse](t, s.expect(request{method: http.MethodPost, target: "/register", json: registerRequest{Name: "carol@example.com", Password: "pw"}}, http.StatusOK)); res.LoginName != "carolexample.com" {
+		t.Errorf("default login name of a name with @ = %q", res.LoginName)
+	}
+
+	for _, req := range []registerRequest{
+		{Name: "Alice 2", Password: "pw", LoginName: "ALICE"},
+		{Name: "Alice 3", Password: "pw", LoginName: "alice3", Email: "alice@EXAMPLE.com"},
+	} {
+		s.expect(request{method: http.MethodPost, target: "/register", json: req}, http.StatusConflict)
+	}
+	for _, req := range []registerRequest{
+		{Name: "Carol", Password: "pw", LoginName: "carol@example.com"},
+		{Name: "Carol", Password: "pw", Email: "not an email"},
+		{Name: "Carol", Password: "pw", Email: "Carol <carol@example.com>"},
+		{Name: "Carol", Password: "pw", LoginName: strings.Repeat("c", 51)},
+	} {
+		s.expect(request{method: http.MethodPost, target: "/register", json: req}, http.StatusBadRequest)
+	}
+
+	for _, login := range []string{"alice", " ALICE ", "alice@example.com", "ALICE@example.COM"} {
+		res := decode[loginResponse](t, s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{Login: login, Password: "pw"}}, http.StatusOK))
+		if res.ID != user.ID {
+			t.Errorf("POST /login as %q = %+v", login, res)
+		}
+	}
+	s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{Login: "alice", Password: "wrong"}}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{Login: "nobody", Password: "pw"}}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodPost, target: "/login", json: loginRequest{Login: "nobody@example.com", Password: "pw"}}, http.StatusUnauthorized)
+}
+
+func TestItems(t *testing.T) {
+	s := newMemoryServer(t)
+	alice, aliceToken := s.addUser("alice")
+	_, bobToken := s.addUser("bob")
+
+	s.expect(request{method: http.MethodPost, target: "/items/new_category", token: aliceToken, form: map[string]string{"name": ""}}, http.StatusBadRequest)
+	food := s.addCategory(aliceToken, "food")
+	if cats := decode[[]getCategoriesResponse](t, s.expect(request{method: http.MethodGet, target: "/items/categories"}, http.StatusOK)); len(cats) != 1 || cats[0].Name != "food" {
+		t.Errorf("GET /items/categories = %+v", cats)
+	}
+
+	// Adding items
+	s.expect(request{method: http.MethodPost, target: "/items", token: aliceToken, form: map[string]string{"name": "x", "category_id": "100"}, image: testPNG(t, color.White)}, http.StatusBadRequest)
+	s.expect(request{method: http.MethodPost, target: "/items", token: aliceToken, form: map[string]string{"name": "x", "category_id": fmt.Sprint(food)}, image: []byte("not an image")}, http.StatusBadRequest)
+	tomato := s.addItem(aliceToken, food, "Tomato", 200)
+	onion := s.addItem(aliceToken, food, "Onion", 100)
+
+	item := decode[getItemResponse](t, s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d", tomato)}, http.StatusOK))
+	if item.Name != "Tomato" || item.Price != 200 || item.UserID != alice || item.CategoryName != "food" || item.Status != 0 {
+		t.Errorf("GET /items/:itemID = %+v", item)
+	}
+	s.expect(request{method: http.MethodPut, target: fmt.Sprintf("/items/%d", tomato)}, http.StatusOK)
+
+	// An item of a missing category has an empty category name.
+	carol, _ := s.addUser("carol")
+	orphan, err := s.h.ItemRepo.AddItem(context.Background(), domain.Item{Name: "Orphan", CategoryID: 100, UserID: carol, Price: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item := decode[getItemResponse](t, s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d", orphan.ID)}, http.StatusOK)); item.Name != "Orphan" || item.CategoryName != "" {
+		t.Errorf("GET /items/:itemID of a missing category = %+v", item)
+	}
+
+	// Editing a draft
+	edit := putItemRequest{ItemID: onion, Name: "Red onion", CategoryID: food, Price: 120, Description: "red"}
+	s.expect(request{method: http.MethodPut, target: "/items/", token: bobToken, json: edit}, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodPut, target: "/items/", token: aliceToken, json: edit}, http.StatusOK)
+	if item := decode[getItemResponse](t, s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d", onion)}, http.StatusOK)); item.Name != "Red onion" || item.Price != 120 {
+		t.Errorf("item after PUT /items/ = %+v", item)
+	}
+
+	// Selling
+	s.expect(request{method: http.MethodPost, target: "/sell", token: bobToken, json: sellRequest{ItemID: tomato}}, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodPost, target: "/sell", token: aliceToken, json: sellRequest{ItemID: 100}}, http.StatusNotFound)
+	s.expect(request{method: http.MethodPost, target: "/sell", token: aliceToken, json: sellRequest{ItemID: tomato}}, http.StatusOK)
+	s.expect(request{method: http.MethodPost, target: "/sell", token: aliceToken, json: sellRequest{ItemID: tomato}}, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodPut, target: "/items/", token: aliceToken, json: putItemRequest{ItemID: tomato, Name: "x", CategoryID: food, Price: 1}}, http.StatusPreconditionFailed)
+
+	history := decode[[]getItemHistoryResponse](t, s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d/history", tomato)}, http.StatusOK))
+	if len(history) != 1 || history[0].FromStatusName != "initial" || history[0].ToStatusName != "on_sale" {
+		t.Errorf("GET /items/:itemID/history = %+v", history)
+	}
+	s.expect(request{method: http.MethodGet, target: "/items/100/history"}, http.StatusNotFound)
+
+	// Listing
+	onSale := decode[[]getOnSaleItemsResponse](t, s.expect(request{method: http.MethodGet, target: "/items"}, http.StatusOK))
+	if len(onSale) != 1 || onSale[0].ID != tomato || onSale[0].CategoryName != "food" {
+		t.Errorf("GET /items = %+v", onSale)
+	}
+	userItems := decode[pageResponse[getUserItemsResponse]](t, s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/users/%d/items?limit=1", alice), token: bobToken}, http.StatusOK))
+	if len(userItems.Items) != 1 || userItems.Items[0].ID != onion || userItems.NextCursor == "" {
+		t.Errorf("GET /users/:userID/items?limit=1 = %+v", userItems)
+	}
+	userItems = decode[pageResponse[getUserItemsResponse]](t, s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/users/%d/items?limit=1&cursor=%s", alice, userItems.NextCursor), token: bobToken}, http.StatusOK))
+	if len(userItems.Items) != 1 || userItems.Items[0].ID != tomato || userItems.NextCursor != "" {
+		t.Errorf("second page of GET /users/:userID/items = %+v", userItems)
+	}
+	s.expect(request{method: http.MethodGet, target: "/items?cursor=invalid"}, http.StatusBadRequest)
+	s.expect(request{method: http.MethodGet, target: "/items?limit=1000"}, http.StatusBadRequest)
+	// Lists without limit and cursor are plain arrays, but still limited.
+	for i := 0; i < defaultPageLimit; i++ {
+		s.addCategory(aliceToken, fmt.Sprint("category ", i))
+	}
+	if categories := decode[[]getCategoriesResponse](t, s.expect(request{method: http.MethodGet, target: "/items/categories"}, http.StatusOK)); len(categories) != defaultPageLimit {
+		t.Errorf("GET /items/categories returned %d categories, want %d", len(categories), defaultPageLimit)
+	}
+
+	// Searching
+	results := decode[[]SearchResult](t, s.expect(request{method: http.MethodGet, target: "/search?name=TOMATO"}, http.StatusOK))
+	if len(results) != 1 || results[0].ID != tomato || results[0].CategoryName != "food" {
+		t.Errorf("GET /search = %+v", results)
+	}
+	results = decode[[]SearchResult](t, s.expect(request{method: http.MethodGet, target: "/search?name=onion&status=all"}, http.StatusOK))
+	if len(results) != 1 || results[0].ID != onion {
+		t.Errorf("GET /search with status=all = %+v", results)
+	}
+	s.expect(request{method: http.MethodGet, target: "/search?sort=random"}, http.StatusBadRequest)
+}
+
+func TestBalanceAndPurchase(t *testing.T) {
+	s := newMemoryServer(t)
+	_, sellerToken := s.addUser("alice")
+	_, buyerToken := s.addUser("bob")
+	food := s.addCategory(sellerToken, "food")
+	item := s.addItem(sellerToken, food, "Tomato", 200)
+	s.expect(request{method: http.MethodPost, target: "/sell", token: sellerToken, json: sellRequest{ItemID: item}}, http.StatusOK)
+
+	purchase := request{method: http.MethodPost, target: fmt.Sprintf("/purchase/%d", item), token: buyerToken}
+	s.expect(purchase, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodPost, target: "/balance", token: buyerToken, json: addBalanceRequest{Balance: -1}}, http.StatusBadRequest)
+	s.expect(request{method: http.MethodPost, target: "/balance", token: buyerToken, json: addBalanceRequest{Balance: 500}}, http.StatusOK)
+	s.expect(request{method: http.MethodPost, target: fmt.Sprintf("/purchase/%d", item), token: sellerToken}, http.StatusPreconditionFailed)
+	s.expect(purchase, http.StatusOK)
+	s.expect(purchase, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodPost, target: "/purchase/100", token: buyerToken}, http.StatusNotFound)
+
+	// The seller is paid once the buyer receives the item.
+	for token, want := range map[string]int64{buyerToken: 300, sellerToken: 0} {
+		if res := decode[getBalanceResponse](t, s.expect(request{method: http.MethodGet, target: "/balance", token: token}, http.StatusOK)); res.Balance != want {
+			t.Errorf("GET /balance = %d, want %d", res.Balance, want)
+		}
+	}
+	history := decode[getBalanceHistoryResponse](t, s.expect(request{method: http.MethodGet, target: "/balance/history", token: buyerToken}, http.StatusOK))
+	if history.Balance != 300 || len(history.Entries) != 2 || history.Entries[0].Amount != -200 || history.Entries[0].ItemID != item {
+		t.Errorf("GET /balance/history = %+v", history)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	s := newMemoryServer(t)
+	_, token := s.addUser("alice")
+
+	deposit := request{method: http.MethodPost, target: "/balance", token: token, json: addBalanceRequest{Balance: 100}, header: map[string]string{HeaderIdempotencyKey: "key"}}
+	s.expect(deposit, http.StatusOK)
+	if rec := s.expect(deposit, http.StatusOK); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry was not replayed")
+	}
+	if res := decode[getBalanceResponse](t, s.expect(request{method: http.MethodGet, target: "/balance", token: token}, http.StatusOK)); res.Balance != 100 {
+		t.Errorf("balance after a retried deposit = %d, want 100", res.Balance)
+	}
+
+	deposit.json = addBalanceRequest{Balance: 200}
+	s.expect(deposit, http.StatusUnprocessableEntity)
+
+	// A panicking handler releases its key, so that a retry is executed.
+	repo := memory.NewIdempotencyRepository(memory.NewStore())
+	panicking := Idempotency(repo)(func(c echo.Context) error { panic("handler failed") })
+	req := httptest.NewRequest(http.MethodPost, "/balance", nil)
+	req.Header.Set(HeaderIdempotencyKey, "key")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set("user", &jwt.Token{Claims: &JwtCustomClaims{UserID: 1}})
+	func() {
+		defer func() { recover() }()
+		panicking(c)
+	}()
+	if _, ok, err := repo.Reserve(context.Background(), 1, "key", "fingerprint", time.Now().Add(time.Minute)); err != nil || !ok {
+		t.Errorf("key of a panicking request was not released: %v, %v", ok, err)
+	}
+}
+
+// BenchmarkListItems lists the items of a SQLite database seeded with 10k
+// items, with the category names joined by the list query and, for
+// comparison, looked up with one category query per item as the handlers did
+// before:
+//
+//	go test ./handler -run '^$' -bench ListItems
+func BenchmarkListItems(b *testing.B) {
+	ctx := context.Background()
+	sqlDB, err := db.Open(ctx, "sqlite://"+filepath.Join(b.TempDir(), "mercari.sqlite3"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sqlDB.Close()
+	put := func(ctx context.Context, data []byte) (domain.ItemImage, error) {
+		return domain.ItemImage{Key: "seed", ContentType: "image/png"}, nil
+	}
+	if err := db.Initialize(ctx, sqlDB, db.SeedConfig{Users: 10, Items: 10000, RandSeed: 1}, put); err != nil {
+		b.Fatal(err)
+	}
+
+	repo := db.NewItemRepository(sqlDB)
+	for _, r := range []struct {
+		name string
+		repo db.ItemRepository
+	}{
+		{"joined", db.NewCachedItemRepository(repo)},
+		{"query per item", categoryQueryPerItem{repo}},
+	} {
+		e := echo.New()
+		(&Handler{ItemRepo: r.repo}).RegisterRoutes(e)
+		for _, target := range []string{"/items", "/items?limit=100", "/users/1/items"} {
+			b.Run(r.name+" "+target, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					rec := httptest.NewRecorder()
+					e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+					if rec.Code != http.StatusOK {
+						b.Fatalf("GET %s = %d %s", target, rec.Code, rec.Body)
+					}
+				}
+			})
+		}
+	}
+}
+
+// categoryQueryPerItem looks up the category name of every listed item with
+// its own GetCategories query, like the list handlers did before the names
+// were joined.
+type categoryQueryPerItem struct {
+	db.ItemRepository
+}
+
+func (r categoryQueryPerItem) GetOnSaleItems(ctx context.Context, page db.Page) ([]domain.ItemSummary, string, error) {
+	items, next, err := r.ItemRepository.GetOnSaleItems(ctx, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, next, r.lookUpCategories(ctx, items)
+}
+
+func (r categoryQueryPerItem) GetItemsByUserID(ctx context.Context, userID int64, page db.Page) ([]domain.ItemSummary, string, error) {
+	items, next, err := r.ItemRepository.GetItemsByUserID(ctx, userID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, next, r.lookUpCategories(ctx, items)
+}
+
+func (r categoryQueryPerItem) lookUpCategories(ctx context.Context, items []domain.ItemSummary) error {
+	for i := range items {
+		cats, _, err := r.GetCategories(ctx, db.Page{})
+		if err != nil {
+			return err
+		}
+		for _, cat := range cats {
+			if cat.ID == items[i].CategoryID {
+				items[i].CategoryName = cat.Name
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultHoldDuration is how long a reservation holds an item unless
+// Handler.HoldDuration says otherwise.
+const DefaultHoldDuration = 15 * time.Minute
+
+type reserveResponse struct {
+	ItemID    int64     `json:"item_id"`
+	Amount    int64     `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Reserve holds the item for the user, who may purchase it until the hold
+// expires. Its price is taken from the balance of the user right away and
+// refunded if the hold expires.
+func (h *Handler) Reserve(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	itemID, err := paramID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	now := h.now()
+	hold, err := h.PurchaseService.Reserve(ctx, userID, itemID, now, now.Add(h.holdDuration()))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, reserveResponse{ItemID: hold.ItemID, Amount: hold.Amount, ExpiresAt: hold.ExpiresAt})
+}
+
+func (h *Handler) now() time.Time {
+	if h.Now == nil {
+		return time.Now()
+	}
+	return h.Now()
+}
+
+func (h *Handler) holdDuration() time.Duration {
+	if h.HoldDuration <= 0 {
+		return DefaultHoldDuration
+	}
+	return h.HoldDuration
+}
+
+// ExpireHolds releases the expired holds every interval until ctx is done.
+// Holds that expired are also released by the next reservation or purchase of
+// their item, so this only keeps the items listed on sale and the balances of
+// the buyers up to date.
+func (h *Handler) ExpireHolds(ctx context.Context, interval time.Duration, logger echo.Logger) {
+	h.runEvery(ctx, interval, func(now time.Time) {
+		n, err := h.PurchaseService.ReleaseExpiredHolds(ctx, now)
+		if err != nil && ctx.Err() == nil {
+			logger.Errorf("failed to release expired holds: %v", err)
+		}
+		if n > 0 && h.ResponseCache != nil {
+			h.ResponseCache.Invalidate()
+		}
+	})
+}
+
+// runEvery calls job with the current time of h.Now every interval until ctx
+// is done.
+func (h *Handler) runEvery(ctx context.Context, interval time.Duration, job func(now time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job(h.now())
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestReserve(t *testing.T) {
+	clock := newTestClock()
+	s := newMemoryServer(t, func(h *Handler) { h.Now = clock.Now })
+	_, sellerToken := s.addUser("alice")
+	_, buyerToken := s.addUser("bob")
+	_, otherToken := s.addUser("carol")
+	items := s.addItemsOnSale(sellerToken, 200, "Tomato", "Potato", "Onion")
+	s.deposit(buyerToken, 600)
+	s.deposit(otherToken, 500)
+	reserve := func(item int64, token string) request {
+		return request{method: http.MethodPost, target: fmt.Sprintf("/items/%d/reserve", item), token: token}
+	}
+
+	s.expect(reserve(items[0], sellerToken), http.StatusPreconditionFailed)
+	s.expect(reserve(100, buyerToken), http.StatusNotFound)
+	res := decode[reserveResponse](t, s.expect(reserve(items[0], buyerToken), http.StatusOK))
+	if res.ItemID != items[0] || res.Amount != 200 || !res.ExpiresAt.Equal(clock.Now().Add(DefaultHoldDuration)) {
+		t.Errorf("POST /items/%d/reserve = %+v", items[0], res)
+	}
+	s.expect(reserve(items[0], otherToken), http.StatusPreconditionFailed)
+	s.purchase(items[0], otherToken, http.StatusPreconditionFailed)
+	if got := decode[getItemResponse](t, s.expect(request{method: http.MethodGet, target: fmt.Sprint("/items/", items[0])}, http.StatusOK)); got.Status != domain.ItemStatusReserved {
+		t.Errorf("status of a reserved item = %s", got.Status)
+	}
+	s.purchase(items[0], buyerToken, http.StatusOK)
+	s.expect(reserve(items[1], buyerToken), http.StatusOK)
+	s.expect(reserve(items[2], buyerToken), http.StatusOK)
+	if got := s.balance(buyerToken); got != 0 {
+		t.Errorf("balance of the buyer with two holds = %d, want 0", got)
+	}
+
+	// Expired holds are released by the next purchase of their item or by
+	// ExpireHolds.
+	clock.Advance(DefaultHoldDuration)
+	s.purchase(items[1], otherToken, http.StatusOK)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.h.ExpireHolds(ctx, 10*time.Millisecond, echo.New().Logger)
+	for deadline := time.Now().Add(time.Second); s.balance(buyerToken) != 600-200 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := s.balance(buyerToken); got != 600-200 {
+		t.Errorf("balance of the buyer after the holds expired = %d, want %d", got, 600-200)
+	}
+	if got := s.balance(sellerToken); got != 0 {
+		t.Errorf("balance of the seller before shipping = %d, want 0", got)
+	}
+	s.expect(reserve(items[2], otherToken), http.StatusOK)
+}
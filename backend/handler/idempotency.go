@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+
+	// idempotencyLockTimeout is how long a request holds its key. A retry
+	// after that takes the key over, so that a key is not stuck in progress
+	// when the server crashed while handling the request.
+	idempotencyLockTimeout = time.Minute
+)
+
+// Idempotency replays the stored response when a mutating request is retried
+// with the same Idempotency-Key header, instead of executing it again. Keys are
+// scoped per user, so it must be registered after the JWT middleware.
+func Idempotency(repo db.IdempotencyRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if key == "" || !isMutatingMethod(c.Request().Method) {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key is too long")
+			}
+
+			ctx := c.Request().Context()
+
+			userID, err := getUserID(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, err)
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err)
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			fingerprint := requestFingerprint(c.Request(), body)
+			rec, reserved, err := repo.Reserve(ctx, userID, key, fingerprint, time.Now().Add(idempotencyLockTimeout))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
+			if !reserved {
+				if rec.Fingerprint != fingerprint {
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+				}
+				if !rec.Completed() {
+					return echo.NewHTTPError(http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+				}
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(rec.StatusCode, rec.ContentType, rec.Body)
+			}
+
+			// The key is released unless the response is stored, also when
+			// next panics, so that the client can retry.
+			handled := false
+			defer func() {
+				if handled {
+					return
+				}
+				// The request context may be canceled already.
+				if err := repo.Release(context.Background(), userID, key); err != nil {
+					c.Logger().Error(err)
+				}
+			}()
+
+			resBody := new(bytes.Buffer)
+			c.Response().Writer = &recordingResponseWriter{
+				Writer:         io.MultiWriter(c.Response().Writer, resBody),
+				ResponseWriter: c.Response().Writer,
+			}
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			// Server errors are not cached so that the client can retry them.
+			if c.Response().Status >= http.StatusInternalServerError {
+				return nil
+			}
+
+			// A key whose response could not be stored stays in progress
+			// until its lock expires rather than letting a retry execute
+			// the request again.
+			handled = true
+			rec.StatusCode = c.Response().Status
+			rec.ContentType = c.Response().Header().Get(echo.HeaderContentType)
+			rec.Body = resBody.Bytes()
+			if err := repo.Complete(ctx, rec); err != nil {
+				c.Logger().Error(err)
+			}
+			return nil
+		}
+	}
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestFingerprint identifies a request by method, URI and body. The
+// multipart boundary is removed from the body because clients generate a new
+// one on every retry.
+func requestFingerprint(req *http.Request, body []byte) string {
+	if _, params, err := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType)); err == nil {
+		if boundary := params["boundary"]; boundary != "" {
+			body = bytes.ReplaceAll(body, []byte(boundary), nil)
+		}
+	}
+
+	h := sha256.New()
+	io.WriteString(h, req.Method+" "+req.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type recordingResponseWriter struct {
+	io.Writer
+	http.ResponseWriter
+}
+
+func (w *recordingResponseWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	return w.Writer.Write(b)
+}
+
+func (w *recordingResponseWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *recordingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+const maxImageSize = 10 * 1024 * 1024 // 10MB
+
+type itemImageResponse struct {
+	ID       int64 `json:"id"`
+	Position int   `json:"position"`
+}
+
+type reorderItemImagesRequest struct {
+	ImageIDs []int64 `json:"image_ids"`
+}
+
+func newItemImagesResponse(images []domain.ItemImage) []itemImageResponse {
+	res := make([]itemImageResponse, len(images))
+	for i, image := range images {
+		res[i] = itemImageResponse{ID: image.ID, Position: image.Position}
+	}
+	return res
+}
+
+// GetItemImages lists the images of the item in display order.
+func (h *Handler) GetItemImages(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := paramID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.ItemRepo.GetItem(ctx, itemID); err != nil {
+		return err
+	}
+
+	images, err := h.ItemRepo.GetItemImages(ctx, itemID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, newItemImagesResponse(images))
+}
+
+// GetItemImageByIndex responds with the image at the 0-based index in the
+// display order of the item's images.
+func (h *Handler) GetItemImageByIndex(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	itemID, err := paramID(c, "itemID")
+	if err != nil {
+		return err
+	}
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid index")
+	}
+
+	images, err := h.ItemRepo.GetItemImages(ctx, itemID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if index >= len(images) {
+		return echo.NewHTTPError(http.StatusNotFound, "image not found")
+	}
+
+	return h.serveImage(c, images[index])
+}
+
+// AddItemImage adds the uploaded image after the existing images of the item.
+func (h *Handler) AddItemImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getOwnItem(c)
+	if err != nil {
+		return err
+	}
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	src, err := file.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	defer src.Close()
+
+	var blob bytes.Buffer
+	if n, err := io.Copy(&blob, io.LimitReader(src, maxImageSize+1)); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	} else if n > maxImageSize {
+		return echo.NewHTTPError(http.StatusBadRequest, "Request size exceeds the limit.")
+	}
+
+	image, err := h.storeImage(ctx, blob.Bytes())
+	if err != nil {
+		if isInvalidImage(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	image, err = h.ItemRepo.AddItemImage(ctx, item.ID, image)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, itemImageResponse{ID: image.ID, Position: image.Position})
+}
+
+// DeleteItemImage removes an image from the item. The last image of an item
+// cannot be removed.
+func (h *Handler) DeleteItemImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getOwnItem(c)
+	if err != nil {
+		return err
+	}
+	imageID, err := paramID(c, "imageID")
+	if err != nil {
+		return err
+	}
+
+	if err := h.ItemRepo.DeleteItemImage(ctx, item.ID, imageID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// ReorderItemImages sets the display order of the item's images. The first
+// image becomes the primary image.
+func (h *Handler) ReorderItemImages(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getOwnItem(c)
+	if err != nil {
+		return err
+	}
+	req := new(reorderItemImagesRequest)
+	if err := bind(c, req); err != nil {
+		return err
+	}
+
+	if err := h.ItemRepo.ReorderItemImages(ctx, item.ID, req.ImageIDs); err != nil {
+		return err
+	}
+
+	images, err := h.ItemRepo.GetItemImages(ctx, item.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, newItemImagesResponse(images))
+}
+
+// getOwnItem returns the item of the itemID path parameter if it belongs to
+// the logged in user.
+func (h *Handler) getOwnItem(c echo.Context) (domain.Item, error) {
+	userID, err := getUserID(c)
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	itemID, err := paramID(c, "itemID")
+	if err != nil {
+		return domain.Item{}, err
+	}
+
+	item, err := h.ItemRepo.GetItem(c.Request().Context(), itemID)
+	if err != nil {
+		return domain.Item{}, err
+	}
+	if item.UserID != userID {
+		return domain.Item{}, echo.NewHTTPError(http.StatusPreconditionFailed, "user ID mismatch")
+	}
+	return item, nil
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"fmt"
+	"image/color"
+	"net/http"
+	"testing"
+)
+
+func TestItemImages(t *testing.T) {
+	s := newMemoryServer(t)
+	_, aliceToken := s.addUser("alice")
+	_, bobToken := s.addUser("bob")
+	item := s.addItem(aliceToken, s.addCategory(aliceToken, "food"), "Tomato", 200)
+	images := fmt.Sprintf("/items/%d/images", item)
+
+	// The primary image
+	rec := s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d/image", item)}, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	etag := rec.Header().Get("ETag")
+	s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d/image", item), header: map[string]string{"If-None-Match": etag}}, http.StatusNotModified)
+	if thumb := s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d/image?size=thumb", item)}, http.StatusOK); thumb.Header().Get("ETag") == etag {
+		t.Errorf("the thumbnail has the ETag of the full image")
+	}
+	s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d/image?size=huge", item)}, http.StatusBadRequest)
+	s.expect(request{method: http.MethodGet, target: "/items/100/image"}, http.StatusNotFound)
+
+	// Adding
+	s.expect(request{method: http.MethodPost, target: images, token: bobToken, image: testPNG(t, color.White)}, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodPost, target: images, token: aliceToken, image: []byte("not an image")}, http.StatusBadRequest)
+	s.expect(request{method: http.MethodPost, target: images, token: aliceToken, image: append(testPNG(t, color.White), "trailing"...)}, http.StatusBadRequest)
+	added := decode[itemImageResponse](t, s.expect(request{method: http.MethodPost, target: images, token: aliceToken, image: testPNG(t, color.White)}, http.StatusOK))
+	if added.Position != 1 {
+		t.Errorf("position of the added image = %d, want 1", added.Position)
+	}
+
+	list := decode[[]itemImageResponse](t, s.expect(request{method: http.MethodGet, target: images}, http.StatusOK))
+	if len(list) != 2 || list[1] != added {
+		t.Fatalf("GET /items/:itemID/images = %+v", list)
+	}
+	s.expect(request{method: http.MethodGet, target: "/items/100/images"}, http.StatusNotFound)
+	s.expect(request{method: http.MethodGet, target: images + "/1"}, http.StatusOK)
+	s.expect(request{method: http.MethodGet, target: images + "/2"}, http.StatusNotFound)
+	s.expect(request{method: http.MethodGet, target: images + "/-1"}, http.StatusBadRequest)
+
+	// Reordering
+	s.expect(request{method: http.MethodPut, target: images, token: aliceToken, json: reorderItemImagesRequest{ImageIDs: []int64{added.ID}}}, http.StatusBadRequest)
+	reordered := decode[[]itemImageResponse](t, s.expect(request{method: http.MethodPut, target: images, token: aliceToken, json: reorderItemImagesRequest{ImageIDs: []int64{added.ID, list[0].ID}}}, http.StatusOK))
+	if len(reordered) != 2 || reordered[0].ID != added.ID || reordered[1].ID != list[0].ID {
+		t.Errorf("PUT /items/:itemID/images = %+v", reordered)
+	}
+	if rec := s.expect(request{method: http.MethodGet, target: fmt.Sprintf("/items/%d/image", item)}, http.StatusOK); rec.Header().Get("ETag") == etag {
+		t.Errorf("the primary image did not change after reordering")
+	}
+
+	// Deleting
+	s.expect(request{method: http.MethodDelete, target: fmt.Sprintf("%s/%d", images, added.ID), token: bobToken}, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodDelete, target: fmt.Sprintf("%s/%d", images, added.ID), token: aliceToken}, http.StatusOK)
+	s.expect(request{method: http.MethodDelete, target: fmt.Sprintf("%s/%d", images, added.ID), token: aliceToken}, http.StatusNotFound)
+	s.expect(request{method: http.MethodDelete, target: fmt.Sprintf("%s/%d", images, list[0].ID), token: aliceToken}, http.StatusPreconditionFailed)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+var errNoLoginIdentifier = errors.New("login or user_id is required")
+
+// normalizeLogin returns a login name or an email as it is stored and looked
+// up. Login names cannot contain @, which tells emails apart at login.
+func normalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// loginAccount returns the identifier of the login request, normalized like
+// it is looked up, or an empty string if there is none.
+func loginAccount(req *loginRequest) string {
+	if login := normalizeLogin(req.Login); login != "" {
+		return login
+	}
+	if req.UserID != 0 {
+		return "id:" + strconv.FormatInt(req.UserID, 10)
+	}
+	return ""
+}
+
+// getLoginUser returns the user identified by the login request.
+func (h *Handler) getLoginUser(ctx context.Context, req *loginRequest) (domain.User, error) {
+	login := normalizeLogin(req.Login)
+	switch {
+	case strings.Contains(login, "@"):
+		return h.UserRepo.GetUserByEmail(ctx, login)
+	case login != "":
+		return h.UserRepo.GetUserByLoginName(ctx, login)
+	case req.UserID != 0:
+		return h.UserRepo.GetUser(ctx, req.UserID)
+	}
+	return domain.User{}, errNoLoginIdentifier
+}
+
+const (
+	maxLoginNameLen = 50
+	// defaultLoginNameDigits is the length of the random number appended to
+	// a default login name that is taken.
+	defaultLoginNameDigits = 6
+)
+
+// addUserWithDefaultLoginName adds the user with a login name derived from
+// their name: lowercased and without @. If another user has it, a random
+// number is appended, e.g. alice482913, until one is free. It returns the ID
+// and the login name.
+func (h *Handler) addUserWithDefaultLoginName(ctx context.Context, user domain.User) (int64, string, error) {
+	base := strings.ReplaceAll(normalizeLogin(user.Name), "@", "")
+	if base == "" {
+		base = "user"
+	}
+	user.LoginName = truncateLoginName(base, 0)
+	for {
+		id, err := h.UserRepo.AddUser(ctx, user)
+		if !errors.Is(err, db.ErrLoginNameTaken) {
+			return id, user.LoginName, err
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(1e6))
+		if err != nil {
+			return 0, "", err
+		}
+		user.LoginName = truncateLoginName(base, defaultLoginNameDigits) + fmt.Sprintf("%06d", n)
+	}
+}
+
+// truncateLoginName shortens base so that n more characters fit within
+// maxLoginNameLen.
+func truncateLoginName(base string, n int) string {
+	if runes := []rune(base); len(runes)+n > maxLoginNameLen {
+		return string(runes[:maxLoginNameLen-n])
+	}
+	return base
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// DefaultEscrowRelease is how long after shipping an order is completed for
+// the buyer unless Handler.EscrowRelease says otherwise.
+const DefaultEscrowRelease = 14 * 24 * time.Hour
+
+type shipRequest struct {
+	TrackingNumber string `json:"tracking_number" validate:"required,max=100"`
+}
+
+type orderResponse struct {
+	ID             int64              `json:"id"`
+	ItemID         int64              `json:"item_id"`
+	BuyerID        int64              `json:"buyer_id"`
+	SellerID       int64              `json:"seller_id"`
+	Amount         int64              `json:"amount"`
+	Status         domain.OrderStatus `json:"status"`
+	TrackingNumber string             `json:"tracking_number,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	ShippedAt      *time.Time         `json:"shipped_at,omitempty"`
+	CompletedAt    *time.Time         `json:"completed_at,omitempty"`
+}
+
+func newOrderResponse(o domain.Order) orderResponse {
+	res := orderResponse{
+		ID:             o.ID,
+		ItemID:         o.ItemID,
+		BuyerID:        o.BuyerID,
+		SellerID:       o.SellerID,
+		Amount:         o.Amount,
+		Status:         o.Status,
+		TrackingNumber: o.TrackingNumber,
+		CreatedAt:      o.CreatedAt,
+	}
+	if !o.ShippedAt.IsZero() {
+		res.ShippedAt = &o.ShippedAt
+	}
+	if !o.CompletedAt.IsZero() {
+		res.CompletedAt = &o.CompletedAt
+	}
+	return res
+}
+
+// GetOrders lists the orders the user bought or sold, newest first. The role
+// query parameter, buyer or seller, keeps only one of them.
+func (h *Handler) GetOrders(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	role := c.QueryParam("role")
+	if role != "" && role != "buyer" && role != "seller" {
+		return echo.NewHTTPError(http.StatusBadRequest, "role must be buyer or seller")
+	}
+
+	orders, err := h.OrderService.GetOrdersByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	res := []orderResponse{}
+	for _, o := range orders {
+		if role == "buyer" && o.BuyerID != userID || role == "seller" && o.SellerID != userID {
+			continue
+		}
+		res = append(res, newOrderResponse(o))
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Ship marks the purchased item as sent by its seller.
+func (h *Handler) Ship(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(shipRequest)
+	if err := bind(c, req); err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	itemID, err := paramID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	order, err := h.OrderService.Ship(ctx, userID, itemID, req.TrackingNumber, h.now())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newOrderResponse(order))
+}
+
+// Receive confirms that the buyer received the shipped item, which pays the
+// seller from escrow.
+func (h *Handler) Receive(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	itemID, err := paramID(c, "itemID")
+	if err != nil {
+		return err
+	}
+
+	order, err := h.OrderService.Receive(ctx, userID, itemID, h.now())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newOrderResponse(order))
+}
+
+func (h *Handler) escrowRelease() time.Duration {
+	if h.EscrowRelease <= 0 {
+		return DefaultEscrowRelease
+	}
+	return h.EscrowRelease
+}
+
+// CompleteShippedOrders completes every interval, until ctx is done, the
+// orders shipped at least EscrowRelease ago whose buyers did not confirm the
+// receipt, so that the sellers are paid.
+func (h *Handler) CompleteShippedOrders(ctx context.Context, interval time.Duration, logger echo.Logger) {
+	h.runEvery(ctx, interval, func(now time.Time) {
+		n, err := h.OrderService.CompleteShippedOrders(ctx, now, now.Add(-h.escrowRelease()))
+		if err != nil && ctx.Err() == nil {
+			logger.Errorf("failed to complete shipped orders: %v", err)
+		}
+		if n > 0 && h.ResponseCache != nil {
+			h.ResponseCache.Invalidate()
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestOrders(t *testing.T) {
+	clock := newTestClock()
+	s := newMemoryServer(t, func(h *Handler) { h.Now = clock.Now })
+	sellerID, sellerToken := s.addUser("alice")
+	buyerID, buyerToken := s.addUser("bob")
+	items := s.addItemsOnSale(sellerToken, 200, "Tomato", "Potato")
+	s.deposit(buyerToken, 500)
+	for _, item := range items {
+		s.purchase(item, buyerToken, http.StatusOK)
+	}
+	ship := func(item int64, token string, tracking string) request {
+		return request{method: http.MethodPost, target: fmt.Sprintf("/items/%d/ship", item), token: token, json: shipRequest{TrackingNumber: tracking}}
+	}
+	receive := func(item int64, token string) request {
+		return request{method: http.MethodPost, target: fmt.Sprintf("/items/%d/receive", item), token: token}
+	}
+	orders := func(target string, token string) []orderResponse {
+		return decode[[]orderResponse](t, s.expect(request{method: http.MethodGet, target: target, token: token}, http.StatusOK))
+	}
+
+	for _, token := range []string{sellerToken, buyerToken} {
+		got := orders("/orders", token)
+		if len(got) != 2 || got[0].ItemID != items[1] || got[1].BuyerID != buyerID || got[1].SellerID != sellerID || got[1].Status != domain.OrderStatusPaid || got[1].ShippedAt != nil {
+			t.Errorf("GET /orders = %+v", got)
+		}
+	}
+	if got := orders("/orders?role=seller", buyerToken); len(got) != 0 {
+		t.Errorf("GET /orders?role=seller of the buyer = %+v", got)
+	}
+	if got := orders("/orders?role=buyer", buyerToken); len(got) != 2 {
+		t.Errorf("GET /orders?role=buyer of the buyer = %+v", got)
+	}
+	s.expect(request{method: http.MethodGet, target: "/orders?role=admin", token: buyerToken}, http.StatusBadRequest)
+
+	s.expect(ship(items[0], sellerToken, ""), http.StatusBadRequest)
+	s.expect(ship(items[0], buyerToken, "T1"), http.StatusPreconditionFailed)
+	s.expect(ship(100, sellerToken, "T1"), http.StatusNotFound)
+	s.expect(receive(items[0], buyerToken), http.StatusPreconditionFailed)
+	res := decode[orderResponse](t, s.expect(ship(items[0], sellerToken, "T1"), http.StatusOK))
+	if res.Status != domain.OrderStatusShipped || res.TrackingNumber != "T1" || res.ShippedAt == nil || !res.ShippedAt.Equal(clock.Now()) {
+		t.Errorf("POST /items/%d/ship = %+v", items[0], res)
+	}
+	s.expect(ship(items[0], sellerToken, "T1"), http.StatusPreconditionFailed)
+	s.expect(receive(items[0], sellerToken), http.StatusPreconditionFailed)
+	if got := s.balance(sellerToken); got != 0 {
+		t.Errorf("balance of the seller after shipping = %d, want 0", got)
+	}
+	res = decode[orderResponse](t, s.expect(receive(items[0], buyerToken), http.StatusOK))
+	if res.Status != domain.OrderStatusCompleted || res.CompletedAt == nil || !res.CompletedAt.Equal(clock.Now()) {
+		t.Errorf("POST /items/%d/receive = %+v", items[0], res)
+	}
+	s.expect(receive(items[0], buyerToken), http.StatusPreconditionFailed)
+	if got := s.balance(sellerToken); got != 200 {
+		t.Errorf("balance of the seller after receiving = %d, want 200", got)
+	}
+	if got := decode[getItemResponse](t, s.expect(request{method: http.MethodGet, target: fmt.Sprint("/items/", items[0])}, http.StatusOK)); got.Status != domain.ItemStatusCompleted {
+		t.Errorf("status of a received item = %s", got.Status)
+	}
+
+	// Shipped orders are completed for the buyer after EscrowRelease.
+	s.expect(ship(items[1], sellerToken, "T2"), http.StatusOK)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.h.CompleteShippedOrders(ctx, 10*time.Millisecond, echo.New().Logger)
+	time.Sleep(50 * time.Millisecond)
+	if got := s.balance(sellerToken); got != 200 {
+		t.Errorf("balance of the seller before the escrow release = %d, want 200", got)
+	}
+	clock.Advance(DefaultEscrowRelease)
+	for deadline := time.Now().Add(time.Second); s.balance(sellerToken) != 400 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := s.balance(sellerToken); got != 400 {
+		t.Errorf("balance of the seller after the escrow release = %d, want 400", got)
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+// RateLimit allows Limit requests within any Window.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// AuthLimits protect the authentication endpoints against brute force.
+type AuthLimits struct {
+	LoginPerIP RateLimit
+	// LoginPerAccount limits the logins with the same login name, email or
+	// user ID, wherever they come from.
+	LoginPerAccount RateLimit
+	RegisterPerIP   RateLimit
+	// Lockout locks an account after repeated wrong passwords.
+	Lockout domain.LockoutPolicy
+	// ExemptNetworks are clients, such as a benchmarker, that the per IP
+	// limits do not apply to. The per account limit and the lockout do.
+	ExemptNetworks []*net.IPNet
+}
+
+func (l AuthLimits) exempt(ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, network := range l.ExemptNetworks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+var DefaultAuthLimits = AuthLimits{
+	LoginPerIP:      RateLimit{Limit: 20, Window: time.Minute},
+	LoginPerAccount: RateLimit{Limit: 10, Window: 5 * time.Minute},
+	RegisterPerIP:   RateLimit{Limit: 10, Window: time.Hour},
+	Lockout:         domain.LockoutPolicy{Threshold: 5, Base: time.Minute, Max: time.Hour},
+}
+
+// IPExtractor returns the IP of the client: the one X-Forwarded-For names when
+// the connection comes from one of trustedProxies, or else the connection's.
+// Nothing else is trusted, so that clients cannot pick the IP their requests
+// are rate limited by.
+func IPExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// limitByIP is the middleware of an endpoint limited per client IP. The
+// limits of each endpoint are counted separately.
+func (h *Handler) limitByIP(endpoint string, limit RateLimit) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := c.RealIP()
+			if h.AuthLimits.exempt(ip) {
+				return next(c)
+			}
+			if err := h.rateLimit(c, endpoint+":ip:"+ip, limit); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// rateLimit counts a request on key, and returns 429 if it is over the limit.
+// Nothing is limited without a RateLimitRepo.
+func (h *Handler) rateLimit(c echo.Context, key string, limit RateLimit) error {
+	if h.RateLimitRepo == nil {
+		return nil
+	}
+	retryAfter, err := h.RateLimitRepo.AddHit(c.Request().Context(), key, time.Now(), limit.Window, limit.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if retryAfter > 0 {
+		return tooManyRequests(c, retryAfter, "too many requests")
+	}
+	return nil
+}
+
+// checkLockout returns 429 while the account of the user is locked.
+func (h *Handler) checkLockout(c echo.Context, userID int64) error {
+	if h.RateLimitRepo == nil {
+		return nil
+	}
+	now := time.Now()
+	lockout, err := h.RateLimitRepo.GetLockout(c.Request().Context(), lockoutKey(userID), now)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if retryAfter := lockout.RetryAfter(now); retryAfter > 0 {
+		return tooManyRequests(c, retryAfter, "account is locked after too many failed logins")
+	}
+	return nil
+}
+
+// recordLogin counts a failed login toward the lockout of the account, or
+// resets the count after a successful one.
+func (h *Handler) recordLogin(c echo.Context, userID int64, ok bool) error {
+	if h.RateLimitRepo == nil {
+		return nil
+	}
+	if ok {
+		return h.RateLimitRepo.ResetFailures(c.Request().Context(), lockoutKey(userID))
+	}
+	_, err := h.RateLimitRepo.AddFailure(c.Request().Context(), lockoutKey(userID), time.Now(), h.AuthLimits.Lockout)
+	return err
+}
+
+func lockoutKey(userID int64) string {
+	return "login:user:" + strconv.FormatInt(userID, 10)
+}
+
+// tooManyRequests returns 429 with the Retry-After header in whole seconds,
+// rounded up so that a client retrying on time is not refused again.
+func tooManyRequests(c echo.Context, retryAfter time.Duration, message string) error {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	return echo.NewHTTPError(http.StatusTooManyRequests, message)
+}
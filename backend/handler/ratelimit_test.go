@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+func TestAuthLimits(t *testing.T) {
+	store := memory.NewStore()
+	s := newTestServer(t, &Handler{
+		UserRepo:      memory.NewUserRepository(store),
+		LedgerRepo:    memory.NewLedgerRepository(store),
+		SessionRepo:   memory.NewSessionRepository(store),
+		RateLimitRepo: memory.NewRateLimitRepository(store),
+		AuthLimits: AuthLimits{
+			LoginPerIP:      RateLimit{Limit: 3, Window: time.Minute},
+			LoginPerAccount: RateLimit{Limit: 3, Window: time.Minute},
+			RegisterPerIP:   RateLimit{Limit: 2, Window: time.Hour},
+			Lockout:         domain.LockoutPolicy{Threshold: 2, Base: time.Minute, Max: time.Hour},
+			ExemptNetworks:  []*net.IPNet{{IP: net.IPv4(198, 18, 0, 0), Mask: net.CIDRMask(15, 32)}},
+		},
+	}, memory.NewIdempotencyRepository(store))
+
+	from := func(ip string) map[string]string { return map[string]string{echo.HeaderXForwardedFor: ip} }
+	register := func(ip string, name string, status int) {
+		t.Helper()
+		s.expect(request{method: http.MethodPost, target: "/register", header: from(ip), json: registerRequest{Name: name, Password: "pw"}}, status)
+	}
+	login := func(ip string, name string, password string, status int) string {
+		t.Helper()
+		rec := s.expect(request{method: http.MethodPost, target: "/login", header: from(ip), json: loginRequest{Login: name, Password: password}}, status)
+		return rec.Header().Get("Retry-After")
+	}
+
+	// Registrations are limited per IP.
+	register("203.0.113.10", "alice", http.StatusOK)
+	register("203.0.113.10", "bob", http.StatusOK)
+	rec := s.expect(request{method: http.MethodPost, target: "/register", header: from("203.0.113.10"), json: registerRequest{Name: "carol", Password: "pw"}}, http.StatusTooManyRequests)
+	if got := rec.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After = %q, want 3600", got)
+	}
+	register("203.0.113.11", "carol", http.StatusOK)
+
+	// Wrong passwords lock the account, even for the right password.
+	login("198.51.100.1", "alice", "wrong", http.StatusUnauthorized)
+	login("198.51.100.2", "alice", "wrong", http.StatusUnauthorized)
+	if got := login("198.51.100.3", "alice", "pw", http.StatusTooManyRequests); got != "60" {
+		t.Errorf("Retry-After of a locked account = %q, want 60", got)
+	}
+	// The account is also limited, wherever the logins come from.
+	rec = s.expect(request{method: http.MethodPost, target: "/login", header: from("198.51.100.4"), json: loginRequest{Login: "ALICE", Password: "pw"}}, http.StatusTooManyRequests)
+	if strings.Contains(rec.Body.String(), "locked") {
+		t.Errorf("POST /login over the account limit = %s, want the rate limit", rec.Body)
+	}
+
+	// A successful login resets the failures.
+	login("198.51.100.5", "bob", "wrong", http.StatusUnauthorized)
+	login("198.51.100.6", "bob", "pw", http.StatusOK)
+	login("198.51.100.7", "bob", "wrong", http.StatusUnauthorized)
+
+	// Logins are limited per IP, whichever account they try.
+	for _, name := range []string{"x1", "x2", "x3"} {
+		login("203.0.113.1", name, "pw", http.StatusUnauthorized)
+	}
+	if got := login("203.0.113.1", "carol", "pw", http.StatusTooManyRequests); got == "" {
+		t.Error("429 without Retry-After")
+	}
+	login("203.0.113.2", "carol", "pw", http.StatusOK)
+
+	// Exempt networks are not limited per IP, but still locked out.
+	for _, name := range []string{"dave", "erin", "frank"} {
+		register("198.18.0.1", name, http.StatusOK)
+	}
+	login("198.18.0.1", "dave", "wrong", http.StatusUnauthorized)
+	login("198.18.0.1", "dave", "wrong", http.StatusUnauthorized)
+	login("198.18.0.1", "dave", "pw", http.StatusTooManyRequests)
+}
+
+func TestIPExtractor(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	tests := []struct {
+		name           string
+		trustedProxies []*net.IPNet
+		remoteAddr     string
+		xff            string
+		want           string
+	}{
+		{"no trusted proxies", nil, "10.0.0.1:1234", "203.0.113.1", "10.0.0.1"},
+		{"trusted proxy", []*net.IPNet{proxies}, "10.0.0.1:1234", "203.0.113.1", "203.0.113.1"},
+		{"proxy chain", []*net.IPNet{proxies}, "10.0.0.1:1234", "203.0.113.1, 10.0.0.2", "203.0.113.1"},
+		{"spoofed by the client", []*net.IPNet{proxies}, "10.0.0.1:1234", "192.0.2.1, 203.0.113.1", "203.0.113.1"},
+		{"untrusted proxy", []*net.IPNet{proxies}, "192.168.0.1:1234", "203.0.113.1", "192.168.0.1"},
+		{"loopback", []*net.IPNet{proxies}, "127.0.0.1:1234", "203.0.113.1", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, tt.xff)
+		if got := IPExtractor(tt.trustedProxies)(req); got != tt.want {
+			t.Errorf("%s: IP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
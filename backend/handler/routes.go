@@ -0,0 +1,46 @@
+package handler
+
+import "github.com/labstack/echo/v4"
+
+// RegisterRoutes registers the endpoints of h. login are the middlewares of
+// the endpoints that require login, starting with authentication.
+func (h *Handler) RegisterRoutes(e *echo.Echo, login ...echo.MiddlewareFunc) {
+	e.POST("/initialize", h.Initialize, h.invalidateResponses)
+	e.GET("/log", h.AccessLog)
+
+	e.GET("/items", h.GetOnSaleItems, h.conditionalGET)
+	e.GET("/items/:itemID", h.GetItem, h.conditionalGET)
+	e.PUT("/items/:itemID", h.GetItem)
+	e.GET("/items/:itemID/image", h.GetImage, h.conditionalGET)
+	e.GET("/items/:itemID/images", h.GetItemImages, h.conditionalGET)
+	e.GET("/items/:itemID/images/:index", h.GetItemImageByIndex, h.conditionalGET)
+	e.GET("/items/:itemID/history", h.GetItemHistory, h.conditionalGET)
+	e.GET("/items/categories", h.GetCategories, h.conditionalGET)
+	e.GET("/search", h.SearchItems)
+	e.POST("/register", h.Register, h.limitByIP("register", h.AuthLimits.RegisterPerIP))
+	e.POST("/login", h.Login, h.limitByIP("login", h.AuthLimits.LoginPerIP))
+	e.POST("/token/refresh", h.RefreshToken)
+	e.GET("/.well-known/jwks.json", h.JWKS)
+
+	// Login required
+	l := e.Group("", login...)
+	l.GET("/users/:userID/items", h.GetUserItems)
+	l.POST("/items", h.AddItem, h.invalidateResponses)
+	l.POST("/sell", h.Sell, h.invalidateResponses)
+	l.POST("/purchase/:itemID", h.Purchase, h.invalidateResponses)
+	l.POST("/items/:itemID/reserve", h.Reserve, h.invalidateResponses)
+	l.POST("/items/:itemID/ship", h.Ship, h.invalidateResponses)
+	l.POST("/items/:itemID/receive", h.Receive, h.invalidateResponses)
+	l.GET("/orders", h.GetOrders)
+	l.GET("/balance", h.GetBalance)
+	l.POST("/balance", h.AddBalance)
+	l.GET("/balance/history", h.GetBalanceHistory)
+	l.POST("/items/new_category", h.AddCategory, h.invalidateResponses)
+	l.PUT("/items/", h.PutItem, h.invalidateResponses)
+	l.POST("/items/:itemID/images", h.AddItemImage, h.invalidateResponses)
+	l.PUT("/items/:itemID/images", h.ReorderItemImages, h.invalidateResponses)
+	l.DELETE("/items/:itemID/images/:imageID", h.DeleteItemImage, h.invalidateResponses)
+	l.POST("/logout", h.Logout)
+	l.GET("/sessions", h.GetSessions)
+	l.DELETE("/sessions/:sessionID", h.DeleteSession)
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	// AccessTokenTTL is short because an access token is checked against its
+	// session only while it is used. Clients get a new one with the refresh
+	// token of the session.
+	AccessTokenTTL = 15 * time.Minute
+
+	maxUserAgentLen = 255
+)
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type sessionResponse struct {
+	ID         int64  `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+	// Current is set for the session of the access token of the request.
+	Current bool `json:"current"`
+}
+
+// ParseAccessToken is the ParseTokenFunc of the JWT middleware. On top of the
+// signature and the expiry it checks that the session of the token is still
+// active, so that logged out tokens are refused.
+func (h *Handler) ParseAccessToken(c echo.Context, tokenString string) (interface{}, error) {
+	token, err := h.Keys.Parse(tokenString, new(JwtCustomClaims))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*JwtCustomClaims)
+	session, err := h.SessionRepo.GetSession(c.Request().Context(), claims.SessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, errors.New("unknown session")
+		}
+		return nil, err
+	}
+	if session.UserID != claims.UserID || !session.Active(time.Now()) {
+		return nil, errors.New("session is not active")
+	}
+	return token, nil
+}
+
+// issueTokens returns the response of a login or a refresh of the session.
+func (h *Handler) issueTokens(user domain.User, session domain.Session, refreshToken string) (loginResponse, error) {
+	claims := &JwtCustomClaims{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+		},
+	}
+	accessToken, err := h.Keys.Sign(claims)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	return loginResponse{
+		ID:           user.ID,
+		Name:         user.Name,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// startSession starts a session of the user who just logged in.
+func (h *Handler) startSession(c echo.Context, user domain.User) (loginResponse, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return loginResponse{}, err
+	}
+	userAgent := c.Request().UserAgent()
+	if len(userAgent) > maxUserAgentLen {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLen], "")
+	}
+	session, err := h.SessionRepo.AddSession(c.Request().Context(), user.ID, hash, userAgent)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	return h.issueTokens(user, session, refreshToken)
+}
+
+// RefreshToken exchanges a refresh token for a new access token. The refresh
+// token is rotated, so the one in the request cannot be used again.
+func (h *Handler) RefreshToken(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(refreshTokenRequest)
+	if err := bind(c, req); err != nil {
+		return err
+	}
+
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	session, err := h.SessionRepo.RotateRefreshToken(ctx, hashRefreshToken(req.RefreshToken), hash)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.UserRepo.GetUser(ctx, session.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	res, err := h.issueTokens(user, session, refreshToken)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Logout revokes the session of the access token, together with its refresh
+// token and every access token issued for it.
+func (h *Handler) Logout(c echo.Context) error {
+	sessionID, err := getSessionID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	if err := h.SessionRepo.RevokeSession(c.Request().Context(), sessionID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) GetSessions(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	sessionID, err := getSessionID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	sessions, err := h.SessionRepo.GetActiveSessionsByUserID(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	res := make([]sessionResponse, len(sessions))
+	for i, s := range sessions {
+		res[i] = sessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == sessionID,
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteSession revokes a session of the user, e.g. a login on a lost device.
+func (h *Handler) DeleteSession(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+	sessionID, err := paramID(c, "sessionID")
+	if err != nil {
+		return err
+	}
+
+	session, err := h.SessionRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "user ID mismatch")
+	}
+	if err := h.SessionRepo.RevokeSession(ctx, sessionID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// JWKS publishes the public keys that verify the access tokens, so that other
+// services can verify them without sharing a secret.
+func (h *Handler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.Keys.JWKS())
+}
+
+func getSessionID(c echo.Context) (int64, error) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return -1, fmt.Errorf("invalid token")
+	}
+	claims, ok := token.Claims.(*JwtCustomClaims)
+	if !ok {
+		return -1, fmt.Errorf("invalid token")
+	}
+	return claims.SessionID, nil
+}
+
+// newRefreshToken returns a random refresh token and the hash it is stored as.
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/auth"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
+)
+
+func TestSessions(t *testing.T) {
+	s := newMemoryServer(t)
+	alice, _ := s.addUser("alice")
+	_, bobToken := s.addUser("bob")
+
+	login := func(userAgent string) loginResponse {
+		t.Helper()
+		return decode[loginResponse](t, s.expect(request{
+			method: http.MethodPost, target: "/login", header: map[string]string{"User-Agent": userAgent},
+			json: loginRequest{UserID: alice, Password: "pwalice"},
+		}, http.StatusOK))
+	}
+	phone, laptop := login("phone"), login("laptop")
+	if phone.RefreshToken == "" || phone.ExpiresIn != int64(AccessTokenTTL.Seconds()) {
+		t.Errorf("POST /login = %+v", phone)
+	}
+
+	sessions := decode[[]sessionResponse](t, s.expect(request{method: http.MethodGet, target: "/sessions", token: laptop.Token}, http.StatusOK))
+	// The session of addUser, phone and laptop.
+	if len(sessions) != 3 {
+		t.Fatalf("GET /sessions = %+v, want 3 sessions", sessions)
+	}
+	var phoneSession int64
+	for _, session := range sessions {
+		if session.Current != (session.UserAgent == "laptop") {
+			t.Errorf("session %+v: current is wrong", session)
+		}
+		if session.UserAgent == "phone" {
+			phoneSession = session.ID
+		}
+	}
+
+	// Refreshing rotates the refresh token.
+	s.expect(request{method: http.MethodPost, target: "/token/refresh", json: refreshTokenRequest{}}, http.StatusBadRequest)
+	refreshed := decode[loginResponse](t, s.expect(request{method: http.MethodPost, target: "/token/refresh", json: refreshTokenRequest{RefreshToken: phone.RefreshToken}}, http.StatusOK))
+	if refreshed.ID != alice || refreshed.Token == "" || refreshed.RefreshToken == phone.RefreshToken {
+		t.Errorf("POST /token/refresh = %+v", refreshed)
+	}
+	s.expect(request{method: http.MethodPost, target: "/token/refresh", json: refreshTokenRequest{RefreshToken: phone.RefreshToken}}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodGet, target: "/balance", token: refreshed.Token}, http.StatusOK)
+
+	// Killing another login.
+	s.expect(request{method: http.MethodDelete, target: "/sessions/x", token: laptop.Token}, http.StatusBadRequest)
+	s.expect(request{method: http.MethodDelete, target: "/sessions/100", token: laptop.Token}, http.StatusNotFound)
+	s.expect(request{method: http.MethodDelete, target: fmt.Sprintf("/sessions/%d", phoneSession), token: bobToken}, http.StatusPreconditionFailed)
+	s.expect(request{method: http.MethodDelete, target: fmt.Sprintf("/sessions/%d", phoneSession), token: laptop.Token}, http.StatusOK)
+	s.expect(request{method: http.MethodGet, target: "/balance", token: phone.Token}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodGet, target: "/balance", token: refreshed.Token}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodPost, target: "/token/refresh", json: refreshTokenRequest{RefreshToken: refreshed.RefreshToken}}, http.StatusUnauthorized)
+
+	// Logging out.
+	s.expect(request{method: http.MethodPost, target: "/logout", token: laptop.Token}, http.StatusOK)
+	s.expect(request{method: http.MethodGet, target: "/balance", token: laptop.Token}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodPost, target: "/token/refresh", json: refreshTokenRequest{RefreshToken: laptop.RefreshToken}}, http.StatusUnauthorized)
+	s.expect(request{method: http.MethodGet, target: "/balance", token: bobToken}, http.StatusOK)
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "k1.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.NewStore()
+	s := newTestServer(t, &Handler{
+		UserRepo:    memory.NewUserRepository(store),
+		LedgerRepo:  memory.NewLedgerRepository(store),
+		SessionRepo: memory.NewSessionRepository(store),
+		Keys:        keys,
+	}, memory.NewIdempotencyRepository(store))
+
+	jwks := decode[auth.JWKSet](t, s.expect(request{method: http.MethodGet, target: "/.well-known/jwks.json"}, http.StatusOK))
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "k1" || jwks.Keys[0].Algorithm != "EdDSA" {
+		t.Fatalf("GET /.well-known/jwks.json = %+v", jwks)
+	}
+
+	// The access token verifies with the published key.
+	_, token := s.addUser("alice")
+	x, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return ed25519.PublicKey(x), nil })
+	if err != nil || parsed.Header["kid"] != "k1" {
+		t.Errorf("token does not verify with the JWKS: %v", err)
+	}
+	s.expect(request{method: http.MethodGet, target: "/balance", token: token}, http.StatusOK)
+
+	// HS256 secrets are not published.
+	if jwks := decode[auth.JWKSet](t, newMemoryServer(t).expect(request{method: http.MethodGet, target: "/.well-known/jwks.json"}, http.StatusOK)); len(jwks.Keys) != 0 {
+		t.Errorf("GET /.well-known/jwks.json with HS256 = %+v", jwks)
+	}
+}
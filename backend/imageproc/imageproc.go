@@ -0,0 +1,163 @@
+// Package imageproc validates uploaded images, strips their metadata and
+// generates the resized variants served by GET /items/:itemID/image.
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// MaxDimension is the largest accepted width or height in pixels.
+	MaxDimension = 4096
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+// variantEdges is the longest edge of each resized variant.
+var variantEdges = map[domain.ImageSize]int{
+	domain.ImageSizeThumb:  200,
+	domain.ImageSizeMedium: 600,
+}
+
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// Image is an encoded image.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Result is a processed upload: the full size image without metadata and its
+// resized variants.
+type Result struct {
+	Full     Image
+	Variants map[domain.ImageSize]Image
+}
+
+// Process decodes the upload to verify its real format and dimensions, strips
+// EXIF and other metadata, and generates the resized variants.
+//
+// Metadata is removed without re-encoding where possible, so an image without
+// metadata is returned unchanged. JPEGs with an EXIF orientation are rotated
+// upright and re-encoded, since dropping the orientation would turn them.
+func Process(data []byte) (Result, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, ErrUnsupportedFormat
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return Result{}, ErrUnsupportedFormat
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return Result{}, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, errors.Wrap(ErrUnsupportedFormat, err.Error())
+	}
+
+	full := Image{ContentType: contentType}
+	switch format {
+	case "jpeg":
+		if o := jpegOrientation(data); o > 1 {
+			img = orient(img, o)
+			if full.Data, err = encode(img, format); err != nil {
+				return Result{}, err
+			}
+		} else if full.Data, err = stripJPEG(data); err != nil {
+			return Result{}, err
+		}
+	case "png":
+		if full.Data, err = stripPNG(data); err != nil {
+			return Result{}, err
+		}
+	case "gif":
+		// GIF has no EXIF, and re-encoding would drop the animation.
+		full.Data = data
+	}
+	full.Width, full.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	res := Result{Full: full, Variants: make(map[domain.ImageSize]Image, len(variantEdges))}
+	for size, edge := range variantEdges {
+		variant, err := resize(img, format, edge)
+		if err != nil {
+			return Result{}, err
+		}
+		if variant.Data == nil {
+			variant = full
+		}
+		res.Variants[size] = variant
+	}
+	return res, nil
+}
+
+// resize scales img to fit in an edge x edge box. It returns an empty Image if
+// img already fits. Resized GIFs are encoded as PNG.
+func resize(img image.Image, format string, edge int) (Image, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= edge && h <= edge {
+		return Image{}, nil
+	}
+	if w >= h {
+		w, h = edge, max(1, h*edge/w)
+	} else {
+		w, h = max(1, w*edge/h), edge
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	if format == "gif" {
+		format = "png"
+	}
+	data, err := encode(dst, format)
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{Data: data, ContentType: contentTypes[format], Width: w, Height: h}, nil
+}
+
+func encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = ErrUnsupportedFormat
+	}
+	return buf.Bytes(), err
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
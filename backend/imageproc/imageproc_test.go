@@ -0,0 +1,229 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/domain"
+)
+
+var (
+	red  = color.RGBA{R: 0xff, A: 0xff}
+	blue = color.RGBA{B: 0xff, A: 0xff}
+)
+
+// halves returns a w x h image whose left half is red and right half is blue.
+func halves(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withEXIF inserts an APP1 segment with a big-endian EXIF orientation right
+// after the SOI marker of the JPEG.
+func withEXIF(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // entries in IFD0
+	tiff = binary.BigEndian.AppendUint16(tiff, exifOrientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // padding and next IFD offset
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, jpegMarkerAPP1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// withTextChunk inserts a tEXt chunk right after the IHDR chunk of the PNG.
+func withTextChunk(data []byte, keyword, text string) []byte {
+	body := append([]byte("tEXt"+keyword+"\x00"), text...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+
+	ihdrEnd := len(pngSignature) + 12 + 13
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+func TestProcessJPEGOrientation(t *testing.T) {
+	plain := encodeJPEG(t, halves(32, 16))
+
+	res, err := Process(withEXIF(plain, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Full.Width != 16 || res.Full.Height != 32 {
+		t.Errorf("size of a JPEG rotated by EXIF = %dx%d, want 16x32", res.Full.Width, res.Full.Height)
+	}
+	if o := jpegOrientation(res.Full.Data); o != 0 {
+		t.Errorf("orientation of the processed JPEG = %d, want none", o)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(res.Full.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Orientation 6 turns the image clockwise, so its left half ends up on top.
+	if r, _, b, _ := img.At(8, 4).RGBA(); r < b {
+		t.Errorf("top of the rotated JPEG is not red")
+	}
+	if r, _, b, _ := img.At(8, 28).RGBA(); b < r {
+		t.Errorf("bottom of the rotated JPEG is not blue")
+	}
+
+	// An upright JPEG only loses its EXIF segment.
+	res, err = Process(withEXIF(plain, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.Full.Data, plain) {
+		t.Errorf("an upright JPEG was not returned without its EXIF segment")
+	}
+}
+
+func TestProcessPNGTextChunk(t *testing.T) {
+	plain := encodePNG(t, halves(8, 8))
+
+	res, err := Process(withTextChunk(plain, "Comment", "taken at home"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.Full.Data, plain) {
+		t.Errorf("a PNG was not returned without its text chunk")
+	}
+	if res.Full.ContentType != "image/png" || res.Full.Width != 8 || res.Full.Height != 8 {
+		t.Errorf("Process(PNG) = %s %dx%d", res.Full.ContentType, res.Full.Width, res.Full.Height)
+	}
+}
+
+func TestProcessVariants(t *testing.T) {
+	res, err := Process(encodePNG(t, halves(1200, 300)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size, want := range map[domain.ImageSize][2]int{domain.ImageSizeThumb: {200, 50}, domain.ImageSizeMedium: {600, 150}} {
+		v := res.Variants[size]
+		if v.Width != want[0] || v.Height != want[1] {
+			t.Errorf("%s variant = %dx%d, want %dx%d", size, v.Width, v.Height, want[0], want[1])
+		}
+		if config, err := png.DecodeConfig(bytes.NewReader(v.Data)); err != nil || config.Width != want[0] {
+			t.Errorf("%s variant does not decode to its size: %v", size, err)
+		}
+	}
+
+	small := encodePNG(t, halves(100, 100))
+	res, err = Process(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size, v := range res.Variants {
+		if !bytes.Equal(v.Data, small) {
+			t.Errorf("%s variant of a small image is not the image itself", size)
+		}
+	}
+}
+
+func TestProcessInvalid(t *testing.T) {
+	jpg := encodeJPEG(t, halves(32, 16))
+	pngData := encodePNG(t, halves(8, 8))
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"text", []byte("not an image"), ErrUnsupportedFormat},
+		{"truncated JPEG", jpg[:len(jpg)/2], ErrUnsupportedFormat},
+		{"truncated PNG", pngData[:len(pngData)-20], ErrUnsupportedFormat},
+		{"PNG with trailing bytes", append(append([]byte{}, pngData...), 1, 2, 3), ErrUnsupportedFormat},
+		{"oversized", encodePNG(t, image.NewGray(image.Rect(0, 0, MaxDimension+1, 1))), ErrTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := Process(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("Process(%s) = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// src is 3x2:
+	//	1 2 3
+	//	4 5 6
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(src.Pix, []byte{1, 2, 3, 4, 5, 6})
+
+	tests := map[int][][]byte{
+		1: {{1, 2, 3}, {4, 5, 6}},
+		2: {{3, 2, 1}, {6, 5, 4}},
+		3: {{6, 5, 4}, {3, 2, 1}},
+		4: {{4, 5, 6}, {1, 2, 3}},
+		5: {{1, 4}, {2, 5}, {3, 6}},
+		6: {{4, 1}, {5, 2}, {6, 3}},
+		7: {{6, 3}, {5, 2}, {4, 1}},
+		8: {{3, 6}, {2, 5}, {1, 4}},
+	}
+	for orientation, want := range tests {
+		img := orient(src, orientation)
+		b := img.Bounds()
+		got := make([][]byte, b.Dy())
+		for y := range got {
+			for x := 0; x < b.Dx(); x++ {
+				got[y] = append(got[y], color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y)
+			}
+		}
+		if !equalRows(got, want) {
+			t.Errorf("orient(%d) = %v, want %v", orientation, got, want)
+		}
+	}
+}
+
+func equalRows(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,19 +2,27 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/auth"
 	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db/memory"
 	"github.com/soragogo/mecari-build-hackathon-2023/backend/handler"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/storage"
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/validation"
 )
 
 const (
@@ -22,12 +30,37 @@ const (
 	exitError
 )
 
+const (
+	// holdExpiryInterval is how often the expired item holds are released.
+	holdExpiryInterval = time.Minute
+	// orderCompletionInterval is how often the orders shipped long enough
+	// ago are completed.
+	orderCompletionInterval = time.Hour
+)
+
 func main() {
-	os.Exit(run(context.Background()))
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(context.Background(), os.Args[2:]))
+	}
+	os.Exit(run(context.Background(), os.Args[1:]))
 }
 
-func run(ctx context.Context) int {
+func run(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	dev := flags.Bool("dev", false, "allow signing tokens with the default secret")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
 	e := echo.New()
+	trustedProxies, err := newTrustedProxies()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid trusted proxy config: %s\n", err)
+		return exitError
+	}
+	e.IPExtractor = handler.IPExtractor(trustedProxies)
+	e.Validator = validation.New()
+	e.HTTPErrorHandler = handler.HTTPErrorHandler
 
 	// Middleware
 	e.Use(middleware.Recover())
@@ -53,14 +86,6 @@ func run(ctx context.Context) int {
 	}))
 	e.Use(middleware.BodyLimit("5M"))
 
-	// jwt
-	config := echojwt.Config{
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(handler.JwtCustomClaims)
-		},
-		SigningKey: []byte(handler.GetSecret()),
-	}
-
 	// db
 	sqlDB, err := db.PrepareDB(ctx)
 	if err != nil {
@@ -69,39 +94,89 @@ func run(ctx context.Context) int {
 	}
 	defer sqlDB.Close()
 
+	imageStore, err := storage.NewImageStoreFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare image store: %s\n", err)
+		return exitError
+	}
+	seedConfig, err := db.SeedConfigFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid seed config: %s\n", err)
+		return exitError
+	}
+	keys, err := auth.LoadKeySetFromEnv(*dev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load JWT keys: %s\n", err)
+		return exitError
+	}
+	if *dev {
+		fmt.Fprintf(os.Stderr, "development mode: tokens are signed with key %q\n", keys.SigningKeyID())
+	}
+	rateLimitRepo, err := newRateLimitRepository(sqlDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid rate limit config: %s\n", err)
+		return exitError
+	}
+	authLimits, err := newAuthLimits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid rate limit config: %s\n", err)
+		return exitError
+	}
+	responseCache, err := newResponseCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid response cache config: %s\n", err)
+		return exitError
+	}
+	holdDuration, err := newHoldDuration()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid hold config: %s\n", err)
+		return exitError
+	}
+	escrowRelease, err := newEscrowRelease()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid escrow config: %s\n", err)
+		return exitError
+	}
+
 	h := handler.Handler{
-		DB:       sqlDB,
-		UserRepo: db.NewUserRepository(sqlDB),
-		ItemRepo: db.NewItemRepository(sqlDB),
+		DB:              sqlDB,
+		UserRepo:        db.NewUserRepository(sqlDB),
+		ItemRepo:        db.NewCachedItemRepository(db.NewItemRepository(sqlDB)),
+		LedgerRepo:      db.NewLedgerRepository(sqlDB),
+		PurchaseService: db.NewPurchaseService(sqlDB),
+		OrderService:    db.NewOrderService(sqlDB),
+		SessionRepo:     db.NewSessionRepository(sqlDB),
+		RateLimitRepo:   rateLimitRepo,
+		AuthLimits:      authLimits,
+		Keys:            keys,
+		ImageStore:      imageStore,
+		SeedConfig:      seedConfig,
+		ResponseCache:   responseCache,
+		HoldDuration:    holdDuration,
+		EscrowRelease:   escrowRelease,
+	}
+	if _, err := h.MoveImagesToStore(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to move images to image store: %s\n", err)
+		return exitError
+	}
+
+	// jwt
+	config := echojwt.Config{
+		ParseTokenFunc: h.ParseAccessToken,
 	}
 
 	// Routes
-	e.POST("/initialize", h.Initialize)
-	e.GET("/log", h.AccessLog)
-
-	e.GET("/items", h.GetOnSaleItems)
-	e.GET("/items/:itemID", h.GetItem)
-	e.PUT("/items/:itemID", h.GetItem)
-	e.GET("/items/:itemID/image", h.GetImage)
-	e.GET("/items/categories", h.GetCategories)
-	e.GET("/search", h.SearchItems)
-	e.POST("/register", h.Register)
-	e.POST("/login", h.Login)
-
-	// Login required
-	l := e.Group("")
-	l.Use(echojwt.WithConfig(config))
-	l.GET("/users/:userID/items", h.GetUserItems)
-	l.POST("/items", h.AddItem)
-	l.POST("/sell", h.Sell)
-	l.POST("/purchase/:itemID", h.Purchase)
-	l.GET("/balance", h.GetBalance)
-	l.POST("/balance", h.AddBalance)
-	l.POST("/items/new_category", h.AddCategory)
-	l.PUT("/items/", h.PutItem)
-	
+	h.RegisterRoutes(e,
+		echojwt.WithConfig(config),
+		handler.Idempotency(db.NewIdempotencyRepository(sqlDB)),
+	)
 
 	// Start server
+	jobCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	go h.ExpireHolds(jobCtx, holdExpiryInterval, e.Logger)
+	go h.CompleteShippedOrders(jobCtx, orderCompletionInterval, e.Logger)
+
 	go func() {
 		if err := e.Start(":9000"); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server")
@@ -111,6 +186,7 @@ func run(ctx context.Context) int {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
+	stopJobs()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := e.Shutdown(ctx); err != nil {
@@ -120,6 +196,108 @@ func run(ctx context.Context) int {
 	return exitOK
 }
 
+// newTrustedProxies returns the proxies whose X-Forwarded-For header names the
+// client, which TRUSTED_PROXIES sets to comma separated CIDRs such as
+// 10.0.0.0/8. No proxy is trusted by default.
+func newTrustedProxies() ([]*net.IPNet, error) {
+	return parseNetworks("TRUSTED_PROXIES")
+}
+
+// parseNetworks parses the environment variable of comma separated CIDRs.
+func parseNetworks(name string) ([]*net.IPNet, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil, nil
+	}
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(v, ",") {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be comma separated CIDRs: %q", name, v)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// newAuthLimits returns the default authentication limits, without the per IP
+// limits for the networks in RATE_LIMIT_EXEMPT, e.g. of a benchmarker that
+// signs up every user from one IP.
+func newAuthLimits() (handler.AuthLimits, error) {
+	limits := handler.DefaultAuthLimits
+	exempt, err := parseNetworks("RATE_LIMIT_EXEMPT")
+	if err != nil {
+		return handler.AuthLimits{}, err
+	}
+	limits.ExemptNetworks = exempt
+	return limits, nil
+}
+
+// newRateLimitRepository returns where the state of the authentication rate
+// limits is kept: in memory by default, or in the database with
+// RATE_LIMIT_STORE=db when several server processes share it.
+// AUTH_RATE_LIMIT=off disables the limits, e.g. for cmd/bench, which signs up
+// every user from one IP.
+func newRateLimitRepository(sqlDB *sql.DB) (db.RateLimitRepository, error) {
+	if os.Getenv("AUTH_RATE_LIMIT") == "off" {
+		return nil, nil
+	}
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+		return memory.NewRateLimitRepository(memory.NewStore()), nil
+	case "db":
+		return db.NewRateLimitRepository(sqlDB), nil
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_STORE must be memory or db: %q", store)
+	}
+}
+
+// newResponseCache returns the cache of the public item reads, which is
+// enabled by setting RESPONSE_CACHE_TTL to a duration such as 5s. Every server
+// process has its own cache, which only sees its own writes.
+func newResponseCache() (*handler.ResponseCache, error) {
+	v := os.Getenv("RESPONSE_CACHE_TTL")
+	if v == "" {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl < 0 {
+		return nil, fmt.Errorf("RESPONSE_CACHE_TTL must be a non-negative duration: %q", v)
+	}
+	if ttl == 0 {
+		return nil, nil
+	}
+	return handler.NewResponseCache(ttl), nil
+}
+
+// newHoldDuration returns how long a reservation holds an item, which is set
+// by HOLD_DURATION to a duration such as 10m.
+func newHoldDuration() (time.Duration, error) {
+	v := os.Getenv("HOLD_DURATION")
+	if v == "" {
+		return handler.DefaultHoldDuration, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("HOLD_DURATION must be a positive duration: %q", v)
+	}
+	return d, nil
+}
+
+// newEscrowRelease returns how long after shipping an order is completed
+// without the buyer, which is set by ESCROW_RELEASE_DAYS.
+func newEscrowRelease() (time.Duration, error) {
+	v := os.Getenv("ESCROW_RELEASE_DAYS")
+	if v == "" {
+		return handler.DefaultEscrowRelease, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("ESCROW_RELEASE_DAYS must be a positive number of days: %q", v)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
 func logFormat() string {
 	// Customize freely: https://echo.labstack.com/guide/customization/
 	var format string
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/soragogo/mecari-build-hackathon-2023/backend/db"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+Commands:
+  up        apply every pending migration
+  down [N]  revert the last N applied migrations (default 1)
+  status    list migrations and whether they are applied
+`
+
+// runMigrate runs the migrate subcommand.
+func runMigrate(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return exitError
+	}
+
+	sqlDB, err := db.OpenDB(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open DB: %s\n", err)
+		return exitError
+	}
+	defer sqlDB.Close()
+
+	var done []db.Migration
+	switch args[0] {
+	case "up":
+		done, err = db.MigrateUp(ctx, sqlDB)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of migrations: %s\n", args[1])
+				return exitError
+			}
+		}
+		done, err = db.MigrateDown(ctx, sqlDB, n)
+	case "status":
+		return printMigrationStatus(ctx, sqlDB)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return exitError
+	}
+
+	for _, m := range done {
+		fmt.Printf("%s %04d_%s\n", args[0], m.Version, m.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitError
+	}
+	if len(done) == 0 {
+		fmt.Println("nothing to migrate")
+	}
+	return exitOK
+}
+
+func printMigrationStatus(ctx context.Context, sqlDB *sql.DB) int {
+	status, err := db.GetMigrationStatus(ctx, sqlDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get migration status: %s\n", err)
+		return exitError
+	}
+	for _, s := range status {
+		appliedAt := "pending"
+		if s.AppliedAt != "" {
+			appliedAt = "applied at " + s.AppliedAt
+		}
+		fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return exitOK
+}
@@ -1,4 +0,0 @@
-DROP TABLE items;
-DROP TABLE users;
-DROP TABLE category;
-DROP TABLE status;
\ No newline at end of file
@@ -0,0 +1,70 @@
+// Package storage stores item images outside of the database.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotFound   = errors.New("image not found")
+	ErrInvalidKey = errors.New("invalid image key")
+)
+
+// ImageStore stores image blobs addressed by the hex encoded SHA-256 of their
+// content, so storing the same image twice keeps a single copy.
+type ImageStore interface {
+	// Put stores the image and returns its key.
+	Put(ctx context.Context, data []byte, contentType string) (string, error)
+	// Get returns the image stored under the key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Key returns the key of the image with the given content.
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// validKey reports whether key looks like a key returned by Key. Stores check
+// it before building paths from keys.
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// NewImageStoreFromEnv creates the image store selected by IMAGE_STORE:
+//   - "local" (default): files under IMAGE_DIR, which defaults to "images"
+//   - "s3": bucket S3_BUCKET on the S3 compatible server S3_ENDPOINT
+func NewImageStoreFromEnv() (ImageStore, error) {
+	switch kind := getEnv("IMAGE_STORE", "local"); kind {
+	case "local":
+		return NewLocalImageStore(getEnv("IMAGE_DIR", "images"))
+	case "s3":
+		return NewS3ImageStore(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    getEnv("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown IMAGE_STORE: %q", kind)
+	}
+}
+
+func getEnv(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
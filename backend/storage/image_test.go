@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testImageStore checks the behavior every ImageStore shares.
+func testImageStore(t *testing.T, store ImageStore) {
+	t.Helper()
+	ctx := context.Background()
+	data := []byte("\x89PNG\r\n\x1a\nnot really a png")
+
+	key, err := store.Put(ctx, data, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != Key(data) {
+		t.Errorf("Put = %q, want %q", key, Key(data))
+	}
+	if again, err := store.Put(ctx, data, "image/png"); err != nil || again != key {
+		t.Errorf("second Put = %q, %v, want %q", again, err, key)
+	}
+	got, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+
+	if _, err := store.Get(ctx, Key([]byte("missing"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key: got %v, want ErrNotFound", err)
+	}
+	for _, key := range []string{"", "../../etc/passwd", key[:10], key[:62] + "zz"} {
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q): got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LocalImageStore stores images as files in a directory, sharded by the first
+// two characters of the key.
+type LocalImageStore struct {
+	dir string
+}
+
+func NewLocalImageStore(dir string) (*LocalImageStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create image directory")
+	}
+	return &LocalImageStore{dir: dir}, nil
+}
+
+func (s *LocalImageStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+func (s *LocalImageStore) Put(ctx context.Context, data []byte, contentType string) (string, error) {
+	key := Key(data)
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so that readers never see a partial image.
+	f, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *LocalImageStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	data, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
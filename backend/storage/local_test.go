@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalImageStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalImageStore(filepath.Join(dir, "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testImageStore(t, store)
+
+	// Images are sharded by the first two characters of their key, and no
+	// temporary files are left behind.
+	key := Key([]byte("\x89PNG\r\n\x1a\nnot really a png"))
+	entries, err := os.ReadDir(filepath.Join(dir, "images", key[:2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != key {
+		t.Errorf("files of shard %s = %v, want only %s", key[:2], entries, key)
+	}
+}
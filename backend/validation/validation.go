@@ -0,0 +1,211 @@
+// Package validation checks request structs against the rules in their
+// validate tags, e.g.
+//
+//	Name string `json:"name" validate:"required,max=50"`
+//
+// The rules are
+//
+//   - required: the value is not zero, and a string is not blank
+//   - omitempty: skip the other rules if the value is zero
+//   - min=N, max=N: the characters of a string, the length of a slice or
+//     the value of a number
+//   - maxbytes=N: the bytes of a string
+//   - email: a plain address such as name@example.com
+//   - excludes=S: a string does not contain S
+//
+// Fields are reported by their json, form or query name.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError is a field that breaks a rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error lists every field of a request that breaks a rule.
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator is the echo.Validator of the server.
+type Validator struct {
+	// fields caches the parsed rules of each struct type.
+	fields sync.Map
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+type field struct {
+	index     int
+	name      string
+	omitempty bool
+	rules     []rule
+}
+
+type rule struct {
+	name  string
+	param string
+	check func(v reflect.Value, param string) bool
+	// message is a format taking the field name and the param.
+	message string
+}
+
+var checks = map[string]struct {
+	check   func(v reflect.Value, param string) bool
+	message string
+}{
+	"required": {checkRequired, "%[1]s is required"},
+	"min":      {checkMin, "%[1]s must be at least %[2]s"},
+	"max":      {checkMax, "%[1]s must be at most %[2]s"},
+	"maxbytes": {checkMaxBytes, "%[1]s must be at most %[2]s bytes"},
+	"email":    {checkEmail, "%[1]s must be an email address"},
+	"excludes": {checkExcludes, "%[1]s must not contain %[2]s"},
+}
+
+// Validate checks a struct or a pointer to one, and returns an *Error if a
+// field breaks a rule. It panics on a malformed tag.
+func (v *Validator) Validate(i interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(i))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs []FieldError
+	for _, f := range v.fieldsOf(rv.Type()) {
+		fv := rv.Field(f.index)
+		if f.omitempty && fv.IsZero() {
+			continue
+		}
+		for _, r := range f.rules {
+			if !r.check(fv, r.param) {
+				errs = append(errs, FieldError{Field: f.name, Rule: r.name, Message: fmt.Sprintf(r.message, f.name, r.param)})
+				break
+			}
+		}
+	}
+	if errs != nil {
+		return &Error{Fields: errs}
+	}
+	return nil
+}
+
+func (v *Validator) fieldsOf(t reflect.Type) []field {
+	if fields, ok := v.fields.Load(t); ok {
+		return fields.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		f := field{index: i, name: fieldName(sf)}
+		for _, s := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(s, "=")
+			if name == "omitempty" {
+				f.omitempty = true
+				continue
+			}
+			c, ok := checks[name]
+			if !ok {
+				panic(fmt.Sprintf("validation: unknown rule %q of %s.%s", name, t.Name(), sf.Name))
+			}
+			if name == "min" || name == "max" || name == "maxbytes" {
+				mustParse(param)
+			}
+			f.rules = append(f.rules, rule{name: name, param: param, check: c.check, message: c.message})
+		}
+		fields = append(fields, f)
+	}
+	v.fields.Store(t, fields)
+	return fields
+}
+
+func fieldName(sf reflect.StructField) string {
+	for _, key := range []string{"json", "form", "query"} {
+		if name, _, _ := strings.Cut(sf.Tag.Get(key), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+func checkRequired(v reflect.Value, _ string) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) != ""
+	}
+	return !v.IsZero()
+}
+
+func checkMin(v reflect.Value, param string) bool {
+	n, ok := size(v)
+	return ok && n >= mustParse(param)
+}
+
+func checkMax(v reflect.Value, param string) bool {
+	n, ok := size(v)
+	return ok && n <= mustParse(param)
+}
+
+func checkMaxBytes(v reflect.Value, param string) bool {
+	return int64(len(v.String())) <= mustParse(param)
+}
+
+func checkEmail(v reflect.Value, _ string) bool {
+	s := strings.TrimSpace(v.String())
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+func checkExcludes(v reflect.Value, param string) bool {
+	return !strings.Contains(v.String(), param)
+}
+
+// size is what min and max compare.
+func size(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return int64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > uint64(1<<63-1) {
+			return 1<<63 - 1, true
+		}
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+func mustParse(param string) int64 {
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: invalid rule parameter %q", param))
+	}
+	return n
+}
@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testRequest struct {
+	Name     string  `json:"name" validate:"required,max=5"`
+	Password string  `json:"password" validate:"maxbytes=4"`
+	Email    string  `json:"email" validate:"omitempty,email"`
+	Login    string  `form:"login" validate:"excludes=@"`
+	Price    int64   `validate:"min=1"`
+	IDs      []int64 `json:"ids" validate:"omitempty,max=2"`
+	Ignored  string  `json:"ignored"`
+}
+
+func TestValidate(t *testing.T) {
+	v := New()
+	valid := testRequest{Name: "ねこねこね", Password: "pass", Email: "a@example.com", Login: "alice", Price: 1}
+	if err := v.Validate(&valid); err != nil {
+		t.Errorf("Validate(%+v) = %v", valid, err)
+	}
+
+	tests := []struct {
+		req  testRequest
+		want []FieldError
+	}{
+		{testRequest{Name: " ", Price: 1}, []FieldError{{Field: "name", Rule: "required", Message: "name is required"}}},
+		{testRequest{Name: "abcdef", Price: 0}, []FieldError{
+			{Field: "name", Rule: "max", Message: "name must be at most 5"},
+			{Field: "Price", Rule: "min", Message: "Price must be at least 1"},
+		}},
+		{testRequest{Name: "a", Password: "ねこ", Price: 1}, []FieldError{{Field: "password", Rule: "maxbytes", Message: "password must be at most 4 bytes"}}},
+		{testRequest{Name: "a", Email: "A <a@example.com>", Price: 1}, []FieldError{{Field: "email", Rule: "email", Message: "email must be an email address"}}},
+		{testRequest{Name: "a", Login: "a@b", Price: 1}, []FieldError{{Field: "login", Rule: "excludes", Message: "login must not contain @"}}},
+		{testRequest{Name: "a", Price: 1, IDs: []int64{1, 2, 3}}, []FieldError{{Field: "ids", Rule: "max", Message: "ids must be at most 2"}}},
+	}
+	for _, tt := range tests {
+		err := v.Validate(tt.req)
+		var verr *Error
+		if !errors.As(err, &verr) || !reflect.DeepEqual(verr.Fields, tt.want) {
+			t.Errorf("Validate(%+v) = %v, want %+v", tt.req, err, tt.want)
+		}
+	}
+}
+
+func TestValidatePanicsOnMalformedTags(t *testing.T) {
+	for _, req := range []interface{}{
+		struct {
+			A string `validate:"unknown"`
+		}{},
+		struct {
+			A string `validate:"max=x"`
+		}{},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.HasPrefix(r.(string), "validation: ") {
+					t.Errorf("Validate(%T) did not panic: %v", req, r)
+				}
+			}()
+			New().Validate(req)
+		}()
+	}
+}